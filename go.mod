@@ -1,11 +1,12 @@
 module github.com/rgonomic/rgo
 
-go 1.15
+go 1.25.0
 
 require (
 	github.com/google/licensecheck v0.0.0-20200805042302-c54f297c3b57
 	github.com/pkg/diff v0.0.0-20200101054644-e8890afd1f15
-	golang.org/x/mod v0.3.0
-	golang.org/x/tools v0.0.0-20200818005847-188abfa75333
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	golang.org/x/mod v0.35.0
+	golang.org/x/tools v0.44.0
 )
+
+require golang.org/x/sync v0.20.0 // indirect
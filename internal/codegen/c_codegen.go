@@ -10,49 +10,348 @@ import (
 	"text/template"
 )
 
+// asyncMethods are the names of the methods of go_async handles that
+// are implemented by exported Go functions.
+var asyncMethods = []string{"Resolved", "Value", "Cancel", "Release"}
+
 // cFunc is the template for C shim function file generation.
-func CFuncTemplate(words []string) *template.Template {
+func CFuncTemplate(words []string, opts Options) *template.Template {
 	return template.Must(template.New("C func").Funcs(template.FuncMap{
-		"snake":  snake(words),
-		"varsOf": varsOf,
-		"c":      cParams,
-		"names":  names,
-	}).Parse(`// Code generated by rgnonomic/rgo; DO NOT EDIT.
-
-#include "_cgo_export.h"
-
-void R_warning(char* s) {
-	warning(s);
-}
+		"snake":    snake(words),
+		"varsOf":   varsOf,
+		"c":        cParams,
+		"names":    names,
+		"async":    asynchronous(opts),
+		"anyAsync": anyAsync(opts),
+		"handle":   func() []string { return asyncMethods },
+		"parallel": parallel(opts),
+		"anyMap":   anyParallel(opts),
+		"zeroCopy": func() (string, error) { return zeroCopy(opts) },
+		"unshares": unshares(opts),
+		"mutation": anyFunc(checksMutation(opts)),
+	}).Parse(`{{$async := anyAsync .}}{{$parallel := anyMap .}}{{$runtime := .NeedRuntime}}{{$poison := eq zeroCopy "poison"}}// Code generated by rgnonomic/rgo; DO NOT EDIT.
+{{if $poison}}
+#ifdef _WIN32
+#include <windows.h>
+#else
+#include <sys/mman.h>
+#endif
+{{end}}
+#include "_cgo_export.h"{{if $runtime}}
+#include <pthread.h>{{end}}
 
-void R_error(char* s) {
-	error(s);
+// R_raise signals the condition cond as an R error. It must only be
+// called after the Go call returning cond has returned since R errors
+// do not return.
+void R_raise(SEXP cond) {
+	PROTECT(cond);
+	SEXP call = PROTECT(lang2(install("stop"), cond));
+	eval(call, R_BaseEnv);
 }
 
 // TODO(kortschak): Only emit these when needed:
-// Needed for unpacking SEXP character.
+// Needed for unpacking SEXP character. Elements that are not UTF-8
+// or bytes encoded are translated to UTF-8.
 GoString R_gostring(SEXP x, R_xlen_t i) {
 	SEXP _s = STRING_ELT(x, i);
-	GoString s = {(char*)CHAR(_s), STDVEC_LENGTH(_s)};
+	cetype_t enc = getCharCE(_s);
+	if (enc == CE_UTF8 || enc == CE_BYTES) {
+		GoString s = {(char*)CHAR(_s), XLENGTH(_s)};
+		return s;
+	}
+	const char *t = translateCharUTF8(_s);
+	GoString s = {(char*)t, strlen(t)};
 	return s;
 }
 
-// Needed for getting list elements by name.
-int getListElementIndex(SEXP list, const char *str) {
-	int index = -1;
+{{if unshares .}}// R_shared returns whether x may be shared with other R values.
+int R_shared(SEXP x) {
+	return MAYBE_SHARED(x);
+}
+
+{{end}}{{if mutation .}}// R_hash_update returns the FNV-1a hash h updated with the contents of
+// the vector x, including the elements of lists.
+static unsigned long long R_hash_update(unsigned long long h, SEXP x) {
+	const unsigned char *p;
+	size_t n;
+	switch (TYPEOF(x)) {
+	case LGLSXP:
+		p = (const unsigned char*)LOGICAL(x);
+		n = XLENGTH(x) * sizeof(int);
+		break;
+	case INTSXP:
+		p = (const unsigned char*)INTEGER(x);
+		n = XLENGTH(x) * sizeof(int);
+		break;
+	case REALSXP:
+		p = (const unsigned char*)REAL(x);
+		n = XLENGTH(x) * sizeof(double);
+		break;
+	case CPLXSXP:
+		p = (const unsigned char*)COMPLEX(x);
+		n = XLENGTH(x) * sizeof(Rcomplex);
+		break;
+	case RAWSXP:
+		p = (const unsigned char*)RAW(x);
+		n = XLENGTH(x);
+		break;
+	case VECSXP:
+		for (R_xlen_t i = 0; i < XLENGTH(x); i++) {
+			h = R_hash_update(h, VECTOR_ELT(x, i));
+		}
+		return h;
+	default:
+		return h;
+	}
+	for (size_t i = 0; i < n; i++) {
+		h ^= p[i];
+		h *= 1099511628211ULL;
+	}
+	return h;
+}
+
+// R_hash returns a hash of the contents of the vector x that is used to
+// detect modification of R vectors by Go code.
+unsigned long long R_hash(SEXP x) {
+	return R_hash_update(14695981039346656037ULL, x);
+}
+
+{{if $async}}// R_mark_not_mutable marks x so that R code copies it before modifying
+// it while an asynchronous call that is checked for modification of x is
+// running.
+void R_mark_not_mutable(SEXP x) {
+	MARK_NOT_MUTABLE(x);
+}
+
+{{end}}{{end}}{{if $poison}}// R_view returns a copy of the n bytes at p in pages of its own so that
+// the copy can be made inaccessible by R_poison. It returns NULL if the
+// pages cannot be allocated.
+void *R_view(void *p, size_t n) {
+#ifdef _WIN32
+	void *v = VirtualAlloc(NULL, n, MEM_RESERVE|MEM_COMMIT, PAGE_READWRITE);
+#else
+	void *v = mmap(NULL, n, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_ANONYMOUS, -1, 0);
+	if (v == MAP_FAILED) {
+		v = NULL;
+	}
+#endif
+	if (v != NULL) {
+		memcpy(v, p, n);
+	}
+	return v;
+}
+
+// R_poison releases the memory of the n byte copy at v returned by R_view
+// and makes its pages inaccessible. The address range is not reused so
+// that later accesses fault.
+void R_poison(void *v, size_t n) {
+#ifdef _WIN32
+	VirtualFree(v, n, MEM_DECOMMIT);
+#else
+	mmap(v, n, PROT_NONE, MAP_PRIVATE|MAP_ANONYMOUS|MAP_FIXED, -1, 0);
+#endif
+}
+
+{{end}}// Needed for getting list elements by name.
+R_xlen_t getListElementIndex(SEXP list, const char *str) {
+	R_xlen_t index = -1;
 	SEXP names = getAttrib(list, R_NamesSymbol);
-	for (int i = 0; i < length(list); i++) {
+	for (R_xlen_t i = 0; i < xlength(list); i++) {
 		if (strcmp(CHAR(STRING_ELT(names, i)), str) == 0) {
 			index = i;
 			break;
 		}
 	}
 	return index;
-}{{range $func := .Funcs}}{{$params := varsOf $func.Signature.Params}}
+}
+
+// Needed for redirecting Go output. R_redirect_output returns whether
+// the R option name is unset or true.
+int R_redirect_output(const char *name) {
+	SEXP opt = GetOption1(install(name));
+	return opt == R_NilValue || asLogical(opt) == TRUE;
+}
+
+// Needed for redirecting Go output. R_write writes the n bytes in buf
+// to the R console, or to its error stream if err is not zero. NUL bytes,
+// which the console cannot print, are skipped.
+void R_write(char *buf, int n, int err) {
+	while (n > 0) {
+		char *nul = memchr(buf, 0, n);
+		int len = nul == NULL ? n : nul - buf;
+		if (err) {
+			REprintf("%.*s", len, buf);
+		} else {
+			Rprintf("%.*s", len, buf);
+		}
+		if (nul != NULL) {
+			len++;
+		}
+		buf += len;
+		n -= len;
+	}
+}{{if .Unpackers.NeedConnection}}
+
+// Needed for reading from R connections.
+SEXP R_readBin(SEXP con, R_xlen_t n, int *failed) {
+	SEXP call = PROTECT(lang4(install("readBin"), con, mkString("raw"), ScalarReal((double)n)));
+	SEXP r = R_tryEval(call, R_BaseEnv, failed);
+	UNPROTECT(1);
+	return r;
+}
+
+// Needed for writing to R connections.
+int R_writeBin(SEXP con, void *buf, R_xlen_t n) {
+	int failed;
+	SEXP b = PROTECT(allocVector(RAWSXP, n));
+	memcpy(RAW(b), buf, n);
+	SEXP call = PROTECT(lang3(install("writeBin"), b, con));
+	R_tryEval(call, R_BaseEnv, &failed);
+	UNPROTECT(2);
+	return failed;
+}{{end}}{{if $runtime}}
 
-SEXP {{snake $func.Func.Name}}({{c $params}}) {
-	return Wrapped_{{$func.Func.Name}}({{names false $params}});
-}{{end}}
+// Needed for replaying R conditions. R_signal signals the warnings and
+// messages queued by the wrapped package using the R warning and message
+// functions. It must only be called after the Go call queueing them has
+// returned since signalling a condition may not return. The result r and
+// error err of the call are protected while the conditions are signalled.
+void R_signal(SEXP r, SEXP err) {
+	PROTECT(r);
+	PROTECT(err == NULL ? R_NilValue : err);
+	SEXP conds = PROTECT(Wrapped_conditions());
+	for (R_xlen_t i = 0; i < xlength(conds); i++) {
+		SEXP cond = VECTOR_ELT(conds, i);
+		SEXP fn = install(inherits(cond, "warning") ? "warning" : "message");
+		SEXP call = PROTECT(lang2(fn, cond));
+		eval(call, R_BaseEnv);
+		UNPROTECT(1);
+	}
+	UNPROTECT(3);
+}
+
+// Needed for calling back into R. R_main is the R main thread, which is
+// recorded by R_enter when a wrapped function is first called.
+static pthread_t R_main;
+static int R_main_known;
+
+void R_enter(void) {
+	if (!R_main_known) {
+		R_main = pthread_self();
+		R_main_known = 1;
+	}
+}
+
+// Needed for calling back into R. R_on_main returns whether it is
+// called on the R main thread.
+int R_on_main(void) {
+	return R_main_known && pthread_equal(R_main, pthread_self());
+}
+
+// Needed for calling back into R. R_call evaluates a call to the function
+// name, or pkg::name if pkg is not NULL, with the arguments held in the
+// list args. failed is set if an R error occurs.
+SEXP R_call(const char *pkg, const char *name, SEXP args, int *failed) {
+	SEXP fn = install(name);
+	if (pkg != NULL) {
+		fn = lang3(install("::"), install(pkg), fn);
+	}
+	PROTECT(fn);
+	R_xlen_t n = xlength(args);
+	SEXP call = PROTECT(allocList((int)n + 1));
+	SET_TYPEOF(call, LANGSXP);
+	SETCAR(call, fn);
+	SEXP arg = CDR(call);
+	for (R_xlen_t i = 0; i < n; i++) {
+		SETCAR(arg, VECTOR_ELT(args, i));
+		arg = CDR(arg);
+	}
+	SEXP r = R_tryEvalSilent(call, R_GlobalEnv, failed);
+	UNPROTECT(2);
+	return r;
+}{{end}}{{if or .NeedContext $async $parallel $runtime}}
+
+static void check_interrupt(void *data) {
+	R_CheckUserInterrupt();
+}
+
+// Needed for cancelling contexts on user interrupts. R_interrupted
+// returns whether an R user interrupt is pending, consuming it. It
+// must only be called on the R thread.
+int R_interrupted(void) {
+	return R_ToplevelExec(check_interrupt, NULL) == FALSE;
+}{{end}}{{range $func := .Funcs}}{{$params := varsOf $func.Params}}
+
+SEXP {{snake $func.Func.Name}}({{c $params}}{{if $func.Context}}{{if $params}}, {{end}}SEXP _timeout{{end}}) {
+	{{if $runtime}}R_enter();
+	{{end}}SEXP _err = NULL;
+	SEXP _r = Wrapped_{{$func.Func.Name}}({{names false $params}}{{if $params}}, {{end}}{{if $func.Context}}_timeout, {{end}}&_err);{{if $runtime}}
+	R_signal(_r, _err);{{end}}
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}{{if async $func}}
+
+SEXP {{snake $func.Func.Name}}_async({{c $params}}{{if $func.Context}}{{if $params}}, {{end}}SEXP _timeout{{end}}) {
+	{{if $runtime}}R_enter();
+	{{end}}SEXP _err = NULL;
+	SEXP _r = Wrapped_{{$func.Func.Name}}_async({{names false $params}}{{if $params}}, {{end}}{{if $func.Context}}_timeout, {{end}}&_err);{{if $runtime}}
+	R_signal(_r, _err);{{end}}
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}{{end}}{{if parallel $func}}
+
+SEXP {{snake $func.Func.Name}}_map(SEXP args, SEXP workers{{if $func.Context}}, SEXP _timeout{{end}}) {
+	{{if $runtime}}R_enter();
+	{{end}}SEXP _err = NULL;
+	SEXP _r = Wrapped_{{$func.Func.Name}}_map(args, workers, {{if $func.Context}}_timeout, {{end}}&_err);{{if $runtime}}
+	R_signal(_r, _err);{{end}}
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}{{end}}{{end}}{{if $async}}{{range $name := handle}}
+
+SEXP rgo_async_{{snake $name}}(SEXP id) {
+	{{if $runtime}}R_enter();
+	{{end}}SEXP _err = NULL;
+	SEXP _r = Wrapped_async{{$name}}(id, &_err);{{if $runtime}}
+	R_signal(_r, _err);{{end}}
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}{{end}}{{end}}
+
+SEXP rgo_runtime_set(SEXP maxprocs, SEXP gc_percent, SEXP memory_limit) {
+	SEXP _err = NULL;
+	SEXP _r = Wrapped_runtimeSet(maxprocs, gc_percent, memory_limit, &_err);
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}
+
+SEXP rgo_runtime_stats(void) {
+	SEXP _err = NULL;
+	SEXP _r = Wrapped_runtimeStats(&_err);
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}
+
+SEXP rgo_runtime_gc(void) {
+	SEXP _err = NULL;
+	SEXP _r = Wrapped_runtimeGC(&_err);
+	if (_err != NULL) {
+		R_raise(_err);
+	}
+	return _r;
+}
 `))
 }
 
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"go/types"
 	"io"
+	"math"
 	"path"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -16,6 +18,123 @@ import (
 	"github.com/rgonomic/rgo/internal/pkg"
 )
 
+// Options holds user configurable code generation options.
+type Options struct {
+	// NullDefault specifies that pointer, slice and map
+	// parameters default to NULL in the generated R
+	// functions so that they may be omitted.
+	NullDefault bool
+
+	// CommaOk specifies whether functions with a
+	// final bool result return NULL to R when that
+	// result is false and the remaining results
+	// otherwise. CommaOk is keyed by function name.
+	// Functions that are not listed use comma-ok
+	// semantics when the bool result is named
+	// "ok" or "found".
+	CommaOk map[string]bool
+
+	// ErrorCondition specifies that a non-nil final
+	// error result is signalled to R as a condition
+	// of class go_error rather than being returned.
+	ErrorCondition bool
+
+	// ErrorIs and ErrorAs map Go errors to R condition
+	// classes that are added to go_error conditions.
+	// ErrorIs is keyed by sentinel error values and
+	// ErrorAs by error types, each qualified by import
+	// path, for example "io.EOF" or "*os.PathError".
+	// Errors are matched using errors.Is and errors.As.
+	ErrorIs map[string]string
+	ErrorAs map[string]string
+
+	// Coerce specifies that the generated R functions
+	// coerce integral double arguments to integer and
+	// logical and integer arguments to double when the
+	// Go parameter requires them. Otherwise argument
+	// types must match exactly.
+	Coerce bool
+
+	// IntOverflow specifies how int, int32, uint and
+	// uint32 results that cannot be represented as an
+	// R integer are returned. The value "error", the
+	// default, signals a go_overflow_error condition,
+	// "promote" returns a double vector when any value
+	// is out of range and "double" always returns
+	// double vectors for these types.
+	IntOverflow string
+
+	// InvalidString specifies how string results that
+	// are not valid UTF-8 or that hold NUL bytes, and
+	// so cannot be held in an R character vector, are
+	// returned. The value "error", the default, signals
+	// a go_string_error condition, "replace" replaces
+	// invalid bytes and NULs with U+FFFD and "raw"
+	// returns the strings as raw vectors. Map keys are
+	// replaced under the "raw" policy.
+	InvalidString string
+
+	// Vectorise is a pattern matching names of functions
+	// that are vectorised over their arguments following
+	// R's recycling rules. Only functions with scalar
+	// parameters and a single scalar result of basic
+	// types are vectorised. NA arguments give NA results.
+	Vectorise string
+
+	// Async is a pattern matching names of functions
+	// that have an asynchronous variant named with an
+	// _async suffix. The variant returns a go_async
+	// handle after starting the call on a goroutine.
+	// Vectorised functions and functions taking
+	// connections do not have asynchronous variants.
+	Async string
+
+	// Parallel is a pattern matching names of functions
+	// that have a parallel apply variant named with a
+	// _map suffix. The variant takes a list of argument
+	// lists and makes the calls concurrently, returning
+	// a list of results. Vectorised functions and
+	// functions taking connections do not have parallel
+	// apply variants.
+	Parallel string
+
+	// ZeroCopy specifies how []int32, []float64,
+	// []complex128, []byte and string parameters, which
+	// refer directly to R memory, are handled. The value
+	// "share", the default, passes views of R memory
+	// that must not be retained after the call returns,
+	// "copy" copies the values into Go memory, and
+	// "preserve" protects the R vectors from collection
+	// until the call returns and copies strings.
+	// The value "poison" is for debugging; the values
+	// are copied into memory that is made inaccessible
+	// when the call returns so that Go code retaining
+	// them faults.
+	ZeroCopy string
+
+	// ReadOnly is a pattern matching names of functions
+	// that do not modify the elements of their []int32,
+	// []float64, []complex128 and []byte parameters.
+	// When these parameters share R memory, the R
+	// vectors passed to other functions are duplicated
+	// if they may be shared with other R values so that
+	// modifications are not seen through those values.
+	ReadOnly string
+
+	// InPlace is a pattern matching names of functions
+	// that may modify the elements of R vectors passed
+	// to them in place. The modifications are seen by
+	// all R values sharing the vectors.
+	InPlace string
+
+	// CheckMutation specifies that calls to functions
+	// matching ReadOnly signal a go_mutation_error
+	// condition if they modify the R vectors passed to
+	// them. The vectors are hashed before and after
+	// each call, so this is intended for debugging.
+	CheckMutation bool
+}
+
 type FileSystem interface {
 	Open(path string) (io.WriteCloser, error)
 	Flush() error
@@ -64,6 +183,57 @@ func names(leadingComma bool, vars []*types.Var) string {
 	return buf.String()
 }
 
+// commaOk returns a closure that reports whether the final result of a
+// function is a comma-ok bool that determines whether the function's other
+// outputs or NULL are returned to R.
+func commaOk(opts Options) func(pkg.FuncInfo) bool {
+	return func(fn pkg.FuncInfo) bool {
+		res := fn.Signature().Results()
+		n := res.Len()
+		if n == 0 || len(fn.Outputs()) < 2 {
+			return false
+		}
+		last := res.At(n - 1)
+		if basic, ok := last.Type().(*types.Basic); !ok || basic.Kind() != types.Bool {
+			return false
+		}
+		if on, ok := opts.CommaOk[fn.Func.Name()]; ok {
+			return on
+		}
+		return last.Name() == "ok" || last.Name() == "found"
+	}
+}
+
+// errorResult returns a closure that reports whether the final result of a
+// function is an error that is signalled to R as a condition when it is
+// not nil.
+func errorResult(opts Options) func(pkg.FuncInfo) bool {
+	errorType := types.Universe.Lookup("error").Type()
+	return func(fn pkg.FuncInfo) bool {
+		if !opts.ErrorCondition {
+			return false
+		}
+		res := fn.Signature().Results()
+		n := res.Len()
+		return n != 0 && types.Identical(res.At(n-1).Type(), errorType)
+	}
+}
+
+// outputs returns a closure that returns the outputs of a function that
+// are packed into the value returned to R.
+func outputs(opts Options) func(pkg.FuncInfo) []*types.Var {
+	isCommaOk := commaOk(opts)
+	isErrorResult := errorResult(opts)
+	return func(fn pkg.FuncInfo) []*types.Var {
+		out := fn.Outputs()
+		if !isCommaOk(fn) && !isErrorResult(fn) {
+			return out
+		}
+		last := fn.Signature().Results().Len() - 1
+		return append(out[:last:last], out[last+1:]...)
+	}
+}
+
 // varsOf returns the vars of the given tuple.
 func varsOf(t *types.Tuple) []*types.Var {
 	if t.Len() == 0 {
@@ -75,3 +245,311 @@ func varsOf(t *types.Tuple) []*types.Var {
 	}
 	return vars
 }
+
+// intRange returns the range of R integer values that may be held by
+// the given Go integer kind when it is narrower than an R integer. The
+// R integer NA value is never in range.
+func intRange(kind types.BasicKind) (min, max int64, ok bool) {
+	switch kind {
+	case types.Int8:
+		return math.MinInt8, math.MaxInt8, true
+	case types.Int16:
+		return math.MinInt16, math.MaxInt16, true
+	case types.Uint8:
+		return 0, math.MaxUint8, true
+	case types.Uint16:
+		return 0, math.MaxUint16, true
+	case types.Uint, types.Uint32:
+		return 0, math.MaxInt32, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// intOverflow returns the integer result overflow policy specified
+// by opts.
+func intOverflow(opts Options) (string, error) {
+	switch opts.IntOverflow {
+	case "", "error":
+		return "error", nil
+	case "promote", "double":
+		return opts.IntOverflow, nil
+	default:
+		return "", fmt.Errorf("invalid IntOverflow policy: %q", opts.IntOverflow)
+	}
+}
+
+// overflows returns whether values of the given Go integer kind may not
+// be representable as R integers. This includes int32 since the minimum
+// int32 value is the R integer NA value.
+func overflows(kind types.BasicKind) bool {
+	switch kind {
+	case types.Int, types.Int32, types.Uint, types.Uint32:
+		return true
+	default:
+		return false
+	}
+}
+
+// invalidString returns the invalid string result policy specified
+// by opts.
+func invalidString(opts Options) (string, error) {
+	switch opts.InvalidString {
+	case "", "error":
+		return "error", nil
+	case "replace", "raw":
+		return opts.InvalidString, nil
+	default:
+		return "", fmt.Errorf("invalid InvalidString policy: %q", opts.InvalidString)
+	}
+}
+
+// zeroCopy returns the zero-copy parameter policy specified by opts.
+func zeroCopy(opts Options) (string, error) {
+	switch opts.ZeroCopy {
+	case "", "share":
+		return "share", nil
+	case "copy", "preserve", "poison":
+		return opts.ZeroCopy, nil
+	default:
+		return "", fmt.Errorf("invalid ZeroCopy policy: %q", opts.ZeroCopy)
+	}
+}
+
+// vectorised returns a closure that reports whether a function is
+// vectorised over its arguments.
+func vectorised(opts Options) func(pkg.FuncInfo) (bool, error) {
+	if opts.Vectorise == "" {
+		return func(pkg.FuncInfo) (bool, error) { return false, nil }
+	}
+	re, err := regexp.Compile(opts.Vectorise)
+	return func(fn pkg.FuncInfo) (bool, error) {
+		if err != nil {
+			return false, fmt.Errorf("invalid Vectorise pattern: %w", err)
+		}
+		return re.MatchString(fn.Func.Name()) && canVectorise(fn), nil
+	}
+}
+
+// asynchronous returns a closure that reports whether a function has an
+// asynchronous variant.
+func asynchronous(opts Options) func(pkg.FuncInfo) (bool, error) {
+	return variant("Async", opts.Async, opts)
+}
+
+// parallel returns a closure that reports whether a function has a
+// parallel apply variant.
+func parallel(opts Options) func(pkg.FuncInfo) (bool, error) {
+	return variant("Parallel", opts.Parallel, opts)
+}
+
+// variant returns a closure that reports whether a function has a variant
+// that calls it on other goroutines. Functions have a variant if their
+// name matches pattern, they do not take connections and they are not
+// vectorised. The option name is used in error messages.
+func variant(option, pattern string, opts Options) func(pkg.FuncInfo) (bool, error) {
+	if pattern == "" {
+		return func(pkg.FuncInfo) (bool, error) { return false, nil }
+	}
+	isVectorised := vectorised(opts)
+	re, err := regexp.Compile(pattern)
+	return func(fn pkg.FuncInfo) (bool, error) {
+		if err != nil {
+			return false, fmt.Errorf("invalid %s pattern: %w", option, err)
+		}
+		if !re.MatchString(fn.Func.Name()) {
+			return false, nil
+		}
+		params := fn.Params()
+		for i := 0; i < params.Len(); i++ {
+			if pkg.IsConnection(params.At(i).Type()) {
+				return false, nil
+			}
+		}
+		vector, err := isVectorised(fn)
+		return !vector, err
+	}
+}
+
+// readOnly returns a closure that reports whether a function is declared
+// not to modify its parameters.
+func readOnly(opts Options) func(pkg.FuncInfo) (bool, error) {
+	return matches("ReadOnly", opts.ReadOnly)
+}
+
+// sharesInputs returns a closure that reports whether a function is
+// passed shared R vectors without duplication, either because it does
+// not modify them or because it is allowed to modify them in place.
+func sharesInputs(opts Options) func(pkg.FuncInfo) (bool, error) {
+	isReadOnly := readOnly(opts)
+	isInPlace := matches("InPlace", opts.InPlace)
+	return func(fn pkg.FuncInfo) (bool, error) {
+		ok, err := isReadOnly(fn)
+		if ok || err != nil {
+			return ok, err
+		}
+		return isInPlace(fn)
+	}
+}
+
+// checksMutation returns a closure that reports whether calls to a
+// function check that it does not modify the R vectors passed to it.
+// Calls are checked when opts specifies CheckMutation, the function is
+// declared read-only and it has parameters that share R memory.
+func checksMutation(opts Options) func(pkg.FuncInfo) (bool, error) {
+	isReadOnly := readOnly(opts)
+	return func(fn pkg.FuncInfo) (bool, error) {
+		if !opts.CheckMutation {
+			return false, nil
+		}
+		policy, err := zeroCopy(opts)
+		if err != nil || (policy != "share" && policy != "preserve") {
+			return false, err
+		}
+		ok, err := isReadOnly(fn)
+		if !ok || err != nil {
+			return false, err
+		}
+		for _, p := range varsOf(fn.Params()) {
+			if sharesMemory(p.Type()) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// matches returns a closure that reports whether the name of a function
+// matches pattern. The option name is used in error messages.
+func matches(option, pattern string) func(pkg.FuncInfo) (bool, error) {
+	if pattern == "" {
+		return func(pkg.FuncInfo) (bool, error) { return false, nil }
+	}
+	re, err := regexp.Compile(pattern)
+	return func(fn pkg.FuncInfo) (bool, error) {
+		if err != nil {
+			return false, fmt.Errorf("invalid %s pattern: %w", option, err)
+		}
+		return re.MatchString(fn.Func.Name()), nil
+	}
+}
+
+// sharesMemory returns whether values of type typ unpacked from R may
+// refer to R vector memory when the zero-copy policy is "share" or
+// "preserve". This is the case for []int32, []float64, []complex128
+// and []byte, and types holding them in struct fields, pointers or
+// slices.
+func sharesMemory(typ types.Type) bool {
+	return sharesMemoryRec(typ, make(map[types.Type]bool))
+}
+
+func sharesMemoryRec(typ types.Type, seen map[types.Type]bool) bool {
+	if seen[typ] {
+		return false
+	}
+	seen[typ] = true
+	switch typ := typ.(type) {
+	case *types.Named:
+		if pkg.IsConnection(typ) {
+			return false
+		}
+		return sharesMemoryRec(typ.Underlying(), seen)
+	case *types.Pointer:
+		return sharesMemoryRec(typ.Elem(), seen)
+	case *types.Slice:
+		if elem, ok := typ.Elem().(*types.Basic); ok {
+			switch elem.Kind() {
+			case types.Int32, types.Uint8, types.Float64, types.Complex128:
+				return true
+			}
+		}
+		return sharesMemoryRec(typ.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if sharesMemoryRec(typ.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unshares returns a closure that reports whether the generated code
+// duplicates shared R vectors before passing them to Go. This is the
+// case when the zero-copy policy specified by opts passes views of R
+// memory and a type unpacked from R shares memory.
+func unshares(opts Options) func(*pkg.Info) (bool, error) {
+	return func(info *pkg.Info) (bool, error) {
+		policy, err := zeroCopy(opts)
+		if err != nil {
+			return false, err
+		}
+		if policy != "share" && policy != "preserve" {
+			return false, nil
+		}
+		for _, typ := range info.Unpackers.Types() {
+			if sharesMemory(typ) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// anyAsync returns a closure that reports whether any of the functions
+// in a package has an asynchronous variant.
+func anyAsync(opts Options) func(*pkg.Info) (bool, error) {
+	return anyFunc(asynchronous(opts))
+}
+
+// anyParallel returns a closure that reports whether any of the functions
+// in a package has a parallel apply variant.
+func anyParallel(opts Options) func(*pkg.Info) (bool, error) {
+	return anyFunc(parallel(opts))
+}
+
+// anyFunc returns a closure that reports whether is returns true for any
+// of the functions in a package.
+func anyFunc(is func(pkg.FuncInfo) (bool, error)) func(*pkg.Info) (bool, error) {
+	return func(info *pkg.Info) (bool, error) {
+		for _, fn := range info.Funcs {
+			ok, err := is(fn)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// canVectorise returns whether fn has at least one parameter, only scalar
+// parameters and a single scalar result of basic types, and no in-out
+// parameters.
+func canVectorise(fn pkg.FuncInfo) bool {
+	sig := fn.Signature()
+	if sig.Params().Len() == 0 || sig.Results().Len() != 1 || len(fn.InOut) != 0 {
+		return false
+	}
+	for _, v := range append(varsOf(sig.Params()), sig.Results().At(0)) {
+		if _, ok := v.Type().Underlying().(*types.Basic); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// vectorKind returns the element kind of the Go slice holding the R vector
+// for a vectorised parameter or result of the given kind. Scalar uint8
+// values are R integers, but []uint8 corresponds to an R raw vector.
+func vectorKind(kind types.BasicKind) types.BasicKind {
+	if kind == types.Uint8 {
+		return types.Uint16
+	}
+	return kind
+}
+
+// vectorType returns the Go slice type holding the R vector for a vectorised
+// parameter or result of the given type.
+func vectorType(typ types.Type) types.Type {
+	return types.NewSlice(types.Typ[vectorKind(typ.Underlying().(*types.Basic).Kind())])
+}
@@ -0,0 +1,374 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"go/types"
+	"reflect"
+	"testing"
+
+	"github.com/rgonomic/rgo/internal/pkg"
+)
+
+var commaOkTests = []struct {
+	name    string
+	results []*types.Var
+	opts    Options
+	want    bool
+}{
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "v", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "ok", types.Typ[types.Bool]),
+		},
+		want: true,
+	},
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "v", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "found", types.Typ[types.Bool]),
+		},
+		want: true,
+	},
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "v", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "found", types.Typ[types.Bool]),
+		},
+		opts: Options{CommaOk: map[string]bool{"F": false}},
+		want: false,
+	},
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "", types.Typ[types.Bool]),
+		},
+		want: false,
+	},
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "", types.Typ[types.Bool]),
+		},
+		opts: Options{CommaOk: map[string]bool{"F": true}},
+		want: true,
+	},
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "ok", types.Typ[types.Bool]),
+		},
+		want: false,
+	},
+	{
+		name: "F",
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "ok", types.Typ[types.Bool]),
+			types.NewParam(0, mockPkg, "v", types.Typ[types.Float64]),
+		},
+		want: false,
+	},
+}
+
+func TestCommaOk(t *testing.T) {
+	for i, test := range commaOkTests {
+		sig := types.NewSignature(nil, nil, types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, test.name, sig)}
+		got := commaOk(test.opts)(fn)
+		if got != test.want {
+			t.Errorf("unexpected result for test %d: got:%t want:%t", i, got, test.want)
+		}
+	}
+}
+
+var errorMatchesTests = []struct {
+	opts    Options
+	want    []errorMatch
+	wantErr bool
+}{
+	{
+		opts: Options{},
+		want: nil,
+	},
+	{
+		opts: Options{
+			ErrorIs: map[string]string{"os.ErrNotExist": "not_exist", "io.EOF": "eof"},
+			ErrorAs: map[string]string{"*os.PathError": "path_error", "example.com/a.b/c.Err": "c_error"},
+		},
+		want: []errorMatch{
+			{alias: "_rgo_err0", path: "io", name: "EOF", is: true, class: "eof"},
+			{alias: "_rgo_err1", path: "os", name: "ErrNotExist", is: true, class: "not_exist"},
+			{alias: "_rgo_err1", path: "os", name: "PathError", pointer: true, class: "path_error"},
+			{alias: "_rgo_err2", path: "example.com/a.b/c", name: "Err", class: "c_error"},
+		},
+	},
+	{
+		opts:    Options{ErrorIs: map[string]string{"*os.PathError": "path_error"}},
+		wantErr: true,
+	},
+	{
+		opts:    Options{ErrorIs: map[string]string{"EOF": "eof"}},
+		wantErr: true,
+	},
+	{
+		opts:    Options{ErrorAs: map[string]string{"example.com/a.b/c": "c_error"}},
+		wantErr: true,
+	},
+}
+
+func TestErrorMatches(t *testing.T) {
+	for i, test := range errorMatchesTests {
+		got, err := errorMatches(test.opts)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unexpected error for test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("unexpected result for test %d:\ngot: %+v\nwant:%+v", i, got, test.want)
+		}
+	}
+}
+
+var vectorisedTests = []struct {
+	name    string
+	params  []*types.Var
+	results []*types.Var
+	opts    Options
+	want    bool
+	wantErr bool
+}{
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{},
+		want:    false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Vectorise: "^F$"},
+		want:    true,
+	},
+	{
+		name:    "G",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Vectorise: "^F$"},
+		want:    false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Vectorise: "."},
+		want:    false,
+	},
+	{
+		name: "F",
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "s", types.Typ[types.String]),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "", types.Universe.Lookup("error").Type()),
+		},
+		opts: Options{Vectorise: "."},
+		want: false,
+	},
+	{
+		name:    "F",
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Vectorise: "."},
+		want:    false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Vectorise: "("},
+		wantErr: true,
+	},
+}
+
+func TestVectorised(t *testing.T) {
+	for i, test := range vectorisedTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, test.name, sig)}
+		got, err := vectorised(test.opts)(fn)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unexpected error for test %d: %v", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("unexpected result for test %d: got:%t want:%t", i, got, test.want)
+		}
+	}
+}
+
+var asynchronousTests = []struct {
+	name    string
+	params  []*types.Var
+	results []*types.Var
+	opts    Options
+	want    bool
+	wantErr bool
+}{
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Async: "^F$"},
+		want:    true,
+	},
+	{
+		name:    "G",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Async: "^F$"},
+		want:    false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Async: ".", Vectorise: "."},
+		want:    false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "r", namedInterface("io", "Reader"))},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Int])},
+		opts:    Options{Async: "."},
+		want:    false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])},
+		results: []*types.Var{types.NewParam(0, mockPkg, "", types.Typ[types.Float64])},
+		opts:    Options{Async: "("},
+		wantErr: true,
+	},
+}
+
+func TestAsynchronous(t *testing.T) {
+	for i, test := range asynchronousTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, test.name, sig)}
+		got, err := asynchronous(test.opts)(fn)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unexpected error for test %d: %v", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("unexpected result for test %d: got:%t want:%t", i, got, test.want)
+		}
+	}
+}
+
+var checksMutationTests = []struct {
+	name    string
+	params  []*types.Var
+	opts    Options
+	want    bool
+	wantErr bool
+}{
+	{
+		name:   "F",
+		params: []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		opts:   Options{ReadOnly: "^F$", CheckMutation: true},
+		want:   true,
+	},
+	{
+		name:   "F",
+		params: []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		opts:   Options{ReadOnly: "^F$"},
+		want:   false,
+	},
+	{
+		name:   "G",
+		params: []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		opts:   Options{ReadOnly: "^F$", InPlace: "^G$", CheckMutation: true},
+		want:   false,
+	},
+	{
+		name: "F",
+		params: []*types.Var{types.NewParam(0, mockPkg, "x", types.NewPointer(types.NewStruct([]*types.Var{
+			types.NewField(0, mockPkg, "F1", types.NewSlice(types.Typ[types.Uint8]), false),
+		}, nil)))},
+		opts: Options{ReadOnly: ".", CheckMutation: true},
+		want: true,
+	},
+	{
+		name:   "F",
+		params: []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Int]))},
+		opts:   Options{ReadOnly: ".", CheckMutation: true},
+		want:   false,
+	},
+	{
+		name:   "F",
+		params: []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		opts:   Options{ReadOnly: ".", CheckMutation: true, ZeroCopy: "copy"},
+		want:   false,
+	},
+	{
+		name:    "F",
+		params:  []*types.Var{types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64]))},
+		opts:    Options{ReadOnly: "(", CheckMutation: true},
+		wantErr: true,
+	},
+}
+
+func TestChecksMutation(t *testing.T) {
+	for i, test := range checksMutationTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), nil, false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, test.name, sig)}
+		got, err := checksMutation(test.opts)(fn)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unexpected error for test %d: %v", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("unexpected result for test %d: got:%t want:%t", i, got, test.want)
+		}
+	}
+}
+
+var checkNamesTests = []struct {
+	names   []string
+	opts    Options
+	wantErr bool
+}{
+	{names: []string{"F", "G"}},
+	{names: []string{"F", "FAsync"}},
+	{names: []string{"F", "FAsync"}, opts: Options{Async: "^F$"}, wantErr: true},
+	{names: []string{"F", "FMap"}, opts: Options{Parallel: "^F$"}, wantErr: true},
+	{names: []string{"GoRuntimeSet"}},
+	{names: []string{"PkgGoRuntimeSet"}, wantErr: true},
+	{names: []string{"RgoRuntimeGC"}, wantErr: true},
+	{names: []string{"RgoAsyncValue"}},
+	{names: []string{"F", "RgoAsyncValue"}, opts: Options{Async: "^F$"}, wantErr: true},
+}
+
+func TestCheckNames(t *testing.T) {
+	for i, test := range checkNamesTests {
+		sig := types.NewSignature(nil, types.NewTuple(types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])), nil, false)
+		var info pkg.Info
+		for _, name := range test.names {
+			info.Funcs = append(info.Funcs, pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, name, sig)})
+		}
+		err := CheckNames([]string{"GC"}, test.opts, &info)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unexpected error for test %d: %v", i, err)
+		}
+	}
+}
@@ -18,18 +18,47 @@ import (
 )
 
 // goFunc is the template for Go function file generation.
-func GoFuncTemplate() *template.Template {
+func GoFuncTemplate(opts Options) *template.Template {
 	return template.Must(template.New("Go func").Funcs(template.FuncMap{
-		"imports":    imports,
-		"varsOf":     varsOf,
-		"go":         goParams,
-		"anon":       anonymous,
-		"types":      typeNames,
-		"mangle":     pkg.Mangle,
-		"unpackSEXP": unpackSEXPFuncGo,
-		"packSEXP":   packSEXPFuncGo,
-		"dec":        func(i int) int { return i - 1 },
-	}).Parse(`{{$pkg := .Pkg}}// Code generated by rgnonomic/rgo; DO NOT EDIT.
+		"commaOk":         commaOk(opts),
+		"errorResult":     errorResult(opts),
+		"errorConditions": errorConditions(opts),
+		"errorImports":    func() ([]string, error) { return errorImports(opts) },
+		"errorClasses":    func() (string, error) { return errorClassesGo(opts) },
+		"invalidString":   func() (string, error) { return invalidString(opts) },
+		"zeroCopy":        func() (string, error) { return zeroCopy(opts) },
+		"outputs":         outputs(opts),
+		"imports":         imports,
+		"varsOf":          varsOf,
+		"go":              goParams,
+		"anon":            anonymous,
+		"outArgs":         outArgs(opts),
+		"types":           typeNames,
+		"mangle":          pkg.Mangle,
+		"unpackSEXP":      unpackSEXP(opts),
+		"unshares":        unshares(opts),
+		"sharesInputs":    sharesInputs(opts),
+		"sharesMemory":    sharesMemory,
+		"checked":         checksMutation(opts),
+		"anyChecked":      anyFunc(checksMutation(opts)),
+		"packSEXP":        packSEXP(opts),
+		"packers":         packers(opts),
+		"vectorised":      vectorised(opts),
+		"anyVectorised":   anyVectorised(opts),
+		"vectorise":       vectorise(opts),
+		"contextCall":     contextCallGo,
+		"servedCall":      servedCallGo,
+		"async":           asynchronous(opts),
+		"anyAsync":        anyAsync(opts),
+		"asyncBody":       asyncBodyGo(opts),
+		"parallel":        parallel(opts),
+		"anyParallel":     anyParallel(opts),
+		"parallelBody":    parallelBodyGo(opts),
+		"packArg":         packArgGo,
+		"unpackResult":    unpackResultGo,
+		"dec":             func(i int) int { return i - 1 },
+		"base":            path.Base,
+	}).Parse(`{{$pkg := .Pkg}}{{$async := anyAsync .}}{{$parallel := anyParallel .}}{{$runtime := .NeedRuntime}}{{$interrupts := or .NeedContext $async $parallel $runtime}}{{$zeroCopy := zeroCopy}}{{$poison := eq $zeroCopy "poison"}}{{$unshare := unshares .}}{{$checked := anyChecked .}}// Code generated by rgnonomic/rgo; DO NOT EDIT.
 
 package main
 
@@ -37,62 +66,1951 @@ package main
 #define USE_RINTERNALS
 #include <R.h>
 #include <Rinternals.h>
-extern void R_error(char *s);
 
 // TODO(kortschak): Only emit these when needed.
 extern Rboolean Rf_isNull(SEXP s);
 extern _GoString_ R_gostring(SEXP x, R_xlen_t i);
-extern int getListElementIndex(SEXP list, const char *str);
-*/
+extern R_xlen_t getListElementIndex(SEXP list, const char *str);
+{{if .Unpackers.NeedConnection}}extern SEXP R_readBin(SEXP con, R_xlen_t n, int *failed);
+extern int R_writeBin(SEXP con, void *buf, R_xlen_t n);
+{{end}}{{if $interrupts}}extern int R_interrupted(void);
+{{end}}extern int R_redirect_output(const char *name);
+extern void R_write(char *buf, int n, int err);
+{{if $runtime}}extern int R_on_main(void);
+extern SEXP R_call(const char *pkg, const char *name, SEXP args, int *failed);
+{{end}}{{if $unshare}}extern int R_shared(SEXP x);
+{{end}}{{if $checked}}extern unsigned long long R_hash(SEXP x);
+{{if $async}}extern void R_mark_not_mutable(SEXP x);
+{{end}}{{end}}{{if $poison}}extern void *R_view(void *p, size_t n);
+extern void R_poison(void *v, size_t n);
+{{end}}*/
 import "C"
 
 import (
-	"fmt"
+{{if $interrupts}}	"context"
+{{end}}{{if errorConditions .}}	"errors"
+{{end}}	"fmt"
+	"log"
+	"math"
+	"os"
+{{if or $async $runtime}}	"reflect"
+{{end}}	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+{{if $interrupts}}	"time"
+{{end}}	"unicode/utf8"
 	"unsafe"
 
-{{with imports .}}{{range $p := .}}	"{{.}}"
-{{end}}
-{{end}}	"{{$pkg.Path}}"
-)
-{{$resultNeedsList := false}}{{range $func := .Funcs}}{{$params := varsOf $func.Signature.Params}}{{$results := varsOf $func.Signature.Results}}
-//export Wrapped_{{$func.Name}}
-func Wrapped_{{$func.Name}}({{go "_R_" $params}}) C.SEXP {
-	defer func() {
-		r := recover()
-		if r != nil {
-			err := C.CString(fmt.Sprint(r))
-			C.R_error(err)
-			C.free(unsafe.Pointer(err))
+{{with imports .}}{{range $p := .}}	"{{.}}"
+{{end}}
+{{end}}{{if errorConditions .}}{{with errorImports}}{{range $p := .}}	{{.}}
+{{end}}
+{{end}}{{end}}{{if $runtime}}	rgo "github.com/rgonomic/rgo/r"
+{{end}}	"{{$pkg.Path}}"
+)
+{{$resultNeedsList := false}}{{range $func := .Funcs}}{{$params := varsOf $func.Params}}{{$results := varsOf $func.Signature.Results}}{{$outputs := outputs $func}}{{$vector := vectorised $func}}
+//export Wrapped_{{$func.Name}}
+func Wrapped_{{$func.Name}}({{go "_R_" $params}}{{if $params}}, {{end}}{{if $func.Context}}_timeout C.SEXP, {{end}}_err *C.SEXP) C.SEXP {
+	{{if or $params $func.Context}}var _arg string
+	{{end}}defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, {{if or $params $func.Context}}_arg{{else}}""{{end}})
+		}
+	}()
+	{{if $runtime}}defer flushProgress()
+	defer saveRNG()
+	{{end}}defer redirectOutput()(){{if $poison}}
+	defer poisonViews(len(views)){{end}}{{if eq $zeroCopy "preserve"}}
+	defer releasePreserved(len(preserved)){{end}}{{if $unshare}}
+	defer unshareArgs({{sharesInputs $func}})(){{end}}
+
+	{{if $vector}}{{vectorise $func}}{{else}}{{range $i, $p := $params}}_arg = "{{$p.Name}}"
+	_p{{$i}} := unpackSEXP{{mangle $p.Type}}(_R_{{$p.Name}})
+	{{end}}{{if checked $func}}{{range $i, $p := $params}}{{if sharesMemory $p.Type}}_h{{$i}} := C.R_hash(_R_{{$p.Name}})
+	{{end}}{{end}}{{end}}{{if $func.Context}}{{contextCall $func $runtime}}{{else if $runtime}}{{servedCall $func}}{{else}}{{with $results}}{{anon . "_r" false}} := {{end}}{{$pkg.Name}}.{{$func.Name}}({{anon $params "_p" false}}{{if $func.Signature.Variadic}}...{{end}}){{end}}{{if checked $func}}{{range $i, $p := $params}}{{if sharesMemory $p.Type}}
+	checkUnmodified("{{$p.Name}}", _R_{{$p.Name}}, _h{{$i}}){{end}}{{end}}{{end}}
+	{{if commaOk $func}}if !_r{{dec (len $results)}} {
+		return C.R_NilValue
+	}
+	{{end}}{{if errorResult $func}}if _r{{dec (len $results)}} != nil {
+		*_err = goError(_r{{dec (len $results)}})
+		return C.R_NilValue
+	}
+	{{end}}{{with $outputs}}return packSEXP_{{$func.Name}}({{outArgs $func}}){{else}}return C.R_NilValue{{end}}{{end}}
+}
+
+{{if and $outputs (not $vector)}}func packSEXP_{{$func.Name}}({{anon $outputs "p" true}}) C.SEXP {
+{{$l := len $outputs -}}
+{{- if eq $l 1 -}}
+{{- $p := index $outputs 0}}	return packSEXP{{mangle $p.Type}}(p0)
+{{- else}}{{$resultNeedsList = true}}	r := C.Rf_allocVector(C.VECSXP, {{len $outputs}})
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, {{len $outputs}})
+	C.Rf_protect(names)
+{{range $i, $p := $outputs}}{{$res := printf "r%d" $i}}{{if and $p.Name (ne $p.Name "_")}}{{$res = $p.Name}}{{end}}	C.SET_STRING_ELT(names, {{$i}}, C.Rf_mkCharLenCE(C._GoStringPtr("{{$res}}"), {{len $res}}, C.CE_UTF8))
+	C.SET_VECTOR_ELT(r, {{$i}}, packSEXP{{mangle $p.Type}}(p{{$i}}))
+{{end}}	C.setAttrib(r, C.R_NamesSymbol, names)
+	C.Rf_unprotect(2)
+	return r{{end}}
+}
+{{end}}{{if async $func}}
+//export Wrapped_{{$func.Name}}_async
+func Wrapped_{{$func.Name}}_async({{go "_R_" $params}}{{if $params}}, {{end}}{{if $func.Context}}_timeout C.SEXP, {{end}}_err *C.SEXP) C.SEXP {
+	{{if or $params $func.Context}}var _arg string
+	{{end}}defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, {{if or $params $func.Context}}_arg{{else}}""{{end}})
+		}
+	}(){{if $poison}}
+	defer poisonViews(len(views)){{end}}{{if eq $zeroCopy "preserve"}}
+	defer releasePreserved(len(preserved)){{end}}{{if $unshare}}
+	defer unshareArgs({{sharesInputs $func}})(){{end}}
+
+	{{asyncBody $func}}
+}
+{{end}}{{if parallel $func}}
+//export Wrapped_{{$func.Name}}_map
+func Wrapped_{{$func.Name}}_map(_R_args, _R_workers C.SEXP, {{if $func.Context}}_timeout C.SEXP, {{end}}_err *C.SEXP) C.SEXP {
+	var _arg string
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, _arg)
+		}
+	}()
+	{{if $runtime}}defer flushProgress()
+	defer saveRNG()
+	{{end}}defer redirectOutput()(){{if $poison}}
+	defer poisonViews(len(views)){{end}}{{if eq $zeroCopy "preserve"}}
+	defer releasePreserved(len(preserved)){{end}}{{if $unshare}}
+	defer unshareArgs({{sharesInputs $func}})(){{end}}
+
+	{{parallelBody $func}}
+}
+{{end}}{{end}}
+{{/* TODO(kortschak): Hoist C.SEXP unpacking for basic types out to the C code. */ -}}
+{{- .Unpackers.Types | unpackSEXP -}}
+{{- packers . | packSEXP}}{{if .Unpackers.NeedConnection}}// connection is an io.ReadWriteCloser backed by an R connection.
+{{if $runtime}}// Reads and writes are run on the R main thread using the runtime
+// package, so it may be used from any goroutine while the wrapped call
+// is running.
+{{else}}// It must only be used from the goroutine that the wrapped function
+// is called on.
+{{end}}type connection struct {
+	con C.SEXP
+}
+
+// Read reads up to len(b) bytes from the connection using readBin.
+func (c connection) Read(b []byte) ({{if $runtime}}n {{end}}int, {{if $runtime}}err {{end}}error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	{{if $runtime}}doErr := rgo.Do(func() { n, err = c.read(b) })
+	if doErr != nil {
+		return 0, doErr
+	}
+	return n, err
+}
+
+// read reads up to len(b) bytes from the connection. It must be called
+// on the R main thread.
+func (c connection) read(b []byte) (int, error) {
+	{{end}}var failed C.int
+	r := C.R_readBin(c.con, C.R_xlen_t(len(b)), &failed)
+	if failed != 0 {
+		return 0, fmt.Errorf("failed to read from R connection")
+	}
+	n := int(C.Rf_xlength(r))
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return copy(b, (*[1 << 49]byte)(unsafe.Pointer(C.RAW(r)))[:n:n]), nil
+}
+
+// Write writes b to the connection using writeBin.
+func (c connection) Write(b []byte) ({{if $runtime}}n {{end}}int, {{if $runtime}}err {{end}}error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	{{if $runtime}}doErr := rgo.Do(func() { n, err = c.write(b) })
+	if doErr != nil {
+		return 0, doErr
+	}
+	return n, err
+}
+
+// write writes b to the connection. It must be called on the R main
+// thread.
+func (c connection) write(b []byte) (int, error) {
+	{{end}}if C.R_writeBin(c.con, unsafe.Pointer(&b[0]), C.R_xlen_t(len(b))) != 0 {
+		return 0, fmt.Errorf("failed to write to R connection")
+	}
+	return len(b), nil
+}
+
+// Close is a no-op. The R connection is closed by the R wrapper
+// function if it was opened there.
+func (c connection) Close() error { return nil }
+
+{{end}}{{if $interrupts}}// interruptPoll is the interval between checks for R user interrupts
+// while a function taking a context.Context is running.
+const interruptPoll = 100 * time.Millisecond
+
+// contextFor returns the context passed to a wrapped function. The
+// context is cancelled when the returned cancel function is called and,
+// if timeout is not NULL, after timeout seconds. Timeouts too long to be
+// held by a time.Duration never expire.
+func contextFor(timeout C.SEXP) (context.Context, context.CancelFunc) {
+	if C.Rf_isNull(timeout) != 0 {
+		return context.WithCancel(context.Background())
+	}
+	checkSEXP(timeout, C.REALSXP, 1)
+	s := float64(*C.REAL(timeout))
+	if s >= math.MaxInt64/float64(time.Second) {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(s*float64(time.Second)))
+}
+
+// callPanic is a value recovered from a panic in a wrapped function
+// that was called on a separate goroutine.
+type callPanic struct {
+	value interface{}
+	stack []byte // Stack trace of the panicking goroutine.
+}
+
+// interruptible calls f on a new goroutine and waits for it to return.
+// While waiting, the calling thread, which is the R thread, is polled
+// for R user interrupts and cancel is called when one is pending, and
+// redirected output is written to the R console. If cancel is nil, user
+// interrupts are left pending. Panics in f are re-raised as *callPanic
+// values.{{if $runtime}} Requests to run functions on the R thread made by
+// the runtime package are served while waiting.{{end}}
+func interruptible(cancel context.CancelFunc, f func()) {
+	done := make(chan *callPanic, 1)
+	go func() {
+		defer func() {
+			r := recover()
+			if r != nil {
+				done <- &callPanic{value: r, stack: debug.Stack()}
+			}
+			close(done)
+		}()
+		f()
+	}()
+	{{if $runtime}}pending, stop := rgo.Serve()
+	defer stop()
+	defer saveRNG()
+	{{end}}poll := time.NewTicker(interruptPoll)
+	defer poll.Stop()
+	for {
+		select {
+		case p := <-done:
+			if p != nil {
+				panic(p)
+			}
+			return
+		{{if $runtime}}case <-pending:
+			rgo.RunPending()
+		{{end}}case <-poll.C:
+			flushConsole(){{if $runtime}}
+			flushProgress(){{end}}
+			if cancel != nil && C.R_interrupted() != 0 {
+				cancel()
+			}
+		}
+	}
+}
+
+// interruptCondition returns a go_interrupt R condition for err, the
+// error of a cancelled context. The condition's reason field holds
+// the error message.
+func interruptCondition(err error) C.SEXP {
+	msg := "call interrupted"
+	if err == context.DeadlineExceeded {
+		msg = "call timed out"
+	}
+	return condition(msg, []string{"go_interrupt", "interrupt", "condition"}, "reason", []string{err.Error()})
+}
+
+{{end}}{{if $async}}// asyncCall is a call to a wrapped function that is running, or has
+// run, on its own goroutine.
+type asyncCall struct {
+	done      chan struct{}
+	cancel    context.CancelFunc
+	cancelled bool
+	pack      func(*C.SEXP) C.SEXP // Packs the results on the R thread.
+	keep      []C.SEXP             // Arguments checked for modification.
+}
+
+var (
+	asyncMu    sync.Mutex
+	asyncCalls = make(map[int32]*asyncCall)
+	asyncNext  int32
+)
+
+// startAsync calls f on a new goroutine and returns an R integer
+// identifying the call. The function returned by f packs the results
+// of the call and is called on the R thread when its value is requested.
+// cancel is called when f returns or the call is cancelled. The R values
+// in keep are protected and may not be modified by R code until the call
+// is released so that the packing function can check them for
+// modification.
+func startAsync(cancel context.CancelFunc, f func() func(*C.SEXP) C.SEXP, keep ...C.SEXP) C.SEXP {
+	for _, p := range keep {
+		C.R_PreserveObject(p){{if $checked}}
+		C.R_mark_not_mutable(p){{end}}
+	}
+	c := &asyncCall{done: make(chan struct{}), cancel: cancel, keep: keep}
+	asyncMu.Lock()
+	asyncNext++
+	id := asyncNext
+	asyncCalls[id] = c
+	asyncMu.Unlock()
+	go func() {
+		defer close(c.done)
+		defer cancel()
+		c.pack = callRecovering(f)
+	}()
+	return C.Rf_ScalarInteger(C.int(id))
+}
+
+// asyncFor returns the asynchronous call identified by the R integer id.
+func asyncFor(id C.SEXP) *asyncCall {
+	checkSEXP(id, C.INTSXP, 1)
+	asyncMu.Lock()
+	c, ok := asyncCalls[int32(*C.INTEGER(id))]
+	asyncMu.Unlock()
+	if !ok {
+		panic("unknown or released asynchronous call")
+	}
+	return c
+}
+
+//export Wrapped_asyncResolved
+func Wrapped_asyncResolved(id C.SEXP, _err *C.SEXP) C.SEXP {
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, "")
+		}
+	}()
+
+	select {
+	case <-asyncFor(id).done:
+		return C.Rf_ScalarLogical(1)
+	default:
+		return C.Rf_ScalarLogical(0)
+	}
+}
+
+//export Wrapped_asyncValue
+func Wrapped_asyncValue(id C.SEXP, _err *C.SEXP) C.SEXP {
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, "")
+		}
+	}()
+
+	c := asyncFor(id)
+	if c.cancelled {
+		*_err = interruptCondition(context.Canceled)
+		return C.R_NilValue
+	}
+	{{if $runtime}}pending, stop := rgo.Serve()
+	defer stop()
+	defer saveRNG()
+	{{end}}poll := time.NewTicker(interruptPoll)
+	defer poll.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-c.done:
+			waiting = false
+		{{if $runtime}}case <-pending:
+			rgo.RunPending()
+		{{end}}case <-poll.C:
+			{{if $runtime}}flushProgress()
+			{{end}}if C.R_interrupted() != 0 {
+				// Cancel the call so that it is not left running
+				// unobserved; later requests for its value report
+				// the interrupt.
+				c.cancelled = true
+				c.cancel()
+				*_err = interruptCondition(context.Canceled)
+				return C.R_NilValue
+			}
+		}
+	}
+	return c.pack(_err)
+}
+
+//export Wrapped_asyncCancel
+func Wrapped_asyncCancel(id C.SEXP, _err *C.SEXP) C.SEXP {
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, "")
+		}
+	}()
+
+	c := asyncFor(id)
+	c.cancelled = true
+	c.cancel()
+	return C.R_NilValue
+}
+
+//export Wrapped_asyncRelease
+func Wrapped_asyncRelease(id C.SEXP, _err *C.SEXP) C.SEXP {
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, "")
+		}
+	}()
+
+	c := asyncFor(id)
+	c.cancel()
+	for _, p := range c.keep {
+		C.R_ReleaseObject(p)
+	}
+	asyncMu.Lock()
+	delete(asyncCalls, int32(*C.INTEGER(id)))
+	asyncMu.Unlock()
+	return C.R_NilValue
+}
+
+// copyArg replaces the value pointed to by p with a deep copy. Arguments
+// of asynchronous calls are copied since they may share memory with R
+// vectors that are modified or collected while the call is running.
+func copyArg(p interface{}) {
+	v := reflect.ValueOf(p).Elem()
+	v.Set(deepCopy(v))
+}
+
+// deepCopy returns a copy of v that does not share memory with v. Only
+// exported struct fields are copied deeply.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		c := reflect.New(v.Type()).Elem()
+		c.SetString(string([]byte(v.String())))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		if v.Type().Elem().Kind() <= reflect.Complex128 {
+			reflect.Copy(c, v)
+			return c
+		}
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(deepCopy(iter.Key()), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+{{end}}{{if or $async $parallel}}// callRecovering calls f and returns the function it returns. If f
+// panics, the returned function re-raises the panic as a *callPanic
+// value when it is called.
+func callRecovering(f func() func(*C.SEXP) C.SEXP) (pack func(*C.SEXP) C.SEXP) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			p := &callPanic{value: r, stack: debug.Stack()}
+			pack = func(*C.SEXP) C.SEXP { panic(p) }
+		}
+	}()
+	return f()
+}
+
+{{end}}{{if $parallel}}// workersFor returns the number of goroutines used by a parallel apply
+// for the R value n. If n is NULL, GOMAXPROCS goroutines are used.
+func workersFor(n C.SEXP) int {
+	if C.Rf_isNull(n) != 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	checkSEXP(n, C.INTSXP, 1)
+	w := int(*C.INTEGER(n))
+	if w < 1 {
+		return 1
+	}
+	return w
+}
+
+// mapArgs returns element i of the list args of a parallel apply, which
+// is the list of the n arguments for a single call.
+func mapArgs(args C.SEXP, i, n int) C.SEXP {
+	a := C.VECTOR_ELT(args, C.R_xlen_t(i))
+	checkSEXP(a, C.VECSXP, n)
+	return a
+}
+
+// mapElement calls f for element i of the list r. If f panics, element
+// i of r is set to the R condition describing the failure. Type errors
+// are reported against the parameter named by arg.
+func mapElement(r C.SEXP, i int, arg *string, f func()) {
+	defer func() {
+		p := recover()
+		if p != nil {
+			C.SET_VECTOR_ELT(r, C.R_xlen_t(i), recovered(p, *arg))
+		}
+	}()
+	f()
+}
+
+// callParallel calls the non-nil functions in calls on at most workers
+// goroutines until ctx is done and returns the functions they return.
+// The returned functions pack the results of the calls on the R thread.
+func callParallel(ctx context.Context, calls []func() func(*C.SEXP) C.SEXP, workers int) []func(*C.SEXP) C.SEXP {
+	packs := make([]func(*C.SEXP) C.SEXP, len(calls))
+	if workers > len(calls) {
+		workers = len(calls)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				packs[i] = callRecovering(calls[i])
+			}
+		}()
+	}
+	for i, f := range calls {
+		if ctx.Err() != nil {
+			break
+		}
+		if f == nil {
+			continue
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+	return packs
+}
+
+// packElements sets the elements of the list r to the values returned
+// by the corresponding functions in packs, or to the R condition
+// describing the failure if the call or packing its results failed.
+// Elements without a packing function are left unaltered.
+func packElements(r C.SEXP, packs []func(*C.SEXP) C.SEXP) {
+	var arg string
+	for i, pack := range packs {
+		if pack == nil {
+			continue
+		}
+		mapElement(r, i, &arg, func() {
+			var err C.SEXP
+			v := pack(&err)
+			if err != nil {
+				v = err
+			}
+			C.SET_VECTOR_ELT(r, C.R_xlen_t(i), v)
+		})
+	}
+}
+
+{{end}}// outputOption is the R option controlling whether output written by Go
+// code to os.Stdout, os.Stderr and the standard logger is written to the
+// R console.
+var outputOption = C.CString("{{base $pkg.Path}}.redirect_output")
+
+// consoleSync is written to the redirection pipes by syncOutput to mark
+// the end of the output written before it. It is not written to the
+// console.
+const consoleSync = "\x00rgo:sync\x00"
+
+// console holds redirected output until it is written to the R console
+// on the R thread.
+var console struct {
+	mu       sync.Mutex
+	chunks []consoleChunk
+	calls  int // Number of running calls holding output for the R console.
+
+	tried          bool          // Whether installRedirect has been called.
+	stdout, stderr *os.File      // Original outputs of the process.
+	outW, errW     *os.File      // Write ends of the redirection pipes.
+	synced         chan struct{} // Receives when consoleSync is read.
+}
+
+// consoleChunk is a write to the standard output or standard error of
+// the process.
+type consoleChunk struct {
+	data   []byte
+	stderr bool
+}
+
+// redirectOutput arranges for output written by Go code to os.Stdout,
+// os.Stderr and the standard logger, which is also used by the default
+// log/slog logger, to be written to the R console unless the R option
+// named by outputOption is false. The outputs are replaced by pipes the
+// first time the option is not false and are never restored, so they are
+// not reassigned while other goroutines may be writing to them. Output is
+// only held for the R console until the returned function is called;
+// output written between calls, or while the option is false, is passed
+// through to the original outputs, so it does not accumulate while no
+// call is running. The returned function writes the output written before
+// it is called to the R console. Both must be called on the R thread.
+func redirectOutput() (flush func()) {
+	redirect := C.R_redirect_output(outputOption) != 0
+	if redirect && !console.tried {
+		installRedirect()
+	}
+	if !redirect || console.outW == nil {
+		return func() {}
+	}
+	console.mu.Lock()
+	console.calls++
+	console.mu.Unlock()
+	return func() {
+		syncOutput()
+		console.mu.Lock()
+		console.calls--
+		console.mu.Unlock()
+		flushConsole()
+	}
+}
+
+// installRedirect replaces os.Stdout, os.Stderr and the output of the
+// standard logger with pipes read by collect. The outputs are left
+// unchanged if the pipes cannot be made.
+func installRedirect() {
+	console.tried = true
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return
+	}
+	console.stdout, console.stderr = os.Stdout, os.Stderr
+	console.outW, console.errW = outW, errW
+	console.synced = make(chan struct{}, 2)
+	os.Stdout, os.Stderr = outW, errW
+	log.SetOutput(errW)
+	go collect(outR, false)
+	go collect(errR, true)
+}
+
+// syncOutput waits until the output written to the redirection pipes
+// before it was called has been collected.
+func syncOutput() {
+	var n int
+	for _, w := range []*os.File{console.outW, console.errW} {
+		_, err := w.WriteString(consoleSync)
+		if err == nil {
+			n++
+		}
+	}
+	for ; n > 0; n-- {
+		<-console.synced
+	}
+}
+
+// collect holds the output read from r for the R console and signals
+// console.synced each time consoleSync is read.
+func collect(r *os.File, stderr bool) {
+	defer r.Close()
+	buf := make([]byte, 4096)
+	var pending string
+	for {
+		n, err := r.Read(buf)
+		pending += string(buf[:n])
+		for {
+			i := strings.Index(pending, consoleSync)
+			if i < 0 {
+				break
+			}
+			hold(pending[:i], stderr)
+			pending = pending[i+len(consoleSync):]
+			console.synced <- struct{}{}
+		}
+		if err != nil {
+			hold(pending, stderr)
+			return
+		}
+		// Keep a partial consoleSync for the next read.
+		keep := 0
+		for k := len(consoleSync) - 1; k > 0; k-- {
+			if strings.HasSuffix(pending, consoleSync[:k]) {
+				keep = k
+				break
+			}
+		}
+		hold(pending[:len(pending)-keep], stderr)
+		pending = pending[len(pending)-keep:]
+	}
+}
+
+// hold holds data for writing to the R console, or writes it to the
+// original output of the process if no call is holding output.
+func hold(data string, stderr bool) {
+	if data == "" {
+		return
+	}
+	console.mu.Lock()
+	defer console.mu.Unlock()
+	if console.calls == 0 {
+		w := console.stdout
+		if stderr {
+			w = console.stderr
+		}
+		w.WriteString(data)
+		return
+	}
+	console.chunks = append(console.chunks, consoleChunk{data: []byte(data), stderr: stderr})
+}
+
+// flushConsole writes the redirected output held by console to the R
+// console. It must be called on the R thread.
+func flushConsole() {
+	console.mu.Lock()
+	chunks := console.chunks
+	console.chunks = nil
+	console.mu.Unlock()
+	for _, c := range chunks {
+		var stderr C.int
+		if c.stderr {
+			stderr = 1
+		}
+		C.R_write((*C.char)(unsafe.Pointer(&c.data[0])), C.int(len(c.data)), stderr)
+	}
+}
+{{if $runtime}}
+// flushProgress writes the most recent progress reported by the wrapped
+// package to the R console. It must be called on the R thread.
+func flushProgress() {
+	bar, ok := rgo.ProgressBar()
+	if !ok {
+		return
+	}
+	b := []byte(bar)
+	C.R_write((*C.char)(unsafe.Pointer(&b[0])), C.int(len(b)), 0)
+}
+
+//export Wrapped_conditions
+func Wrapped_conditions() C.SEXP {
+	conds := rgo.Conditions()
+	l := C.Rf_allocVector(C.VECSXP, C.R_xlen_t(len(conds)))
+	C.Rf_protect(l)
+	for i, c := range conds {
+		C.SET_VECTOR_ELT(l, C.R_xlen_t(i), queuedCondition(c))
+	}
+	C.Rf_unprotect(1)
+	return l
+}
+
+// queuedCondition returns a go_warning or go_message R condition for the
+// warning or message c queued by the wrapped package.
+func queuedCondition(c rgo.Condition) C.SEXP {
+	msg, class := c.Text, []string{"go_warning", "warning", "condition"}
+	if c.Kind == rgo.MessageCondition {
+		msg, class = msg+"\n", []string{"go_message", "message", "condition"}
+	}
+	r := C.Rf_allocVector(C.VECSXP, 2)
+	C.Rf_protect(r)
+	names := charVector([]string{"message", "call"})
+	C.Rf_protect(names)
+	C.SET_VECTOR_ELT(r, 0, charVector([]string{msg}))
+	C.setAttrib(r, C.R_NamesSymbol, names)
+	C.setAttrib(r, C.R_ClassSymbol, charVector(class))
+	C.Rf_unprotect(2)
+	return r
+}
+
+// evaluator evaluates R calls and looks up R options for the runtime
+// package.
+type evaluator struct{}
+
+// generator draws from R's random number generator for the runtime
+// package.
+type generator struct{}
+
+func init() {
+	rgo.SetEvaluator(evaluator{})
+	rgo.SetGenerator(generator{})
+}
+
+// rngLoaded is whether the state of R's random number generator has
+// been read by GetRNGstate since it was last saved.
+var rngLoaded bool
+
+// Uniform implements the rgo.Generator interface.
+func (generator) Uniform() float64 {
+	if !rngLoaded {
+		C.GetRNGstate()
+		rngLoaded = true
+	}
+	return float64(C.unif_rand())
+}
+
+// saveRNG writes the state of R's random number generator back to
+// .Random.seed if it has been read since it was last saved. It must be
+// called on the R thread when a wrapped call returns and before R code
+// that may use the generator is evaluated.
+func saveRNG() {
+	if rngLoaded {
+		C.PutRNGstate()
+		rngLoaded = false
+	}
+}
+
+// Call implements the rgo.Evaluator interface.
+func (evaluator) Call(dst interface{}, fn string, args []interface{}) (err error) {
+	if C.R_on_main() == 0 {
+		return rgo.ErrNotMainThread
+	}
+	saveRNG()
+	var protected C.int
+	defer func() {
+		C.Rf_unprotect(protected)
+		r := recover()
+		if r != nil {
+			err = evalError(r, fn)
+		}
+	}()
+
+	l := C.Rf_allocVector(C.VECSXP, C.R_xlen_t(len(args)))
+	C.Rf_protect(l)
+	protected++
+	for i, a := range args {
+		C.SET_VECTOR_ELT(l, C.R_xlen_t(i), packArg(a))
+	}
+	var cpkg *C.char
+	name := fn
+	if i := strings.Index(fn, "::"); i >= 0 {
+		cpkg = C.CString(fn[:i])
+		defer C.free(unsafe.Pointer(cpkg))
+		name = fn[i+len("::"):]
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var failed C.int
+	r := C.R_call(cpkg, cname, l, &failed)
+	if failed != 0 {
+		return &rgo.Error{Func: fn, Message: strings.TrimSpace(C.GoString(C.R_curErrorBuf()))}
+	}
+	C.Rf_protect(r)
+	protected++
+	unpackResult(dst, r)
+	ownResult(dst)
+	return nil
+}
+
+// OnMainThread implements the rgo.Evaluator interface.
+func (evaluator) OnMainThread() bool {
+	return C.R_on_main() != 0
+}
+
+// Option implements the rgo.Evaluator interface.
+func (evaluator) Option(dst interface{}, name string) (err error) {
+	if C.R_on_main() == 0 {
+		return rgo.ErrNotMainThread
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = evalError(r, name)
+		}
+	}()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	p := C.Rf_GetOption1(C.Rf_install(cname))
+	if C.Rf_isNull(p) != 0 {
+		return rgo.ErrNoOption
+	}
+	unpackResult(dst, p)
+	ownResult(dst)
+	return nil
+}
+
+// ownResult replaces the strings and slices held by the value pointed to
+// by dst with copies in Go memory. Unpacked values may refer to the memory
+// of R values that are no longer protected once Call or Option returns.
+func ownResult(dst interface{}) {
+	if dst == nil {
+		return
+	}
+	own(reflect.ValueOf(dst).Elem())
+}
+
+// own replaces the strings and slices in v with copies in Go memory.
+func own(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string([]byte(v.String())))
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		v.Set(c)
+		for i := 0; i < v.Len(); i++ {
+			own(v.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			own(v.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			k := reflect.New(v.Type().Key()).Elem()
+			k.Set(it.Key())
+			own(k)
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(it.Value())
+			own(e)
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			own(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				own(v.Field(i))
+			}
+		}
+	}
+}
+
+// evalError returns an error for the value r recovered from a panic while
+// packing the arguments or unpacking the result of the R call or option
+// name.
+func evalError(r interface{}, name string) error {
+	if err, ok := r.(*typeError); ok {
+		return fmt.Errorf("r: invalid value for %s: want %s, got %s", name, err.want, err.got)
+	}
+	return fmt.Errorf("r: %s: %v", name, r)
+}
+
+{{packers . | packArg}}{{.Unpackers.Types | unpackResult}}{{end}}
+//export Wrapped_runtimeSet
+func Wrapped_runtimeSet(maxprocs, gcPercent, memoryLimit C.SEXP, _err *C.SEXP) C.SEXP {
+	var _arg string
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, _arg)
+		}
+	}()
+
+	prev := runtimeSettings()
+	_arg = "maxprocs"
+	if C.Rf_isNull(maxprocs) == 0 {
+		checkSEXP(maxprocs, C.INTSXP, 1)
+		runtime.GOMAXPROCS(int(*C.INTEGER(maxprocs)))
+	}
+	_arg = "gc_percent"
+	if C.Rf_isNull(gcPercent) == 0 {
+		checkSEXP(gcPercent, C.INTSXP, 1)
+		debug.SetGCPercent(int(*C.INTEGER(gcPercent)))
+	}
+	_arg = "memory_limit"
+	if C.Rf_isNull(memoryLimit) == 0 {
+		checkSEXP(memoryLimit, C.REALSXP, 1)
+		limit := int64(math.MaxInt64)
+		if v := float64(*C.REAL(memoryLimit)); v < math.MaxInt64 {
+			limit = int64(v)
+		}
+		setMemoryLimit(limit)
+	}
+	return prev
+}
+
+//export Wrapped_runtimeStats
+func Wrapped_runtimeStats(_err *C.SEXP) C.SEXP {
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, "")
+		}
+	}()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return numericList([]namedValue{
+		{"goroutines", float64(runtime.NumGoroutine())},
+		{"maxprocs", float64(runtime.GOMAXPROCS(0))},
+		{"num_cpu", float64(runtime.NumCPU())},
+		{"cgo_calls", float64(runtime.NumCgoCall())},
+		{"sys", float64(m.Sys)},
+		{"total_alloc", float64(m.TotalAlloc)},
+		{"mallocs", float64(m.Mallocs)},
+		{"frees", float64(m.Frees)},
+		{"heap_alloc", float64(m.HeapAlloc)},
+		{"heap_sys", float64(m.HeapSys)},
+		{"heap_idle", float64(m.HeapIdle)},
+		{"heap_inuse", float64(m.HeapInuse)},
+		{"heap_released", float64(m.HeapReleased)},
+		{"heap_objects", float64(m.HeapObjects)},
+		{"stack_inuse", float64(m.StackInuse)},
+		{"next_gc", float64(m.NextGC)},
+		{"num_gc", float64(m.NumGC)},
+		{"num_forced_gc", float64(m.NumForcedGC)},
+		{"pause_total", float64(m.PauseTotalNs) / 1e9},
+		{"gc_cpu_fraction", m.GCCPUFraction},
+	})
+}
+
+//export Wrapped_runtimeGC
+func Wrapped_runtimeGC(_err *C.SEXP) C.SEXP {
+	defer func() {
+		r := recover()
+		if r != nil {
+			*_err = recovered(r, "")
+		}
+	}()
+
+	runtime.GC()
+	return C.R_NilValue
+}
+
+// runtimeSettings returns an R list holding the Go runtime settings that
+// can be changed by <pkg>_go_runtime_set. A memory limit of math.MaxInt64, the
+// default, is no limit and is returned as Inf.
+func runtimeSettings() C.SEXP {
+	limit := float64(memoryLimit())
+	if limit >= math.MaxInt64 {
+		limit = math.Inf(1)
+	}
+	return numericList([]namedValue{
+		{"maxprocs", float64(runtime.GOMAXPROCS(0))},
+		{"gc_percent", float64(gcPercent())},
+		{"memory_limit", limit},
+	})
+}
+
+// namedValue is a named element of an R list.
+type namedValue struct {
+	name  string
+	value float64
+}
+
+// numericList returns an R list of double scalars holding values.
+func numericList(values []namedValue) C.SEXP {
+	r := C.Rf_allocVector(C.VECSXP, C.R_xlen_t(len(values)))
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(values)))
+	C.Rf_protect(names)
+	for i, v := range values {
+		C.SET_STRING_ELT(names, C.R_xlen_t(i), C.Rf_mkCharLenCE(C._GoStringPtr(v.name), C.int(len(v.name)), C.CE_UTF8))
+		C.SET_VECTOR_ELT(r, C.R_xlen_t(i), C.Rf_ScalarReal(C.double(v.value)))
+	}
+	C.setAttrib(r, C.R_NamesSymbol, names)
+	C.Rf_unprotect(2)
+	return r
+}
+
+// recovered returns an R condition for the value r recovered from a
+// panic in a wrapped function. Type errors are reported against the
+// parameter named arg.
+func recovered(r interface{}, arg string) C.SEXP {
+	switch err := r.(type) {
+	case *typeError:
+		err.param = arg
+		return typeCondition(err)
+	case *overflowError:
+		return condition(err.Error(), []string{"go_overflow_error", "error", "condition"}, "value", []string{err.value})
+	case *stringError:
+		return condition(err.Error(), []string{"go_string_error", "error", "condition"}, "value", []string{err.value})
+{{if $checked}}	case *mutationError:
+		return condition(err.Error(), []string{"go_mutation_error", "error", "condition"}, "param", []string{err.param})
+{{end}}{{if $interrupts}}	case *callPanic:
+		return goPanic(err.value, err.stack)
+{{end}}	default:
+		return goPanic(r, debug.Stack())
+	}
+}
+
+// goPanic returns a go_panic R condition for the recovered value r
+// holding the stack trace of the panicking goroutine.
+func goPanic(r interface{}, stack []byte) C.SEXP {
+	return condition(fmt.Sprint(r), []string{"go_panic", "error", "condition"}, "stack", []string{string(stack)})
+}
+{{if errorConditions .}}
+// goError returns a go_error R condition for err. The condition's
+// chain field holds the messages of err and the errors it wraps.
+func goError(err error) C.SEXP {
+	var chain []string
+	for _, e := range errorTree(err) {
+		chain = append(chain, e.Error())
+	}
+	class := append(errorClasses(err), "go_error", "error", "condition")
+	return condition(err.Error(), class, "chain", chain)
+}
+
+// errorTree returns err and the errors it wraps in depth-first order.
+// Errors wrapping several errors with an Unwrap() []error method, such
+// as those returned by errors.Join, are followed into each wrapped error.
+func errorTree(err error) []error {
+	if err == nil {
+		return nil
+	}
+	tree := []error{err}
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range u.Unwrap() {
+			tree = append(tree, errorTree(e)...)
+		}
+		return tree
+	}
+	return append(tree, errorTree(errors.Unwrap(err))...)
+}
+
+{{errorClasses}}{{end}}
+// condition returns an R condition with the given message and classes,
+// and an additional character vector field.
+func condition(msg string, class []string, field string, val []string) C.SEXP {
+	c := C.Rf_allocVector(C.VECSXP, 3)
+	C.Rf_protect(c)
+	names := charVector([]string{"message", "call", field})
+	C.Rf_protect(names)
+	C.SET_VECTOR_ELT(c, 0, charVector([]string{msg}))
+	C.SET_VECTOR_ELT(c, 2, charVector(val))
+	C.setAttrib(c, C.R_NamesSymbol, names)
+	C.setAttrib(c, C.R_ClassSymbol, charVector(class))
+	C.Rf_unprotect(2)
+	return c
+}
+
+// charVector returns an R character vector holding the elements of s.
+func charVector(s []string) C.SEXP {
+	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(s)))
+	C.Rf_protect(r)
+	for i, v := range s {
+		v = toValidString(v)
+		C.SET_STRING_ELT(r, C.R_xlen_t(i), C.Rf_mkCharLenCE(C._GoStringPtr(v), C.int(len(v)), C.CE_UTF8))
+	}
+	C.Rf_unprotect(1)
+	return r
+}
+
+// typeError is the error reported when an R value passed to a wrapped
+// function does not have the R type, length or attributes required by
+// the corresponding parameter.
+type typeError struct {
+	param string // Name of the parameter.
+	want  string // Description of the required R value.
+	got   string // Description of the passed R value.
+}
+
+func (e *typeError) Error() string {
+	return fmt.Sprintf("invalid argument '%s': want %s, got %s", e.param, e.want, e.got)
+}
+
+// typeCondition returns a go_type_error R condition for err.
+func typeCondition(err *typeError) C.SEXP {
+	return condition(err.Error(), []string{"go_type_error", "error", "condition"}, "param", []string{err.param})
+}
+
+// sexpTypes holds the names of the R types used by rgo.
+var sexpTypes = map[C.int]string{
+	C.NILSXP:  "NULL",
+	C.LGLSXP:  "logical",
+	C.INTSXP:  "integer",
+	C.REALSXP: "double",
+	C.CPLXSXP: "complex",
+	C.STRSXP:  "character",
+	C.VECSXP:  "list",
+	C.RAWSXP:  "raw",
+}
+
+// describe returns a description of an R value of the given type and
+// length. A negative n describes a vector of any length.
+func describe(typ C.int, n int) string {
+	if typ == C.NILSXP {
+		return "NULL"
+	}
+	name, ok := sexpTypes[typ]
+	if !ok {
+		name = fmt.Sprintf("SEXP type %d", typ)
+	}
+	if typ != C.VECSXP {
+		name += " vector"
+	}
+	if n < 0 {
+		return name
+	}
+	return fmt.Sprintf("%s of length %d", name, n)
+}
+
+// checkSEXP panics with a *typeError if p is not an R vector of the given
+// type and length. A negative n matches any length.
+func checkSEXP(p C.SEXP, typ C.int, n int) {
+	got := C.TYPEOF(p)
+	l := int(C.Rf_xlength(p))
+	if got != typ || (n >= 0 && l != n) {
+		panic(&typeError{want: describe(typ, n), got: describe(got, l)})
+	}
+}
+
+// checkNames panics with a *typeError if the elements of the R vector p
+// are not named.
+func checkNames(p C.SEXP) {
+	n := C.Rf_xlength(p)
+	if n == 0 {
+		return
+	}
+	names := C.getAttrib(p, C.R_NamesSymbol)
+	if C.TYPEOF(names) != C.STRSXP || C.Rf_xlength(names) != n {
+		typ := C.TYPEOF(p)
+		panic(&typeError{want: "named " + describe(typ, -1), got: describe(typ, int(n)) + " without names"})
+	}
+}
+
+{{if ne $zeroCopy "share"}}// gostring returns a copy of the string at index i of the R character
+// vector x {{if $poison}}that is poisoned when the wrapped call returns{{else}}that may be retained by Go code{{end}}.
+func gostring(x C.SEXP, i C.R_xlen_t) string {
+	s := C.R_gostring(x, i)
+{{if $poison}}	if len(s) == 0 {
+		return ""
+	}
+	b := (*[1 << 49]byte)(viewOf(unsafe.Pointer(C._GoStringPtr(s)), len(s)))[:len(s):len(s)]
+	return *(*string)(unsafe.Pointer(&b))
+{{else}}	return string([]byte(s))
+{{end}}}
+
+{{end}}{{if eq $zeroCopy "preserve"}}// preserved holds the R vectors preserved while unpacking values for the
+// running wrapped calls because Go code may hold views of their memory.
+var preserved []C.SEXP
+
+// preserve protects the R vector p from collection until the wrapped call
+// returns.
+func preserve(p C.SEXP) {
+	C.R_PreserveObject(p)
+	preserved = append(preserved, p)
+}
+
+// releasePreserved releases the R vectors preserved after the first n.
+func releasePreserved(n int) {
+	for _, p := range preserved[n:] {
+		C.R_ReleaseObject(p)
+	}
+	preserved = preserved[:n]
+}
+
+{{end}}{{if $unshare}}// duplicates holds the duplicates of shared R vectors made while
+// unpacking values for the running wrapped calls.
+var duplicates []C.SEXP
+
+// sharedInPlace is whether shared R vectors are passed to the running
+// wrapped call without duplication.
+var sharedInPlace bool
+
+// unshareArgs sets whether shared R vectors are passed to the wrapped
+// call without duplication. It returns a function that releases the
+// duplicates made during the call and restores the previous setting.
+func unshareArgs(inPlace bool) (release func()) {
+	n, prev := len(duplicates), sharedInPlace
+	sharedInPlace = inPlace
+	return func() {
+		for _, d := range duplicates[n:] {
+			C.R_ReleaseObject(d)
+		}
+		duplicates = duplicates[:n]
+		sharedInPlace = prev
+	}
+}
+
+// unshared returns p, or a duplicate of p that is protected until the
+// wrapped call returns if p may be shared with other R values and the
+// call is not passed shared vectors, so that modifications made by Go
+// code are not seen by other R values.
+func unshared(p C.SEXP) C.SEXP {
+	if sharedInPlace || C.R_shared(p) == 0 {
+		return p
+	}
+	d := C.Rf_duplicate(p)
+	C.R_PreserveObject(d)
+	duplicates = append(duplicates, d)
+	return d
+}
+
+{{end}}{{if $checked}}// mutationError is the error reported when a function declared to be
+// read-only modifies an R vector passed to it.
+type mutationError struct {
+	param string // Name of the modified parameter.
+}
+
+func (e *mutationError) Error() string {
+	return fmt.Sprintf("read-only function modified parameter %s", e.param)
+}
+
+// checkUnmodified panics with a *mutationError if the contents of the R
+// value p passed as param no longer have the hash h.
+func checkUnmodified(param string, p C.SEXP, h C.ulonglong) {
+	if C.R_hash(p) != h {
+		panic(&mutationError{param: param})
+	}
+}
+
+{{end}}{{if $poison}}// view is a copy of R memory passed to Go code.
+type view struct {
+	p unsafe.Pointer
+	n C.size_t
+}
+
+// views holds the views made during the running wrapped calls.
+var views []view
+
+// viewOf returns a copy of the n bytes of R memory at p that is poisoned
+// by poisonViews when the wrapped call returns. Empty views are not copied.
+func viewOf(p unsafe.Pointer, n int) unsafe.Pointer {
+	if n == 0 {
+		return p
+	}
+	v := C.R_view(p, C.size_t(n))
+	if v == nil {
+		panic("failed to allocate view of R memory")
+	}
+	views = append(views, view{p: v, n: C.size_t(n)})
+	return v
+}
+
+// gostrings returns copies of the strings of the R character vector x
+// that are poisoned when the wrapped call returns. The strings share a
+// single view so that long vectors do not use a page for each element.
+func gostrings(x C.SEXP) []string {
+	s := make([]string, C.Rf_xlength(x))
+	size := 0
+	for i := range s {
+		s[i] = C.R_gostring(x, C.R_xlen_t(i))
+		size += len(s[i])
+	}
+	if size == 0 {
+		for i := range s {
+			s[i] = ""
+		}
+		return s
+	}
+	b := make([]byte, 0, size)
+	for _, e := range s {
+		b = append(b, e...)
+	}
+	v := (*[1 << 49]byte)(viewOf(unsafe.Pointer(&b[0]), size))[:size:size]
+	for i, e := range s {
+		if len(e) == 0 {
+			s[i] = ""
+			continue
+		}
+		w := v[:len(e):len(e)]
+		s[i] = *(*string)(unsafe.Pointer(&w))
+		v = v[len(e):]
+	}
+	return s
+}
+
+// poisonViews makes the views made after the first n inaccessible so that
+// Go code that uses them after the wrapped call has returned faults.
+func poisonViews(n int) {
+	for _, v := range views[n:] {
+		C.R_poison(v.p, v.n)
+	}
+	views = views[:n]
+}
+
+{{end}}// checkRange panics with a *typeError if the R integer v is not within
+// [min, max]. The R integer NA value is never within range.
+func checkRange(v, min, max int32) {
+	if v < min || max < v {
+		got := fmt.Sprint("value ", v)
+		if v == math.MinInt32 {
+			got = "NA"
+		}
+		panic(&typeError{want: fmt.Sprintf("integer values in [%d, %d]", min, max), got: got})
+	}
+}
+
+// checkDim panics with a *typeError if the R array p does not have the
+// given dimensions.
+func checkDim(p C.SEXP, dims ...int) {
+	want := fmt.Sprintf("array with dim %v", dims)
+	dim := C.getAttrib(p, C.R_DimSymbol)
+	if C.TYPEOF(dim) != C.INTSXP {
+		panic(&typeError{want: want, got: describe(C.TYPEOF(p), int(C.Rf_xlength(p))) + " without dim"})
+	}
+	n := int(C.Rf_xlength(dim))
+	got := (*[1 << 47]int32)(unsafe.Pointer(C.INTEGER(dim)))[:n:n]
+	ok := n == len(dims)
+	for i := 0; ok && i < n; i++ {
+		ok = int(got[i]) == dims[i]
+	}
+	if !ok {
+		panic(&typeError{want: want, got: fmt.Sprintf("array with dim %v", got)})
+	}
+}
+
+// overflowError is the error reported when a Go integer result cannot
+// be represented as an R integer.
+type overflowError struct {
+	value string // Value of the Go integer.
+}
+
+func (e *overflowError) Error() string {
+	return fmt.Sprintf("integer result %s out of range for R integer", e.value)
+}
+
+// fitsInt returns whether v can be represented as an R integer.
+func fitsInt(v int64) bool {
+	return math.MinInt32 < v && v <= math.MaxInt32
+}
+
+// fitsUint returns whether v can be represented as an R integer.
+func fitsUint(v uint64) bool {
+	return v <= math.MaxInt32
+}
+
+// checkInt panics with an *overflowError if v cannot be represented
+// as an R integer.
+func checkInt(v int64) {
+	if !fitsInt(v) {
+		panic(&overflowError{value: fmt.Sprint(v)})
+	}
+}
+
+// checkUint panics with an *overflowError if v cannot be represented
+// as an R integer.
+func checkUint(v uint64) {
+	if !fitsUint(v) {
+		panic(&overflowError{value: fmt.Sprint(v)})
+	}
+}
+
+// stringError is the error reported when a Go string result cannot be
+// held in an R character vector.
+type stringError struct {
+	value  string // Quoted value of the Go string.
+	reason string // Why the string cannot be held.
+}
+
+func (e *stringError) Error() string {
+	return fmt.Sprintf("string result %s %s", e.value, e.reason)
+}
+
+// validString returns whether s can be held in an R character vector.
+// It must be valid UTF-8, must not hold NUL bytes and must be no longer
+// than the maximum R string length.
+func validString(s string) bool {
+	return len(s) <= math.MaxInt32 && utf8.ValidString(s) && strings.IndexByte(s, 0) < 0
+}
+
+// toValidString returns s with NUL bytes and invalid UTF-8 replaced
+// by U+FFFD.
+func toValidString(s string) string {
+	if validString(s) {
+		return s
+	}
+	return strings.ToValidUTF8(strings.ReplaceAll(s, "\x00", "\uFFFD"), "\uFFFD")
+}
+
+// mkChar returns an R CHARSXP holding s. {{if eq invalidString "error" -}}
+It panics with a *stringError
+// if s cannot be held in an R character vector.
+{{- else -}}
+NUL bytes and invalid UTF-8
+// in s are replaced by U+FFFD. It panics with a *stringError if s is
+// longer than the maximum R string length.
+{{- end}}
+func mkChar(s string) C.SEXP {
+	if len(s) > math.MaxInt32 {
+		panic(&stringError{value: fmt.Sprintf("%q...", s[:32]), reason: "is longer than 2^31-1 bytes"})
+	}
+{{- if eq invalidString "error"}}
+	if !validString(s) {
+		panic(&stringError{value: fmt.Sprintf("%q", s), reason: "is not valid UTF-8 or holds a NUL byte"})
+	}
+{{- else}}
+	s = toValidString(s)
+{{- end}}
+	return C.Rf_mkCharLenCE(C._GoStringPtr(s), C.int(len(s)), C.CE_UTF8)
+}
+
+// rawVector returns an R raw vector holding the bytes of s.
+func rawVector(s string) C.SEXP {
+	r := C.Rf_allocVector(C.RAWSXP, C.R_xlen_t(len(s)))
+	C.Rf_protect(r)
+	copy((*[1 << 49]byte)(unsafe.Pointer(C.RAW(r)))[:len(s):len(s)], s)
+	C.Rf_unprotect(1)
+	return r
+}
+{{if anyVectorised .}}
+// naInt is the R integer and logical NA value.
+const naInt = math.MinInt32
+
+// naReal is the R double NA value.
+var naReal = math.Float64frombits(0x7ff00000000007a2)
+
+// isNA returns whether v is the R double NA value. NaN values that
+// are not NA are not matched.
+func isNA(v float64) bool {
+	return math.IsNaN(v) && uint32(math.Float64bits(v)) == 1954
+}
+
+// recycledLength returns the length of the result of a vectorised call
+// with arguments of the given lengths following R's recycling rules.
+func recycledLength(lengths ...int) int {
+	var n int
+	for _, l := range lengths {
+		if l == 0 {
+			return 0
+		}
+		if l > n {
+			n = l
+		}
+	}
+	return n
+}
+
+// setNA sets the elements of the R vector r marked in na to NA and
+// returns r.
+func setNA(r C.SEXP, na []bool) C.SEXP {
+	for i, isNA := range na {
+		if !isNA {
+			continue
+		}
+		switch C.TYPEOF(r) {
+		case C.LGLSXP:
+			(*[1 << 47]int32)(unsafe.Pointer(C.LOGICAL(r)))[i] = naInt
+		case C.INTSXP:
+			(*[1 << 47]int32)(unsafe.Pointer(C.INTEGER(r)))[i] = naInt
+		case C.REALSXP:
+			(*[1 << 46]float64)(unsafe.Pointer(C.REAL(r)))[i] = naReal
+		case C.CPLXSXP:
+			(*[1 << 45]complex128)(unsafe.Pointer(C.COMPLEX(r)))[i] = complex(naReal, naReal)
+		case C.STRSXP:
+			C.SET_STRING_ELT(r, C.R_xlen_t(i), C.R_NaString)
+		case C.VECSXP:
+			C.SET_VECTOR_ELT(r, C.R_xlen_t(i), C.ScalarString(C.R_NaString))
+		}
+	}
+	return r
+}
+{{end}}
+func main() {}
+`))
+}
+
+// anyVectorised returns a closure that reports whether any of the functions
+// in a package is vectorised.
+func anyVectorised(opts Options) func(*pkg.Info) (bool, error) {
+	isVectorised := vectorised(opts)
+	return func(info *pkg.Info) (bool, error) {
+		for _, fn := range info.Funcs {
+			ok, err := isVectorised(fn)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// packers returns a closure that returns the types that need packers in
+// the generated code for a package. These are the packers found during
+// analysis and the slices holding the results of vectorised functions.
+func packers(opts Options) func(*pkg.Info) ([]types.Type, error) {
+	isVectorised := vectorised(opts)
+	return func(info *pkg.Info) ([]types.Type, error) {
+		typs := info.Packers.Types()
+		seen := make(map[string]bool)
+		for _, typ := range typs {
+			seen[typ.String()] = true
+		}
+		for _, fn := range info.Funcs {
+			ok, err := isVectorised(fn)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			typ := vectorType(fn.Signature().Results().At(0).Type())
+			if !seen[typ.String()] {
+				seen[typ.String()] = true
+				typs = append(typs, typ)
+			}
+		}
+		sort.Slice(typs, func(i, j int) bool { return pkg.Mangle(typs[i]) < pkg.Mangle(typs[j]) })
+		return typs, nil
+	}
+}
+
+// vectorise returns a closure that returns the body of the wrapper of a
+// vectorised function using the unpacking policy specified by opts.
+func vectorise(opts Options) func(pkg.FuncInfo) (string, error) {
+	return func(fn pkg.FuncInfo) (string, error) {
+		policy, err := unpackPolicyFor(opts)
+		if err != nil {
+			return "", err
 		}
-	}()
+		return vectorisedBodyGo(fn, policy), nil
+	}
+}
+
+// vectorisedBodyGo returns the body of the wrapper of the vectorised function
+// fn. The function is called for each element of its recycled arguments and
+// its results are packed into an R vector that is NA where any argument is NA.
+// String arguments are unpacked according to the given policy.
+func vectorisedBodyGo(fn pkg.FuncInfo, policy unpackPolicy) string {
+	var buf bytes.Buffer
+	params := varsOf(fn.Signature().Params())
+	lengths := make([]string, len(params))
+	for i, p := range params {
+		v := vectorOf(vectorKind(p.Type().Underlying().(*types.Basic).Kind()))
+		fmt.Fprintf(&buf, "\t_arg = %q\n\tcheckSEXP(_R_%s, C.%s, -1)\n\t_l%d := int(C.Rf_xlength(_R_%[2]s))\n", p.Name(), p.Name(), v.sexptype, i)
+		switch {
+		case v.sexptype != "STRSXP":
+			fmt.Fprintf(&buf, "\t_x%[1]d := (*[%[2]d]%[3]s)(unsafe.Pointer(C.%[4]s(_R_%[5]s)))[:_l%[1]d:_l%[1]d]\n", i, v.max, v.elem, v.accessor, p.Name())
+		case policy.zeroCopy == "poison":
+			fmt.Fprintf(&buf, "\t_s%d := gostrings(_R_%s)\n", i, p.Name())
+		}
+		lengths[i] = fmt.Sprintf("_l%d", i)
+	}
 
-	{{range $i, $p := $params}}_p{{$i}} := unpackSEXP{{mangle $p.Type}}(_R_{{$p.Name}})
-	{{end}}{{with $results}}{{anon . "_r" false}} := {{end}}{{$pkg.Name}}.{{$func.Name}}({{anon $params "_p" false}}{{if $func.Signature.Variadic}}...{{end}})
-	{{with $results}}return packSEXP_{{$func.Name}}({{anon . "_r" false}}){{else}}return C.R_NilValue{{end}}
+	res := vectorType(fn.Signature().Results().At(0).Type())
+	fmt.Fprintf(&buf, "\t_n := recycledLength(%s)\n\t_r := make(%s, _n)\n\t_na := make([]bool, _n)\n\tfor _i := range _r {\n", strings.Join(lengths, ", "), res)
+	var (
+		na     []string
+		checks strings.Builder
+		args   = make([]string, len(params))
+	)
+	for i, p := range params {
+		kind := p.Type().Underlying().(*types.Basic).Kind()
+		typ := nameOf(p.Type())
+		if kind == types.String {
+			fmt.Fprintf(&buf, "\t\t_e%d := C.STRING_ELT(_R_%s, C.R_xlen_t(_i%%_l%[1]d))\n", i, p.Name())
+			na = append(na, fmt.Sprintf("_e%d == C.R_NaString", i))
+			if policy.zeroCopy == "poison" {
+				args[i] = fmt.Sprintf("%s(_s%d[_i%%_l%[2]d])", typ, i)
+			} else {
+				args[i] = fmt.Sprintf("%s(%s(_R_%s, C.R_xlen_t(_i%%_l%d)))", typ, policy.gostring(), p.Name(), i)
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "\t\t_e%d := _x%[1]d[_i%%_l%[1]d]\n", i)
+		switch kind {
+		case types.Float32, types.Float64:
+			na = append(na, fmt.Sprintf("isNA(_e%d)", i))
+			args[i] = fmt.Sprintf("%s(_e%d)", typ, i)
+		case types.Complex64, types.Complex128:
+			na = append(na, fmt.Sprintf("isNA(real(_e%[1]d)) || isNA(imag(_e%[1]d))", i))
+			args[i] = fmt.Sprintf("%s(_e%d)", typ, i)
+		case types.Bool:
+			na = append(na, fmt.Sprintf("_e%d == naInt", i))
+			args[i] = fmt.Sprintf("%s(_e%d == 1)", typ, i)
+		default:
+			na = append(na, fmt.Sprintf("_e%d == naInt", i))
+			args[i] = fmt.Sprintf("%s(_e%d)", typ, i)
+			if check := rangeCheck(fmt.Sprintf("_e%d", i), kind, 2); check != "" {
+				fmt.Fprintf(&checks, "\t\t_arg = %q\n%s", p.Name(), check)
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "\t\tif %s {\n\t\t\t_na[_i] = true\n\t\t\tcontinue\n\t\t}\n%s", strings.Join(na, " || "), checks.String())
+	fmt.Fprintf(&buf, "\t\t_r[_i] = %s(%s.%s(%s))\n\t}\n", res.(*types.Slice).Elem(), fn.Func.Pkg().Name(), fn.Func.Name(), strings.Join(args, ", "))
+	fmt.Fprintf(&buf, "\treturn setNA(packSEXP%s(_r), _na)", pkg.Mangle(res))
+	return strings.TrimPrefix(buf.String(), "\t")
 }
 
-{{if $results}}func packSEXP_{{$func.Name}}({{anon $results "p" true}}) C.SEXP {
-{{$l := len $results -}}
-{{- if eq $l 1 -}}
-{{- $p := index $results 0}}	return packSEXP{{mangle $p.Type}}({{if $p.Name}}{{$p.Name}}{{else}}p0{{end -}})
-{{- else}}{{$resultNeedsList = true}}	r := C.allocList({{len $results}})
-	C.Rf_protect(r)
-	names := C.Rf_allocVector(C.STRSXP, {{len $results}})
-	C.Rf_protect(names)
-	arg := r
-{{range $i, $p := $results}}{{$res := printf "r%d" $i}}{{if $p.Name}}{{$res = $p.Name}}{{end}}	C.SET_STRING_ELT(names, {{$i}}, C.Rf_mkCharLenCE(C._GoStringPtr("{{$res}}"), {{len $res}}, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP{{mangle $p.Type}}({{if $p.Name}}{{$p.Name}}{{else}}p{{$i}}{{end}}))
-{{if lt $i (dec $l)}}	arg = C.CDR(arg)
-{{end -}}
-{{- end}}	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
-	C.Rf_unprotect(2)
-	return r{{end}}
+// contextCallGo returns the code calling the function fn that takes a
+// context.Context. The context is cancelled by an R user interrupt or
+// after the timeout passed from R, and cancellation is signalled to R
+// as a go_interrupt condition. Unless served is true, functions with
+// connection parameters are called on the R thread since connections use
+// the R API, so for these only the timeout applies.
+func contextCallGo(fn pkg.FuncInfo, served bool) string {
+	var buf strings.Builder
+	buf.WriteString("_arg = \".timeout\"\n\t_ctx, _cancel := contextFor(_timeout)\n\tdefer _cancel()\n")
+	buf.WriteString(interruptibleCallGo(fn, "_ctx", "_cancel", served))
+	buf.WriteString("\tif _ctx.Err() != nil {\n\t\t*_err = interruptCondition(_ctx.Err())\n\t\treturn C.R_NilValue\n\t}")
+	return buf.String()
 }
-{{end}}{{end}}
-{{/* TODO(kortschak): Hoist C.SEXP unpacking for basic types out to the C code. */ -}}
-{{- .Unpackers.Types | unpackSEXP -}}
-{{- .Packers.Types | packSEXP}}func main() {}
-`))
+
+// servedCallGo returns the code calling the function fn in a package that
+// uses the runtime package. The function is called on a new goroutine so
+// that the R thread can serve requests made by the runtime package while
+// it waits, including the reads and writes of connection parameters. R
+// user interrupts are left pending.
+func servedCallGo(fn pkg.FuncInfo) string {
+	return strings.TrimSuffix(strings.TrimPrefix(interruptibleCallGo(fn, "", "nil", true), "\t"), "\n")
+}
+
+// interruptibleCallGo returns the declaration of the results of fn and
+// a call of fn passed to interruptible with the given cancel function.
+// The call is passed ctx, if it is not empty, and any random source,
+// followed by the unpacked parameters. Unless served is true, when
+// connections are used through the runtime package, functions with
+// connection parameters are called directly since connections use the
+// R API.
+func interruptibleCallGo(fn pkg.FuncInfo, ctx, cancel string, served bool) string {
+	var buf strings.Builder
+	results := varsOf(fn.Signature().Results())
+	if len(results) != 0 {
+		buf.WriteString("\tvar (\n")
+		for i, v := range results {
+			fmt.Fprintf(&buf, "\t\t_r%d %s\n", i, nameOf(v.Type()))
+		}
+		buf.WriteString("\t)\n")
+	}
+
+	params := varsOf(fn.Params())
+	var args []string
+	if ctx != "" {
+		args = append(args, ctx)
+	}
+	if v := fn.Rand(); v != nil {
+		args = append(args, randArgGo(v))
+	}
+	var onThread bool
+	for i, v := range params {
+		args = append(args, fmt.Sprintf("_p%d", i))
+		onThread = onThread || pkg.IsConnection(v.Type())
+	}
+	var variadic string
+	if fn.Signature().Variadic() {
+		variadic = "..."
+	}
+	call := fmt.Sprintf("%s.%s(%s%s)", fn.Func.Pkg().Name(), fn.Func.Name(), strings.Join(args, ", "), variadic)
+	if len(results) != 0 {
+		call = anonymous(results, "_r", false) + " = " + call
+	}
+	if onThread && !served {
+		fmt.Fprintf(&buf, "\t%s\n", call)
+	} else {
+		fmt.Fprintf(&buf, "\tinterruptible(%s, func() {\n\t\t%s\n\t})\n", cancel, call)
+	}
+	return buf.String()
+}
+
+// asyncBodyGo returns a closure that returns the body of the wrapper of the
+// asynchronous variant of the function fn. The arguments are unpacked and
+// copied on the R thread, and the call is started on a new goroutine. The
+// results are packed on the R thread when the value of the call is requested,
+// when arguments of checked functions are also checked for modification.
+func asyncBodyGo(opts Options) func(pkg.FuncInfo) string {
+	deferredCall := deferredCallGo(opts)
+	isChecked := checksMutation(opts)
+	return func(fn pkg.FuncInfo) string {
+		var buf strings.Builder
+		params := varsOf(fn.Params())
+		sexps := make([]string, len(params))
+		checked, _ := isChecked(fn)
+		var keep []string
+		for i, p := range params {
+			sexps[i] = "_R_" + p.Name()
+			fmt.Fprintf(&buf, "_arg = %q\n\t_p%d := unpackSEXP%s(_R_%[1]s)\n\tcopyArg(&_p%[2]d)\n\t", p.Name(), i, pkg.Mangle(p.Type()))
+			if checked && sharesMemory(p.Type()) {
+				fmt.Fprintf(&buf, "_h%d := C.R_hash(_R_%s)\n\t", i, p.Name())
+				keep = append(keep, sexps[i])
+			}
+		}
+		cancel := "func() {}"
+		if fn.Context() != nil {
+			buf.WriteString("_arg = \".timeout\"\n\t_ctx, _cancel := contextFor(_timeout)\n\t")
+			cancel = "_cancel"
+		}
+		fmt.Fprintf(&buf, "return startAsync(%s, %s", cancel, deferredCall(fn, fn.Context() != nil, sexps, "\t"))
+		for _, k := range keep {
+			fmt.Fprintf(&buf, ", %s", k)
+		}
+		buf.WriteString(")")
+		return buf.String()
+	}
+}
+
+// parallelBodyGo returns a closure that returns the body of the wrapper of
+// the parallel apply variant of the function fn. The arguments for each
+// call are unpacked on the R thread and the calls are made concurrently.
+// The results are packed, and arguments of checked functions are checked
+// for modification, on the R thread when all the calls have returned.
+// Failures to unpack arguments or pack results, modification of arguments,
+// and errors and panics in calls, are stored as R conditions in the
+// corresponding list elements.
+func parallelBodyGo(opts Options) func(pkg.FuncInfo) string {
+	deferredCall := deferredCallGo(opts)
+	isChecked := checksMutation(opts)
+	return func(fn pkg.FuncInfo) string {
+		var buf strings.Builder
+		buf.WriteString("_arg = \"args\"\n\tcheckSEXP(_R_args, C.VECSXP, -1)\n\t_arg = \".workers\"\n\t_workers := workersFor(_R_workers)\n\t")
+		if fn.Context() != nil {
+			buf.WriteString("_arg = \".timeout\"\n\t_ctx, _cancel := contextFor(_timeout)\n\t")
+		} else {
+			buf.WriteString("_ctx, _cancel := context.WithCancel(context.Background())\n\t")
+		}
+		buf.WriteString(`defer _cancel()
+	_res := C.Rf_allocVector(C.VECSXP, C.Rf_xlength(_R_args))
+	C.Rf_protect(_res)
+	defer C.Rf_unprotect(1)
+	_calls := make([]func() func(*C.SEXP) C.SEXP, C.Rf_xlength(_R_args))
+	for _i := range _calls {
+		mapElement(_res, _i, &_arg, func() {
+			_arg = "args"
+			`)
+		params := varsOf(fn.Params())
+		if len(params) != 0 {
+			buf.WriteString("_args := ")
+		}
+		fmt.Fprintf(&buf, "mapArgs(_R_args, _i, %d)\n\t\t\t", len(params))
+		sexps := make([]string, len(params))
+		checked, _ := isChecked(fn)
+		for i, p := range params {
+			sexps[i] = fmt.Sprintf("C.VECTOR_ELT(_args, %d)", i)
+			fmt.Fprintf(&buf, "_arg = %q\n\t\t\t_p%d := unpackSEXP%s(%s)\n\t\t\t", p.Name(), i, pkg.Mangle(p.Type()), sexps[i])
+			if checked && sharesMemory(p.Type()) {
+				fmt.Fprintf(&buf, "_h%d := C.R_hash(%s)\n\t\t\t", i, sexps[i])
+			}
+		}
+		fmt.Fprintf(&buf, "_calls[_i] = %s\n", deferredCall(fn, false, sexps, "\t\t\t"))
+		buf.WriteString(`		})
+	}
+	var _packs []func(*C.SEXP) C.SEXP
+	interruptible(_cancel, func() {
+		_packs = callParallel(_ctx, _calls, _workers)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}
+	packElements(_res, _packs)
+	return _res`)
+		return buf.String()
+	}
+}
+
+// randArgGo returns the expression supplying the random source parameter
+// v, which draws from R's random number generator using the runtime
+// package.
+func randArgGo(v *types.Var) string {
+	if _, ok := v.Type().(*types.Pointer); ok {
+		return "rgo.NewRand()"
+	}
+	return "rgo.Source{}"
+}
+
+// deferredCallGo returns a closure that returns a function literal that
+// calls the function fn with the unpacked arguments and returns a function
+// that packs the results of the call on the R thread. If checkCtx is true,
+// the packing function signals an interrupt condition if _ctx was cancelled
+// when the call returned. If fn is checked for modification of its
+// arguments, the packing function checks the R values in sexps, which hold
+// the arguments, against the hashes taken before the call. The literal is
+// indented by indent.
+func deferredCallGo(opts Options) func(fn pkg.FuncInfo, checkCtx bool, sexps []string, indent string) string {
+	isChecked := checksMutation(opts)
+	isCommaOk := commaOk(opts)
+	isErrorResult := errorResult(opts)
+	outputs := outputs(opts)
+	outArgs := outArgs(opts)
+	return func(fn pkg.FuncInfo, checkCtx bool, sexps []string, indent string) string {
+		var buf strings.Builder
+		params := varsOf(fn.Params())
+		var args []string
+		if fn.Context() != nil {
+			args = append(args, "_ctx")
+		}
+		if v := fn.Rand(); v != nil {
+			args = append(args, randArgGo(v))
+		}
+		for i := range params {
+			args = append(args, fmt.Sprintf("_p%d", i))
+		}
+		var variadic string
+		if fn.Signature().Variadic() {
+			variadic = "..."
+		}
+		buf.WriteString("func() func(*C.SEXP) C.SEXP {\n")
+		in := indent + "\t"
+		buf.WriteString(in)
+		results := varsOf(fn.Signature().Results())
+		if len(results) != 0 {
+			fmt.Fprintf(&buf, "%s := ", anonymous(results, "_r", false))
+		}
+		fmt.Fprintf(&buf, "%s.%s(%s%s)\n", fn.Func.Pkg().Name(), fn.Func.Name(), strings.Join(args, ", "), variadic)
+		if checkCtx {
+			fmt.Fprintf(&buf, "%s_ctxErr := _ctx.Err()\n", in)
+		}
+		fmt.Fprintf(&buf, "%sreturn func(_err *C.SEXP) C.SEXP {\n", in)
+		if checkCtx {
+			fmt.Fprintf(&buf, "%[1]s\tif _ctxErr != nil {\n%[1]s\t\t*_err = interruptCondition(_ctxErr)\n%[1]s\t\treturn C.R_NilValue\n%[1]s\t}\n", in)
+		}
+		if checked, _ := isChecked(fn); checked {
+			for i, p := range params {
+				if sharesMemory(p.Type()) {
+					fmt.Fprintf(&buf, "%s\tcheckUnmodified(%q, %s, _h%d)\n", in, p.Name(), sexps[i], i)
+				}
+			}
+		}
+		last := len(results) - 1
+		if isCommaOk(fn) {
+			fmt.Fprintf(&buf, "%[1]s\tif !_r%[2]d {\n%[1]s\t\treturn C.R_NilValue\n%[1]s\t}\n", in, last)
+		}
+		if isErrorResult(fn) {
+			fmt.Fprintf(&buf, "%[1]s\tif _r%[2]d != nil {\n%[1]s\t\t*_err = goError(_r%[2]d)\n%[1]s\t\treturn C.R_NilValue\n%[1]s\t}\n", in, last)
+		}
+		if len(outputs(fn)) != 0 {
+			fmt.Fprintf(&buf, "%s\treturn packSEXP_%s(%s)\n", in, fn.Func.Name(), outArgs(fn))
+		} else {
+			fmt.Fprintf(&buf, "%s\treturn C.R_NilValue\n", in)
+		}
+		fmt.Fprintf(&buf, "%s}\n%s}", in, indent)
+		return buf.String()
+	}
 }
 
 // goParams returns a comma-separated list of C.SEXP parameters using the
@@ -124,17 +2042,200 @@ func anonymous(vars []*types.Var, prefix string, typed bool) string {
 		if i != 0 {
 			buf.WriteString(", ")
 		}
-		if !typed {
-			buf.WriteString(fmt.Sprintf("%s%d", prefix, i))
+		fmt.Fprintf(&buf, "%s%d", prefix, i)
+		if typed {
+			fmt.Fprintf(&buf, " %s", nameOf(v.Type()))
+		}
+	}
+	return buf.String()
+}
+
+// outArgs returns a closure that returns a comma-separated list of the
+// arguments to the output packing function of a function. These are the
+// function's results, excluding any comma-ok or signalled error result,
+// followed by its unpacked in-out parameters.
+func outArgs(opts Options) func(pkg.FuncInfo) string {
+	isCommaOk := commaOk(opts)
+	isErrorResult := errorResult(opts)
+	return func(fn pkg.FuncInfo) string {
+		results := varsOf(fn.Signature().Results())
+		if isCommaOk(fn) || isErrorResult(fn) {
+			results = results[:len(results)-1]
+		}
+		var buf strings.Builder
+		buf.WriteString(anonymous(results, "_r", false))
+		params := fn.Params()
+		for _, v := range fn.InOut {
+			if buf.Len() != 0 {
+				buf.WriteString(", ")
+			}
+			for i := 0; i < params.Len(); i++ {
+				if params.At(i) == v {
+					fmt.Fprintf(&buf, "_p%d", i)
+					break
+				}
+			}
+		}
+		return buf.String()
+	}
+}
+
+// errorConditions returns a closure that reports whether any function
+// in info has an error result that is signalled to R as a condition.
+func errorConditions(opts Options) func(*pkg.Info) bool {
+	isErrorResult := errorResult(opts)
+	return func(info *pkg.Info) bool {
+		for _, fn := range info.Funcs {
+			if isErrorResult(fn) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// errorMatch is a mapping from a Go error value or type to an R
+// condition class.
+type errorMatch struct {
+	alias   string // alias of the imported package
+	path    string // import path of the package
+	name    string // name of the error value or type
+	pointer bool   // whether the error type is a pointer
+	is      bool   // whether the error is matched by errors.Is
+	class   string // the R condition class
+}
+
+// errorMatches returns the error mappings specified in opts, with
+// errors.Is mappings first. Each group is sorted by Go name.
+func errorMatches(opts Options) ([]errorMatch, error) {
+	aliases := make(map[string]string)
+	var matches []errorMatch
+	for _, m := range []struct {
+		is    bool
+		names map[string]string
+	}{
+		{is: true, names: opts.ErrorIs},
+		{is: false, names: opts.ErrorAs},
+	} {
+		keys := make([]string, 0, len(m.names))
+		for k := range m.names {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			qual := k
+			pointer := strings.HasPrefix(qual, "*")
+			if pointer {
+				if m.is {
+					return nil, fmt.Errorf("invalid sentinel error %q", k)
+				}
+				qual = qual[1:]
+			}
+			dot := strings.LastIndex(qual, ".")
+			if dot <= 0 || dot < strings.LastIndex(qual, "/") || dot == len(qual)-1 {
+				return nil, fmt.Errorf("invalid qualified error name %q", k)
+			}
+			path := qual[:dot]
+			alias, ok := aliases[path]
+			if !ok {
+				alias = fmt.Sprintf("_rgo_err%d", len(aliases))
+				aliases[path] = alias
+			}
+			matches = append(matches, errorMatch{
+				alias:   alias,
+				path:    path,
+				name:    qual[dot+1:],
+				pointer: pointer,
+				is:      m.is,
+				class:   m.names[k],
+			})
+		}
+	}
+	return matches, nil
+}
+
+// errorImports returns the aliased import specs for the packages
+// holding the errors mapped to R condition classes.
+func errorImports(opts Options) ([]string, error) {
+	matches, err := errorMatches(opts)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var specs []string
+	for _, m := range matches {
+		if seen[m.alias] {
+			continue
+		}
+		seen[m.alias] = true
+		specs = append(specs, fmt.Sprintf("%s %q", m.alias, m.path))
+	}
+	return specs, nil
+}
+
+// errorClassesGo returns the source of the errorClasses function that
+// returns the R condition classes mapped from a Go error.
+func errorClassesGo(opts Options) (string, error) {
+	matches, err := errorMatches(opts)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	buf.WriteString(`// errorClasses returns the R condition classes mapped from err.
+func errorClasses(err error) []string {
+`)
+	if len(matches) == 0 {
+		buf.WriteString("\treturn nil\n}\n")
+		return buf.String(), nil
+	}
+	buf.WriteString("\tvar class []string\n")
+	for i, m := range matches {
+		if m.is {
+			fmt.Fprintf(&buf, `	if errorIs(err, %s.%s) {
+		class = append(class, %q)
+	}
+`, m.alias, m.name, m.class)
 			continue
 		}
-		name := v.Name()
-		if name == "" {
-			name = fmt.Sprintf("%s%d", prefix, i)
+		var star string
+		if m.pointer {
+			star = "*"
 		}
-		buf.WriteString(fmt.Sprintf("%s %s", name, path.Base(v.Type().String())))
+		fmt.Fprintf(&buf, `	var target%[1]d %[2]s%[3]s.%[4]s
+	if errorAs(err, &target%[1]d) {
+		class = append(class, %[5]q)
 	}
-	return buf.String()
+`, i, star, m.alias, m.name, m.class)
+	}
+	buf.WriteString(`	return class
+}
+
+// errorIs reports whether any error in the tree of err matches target.
+// Unlike errors.Is before Go 1.20, it follows errors wrapping several
+// errors.
+func errorIs(err, target error) bool {
+	for _, e := range errorTree(err) {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorAs finds the first error in the tree of err that matches target,
+// and if one is found, sets target to that error value and returns true.
+// Unlike errors.As before Go 1.20, it follows errors wrapping several
+// errors.
+func errorAs(err error, target interface{}) bool {
+	for _, e := range errorTree(err) {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+`)
+	return buf.String(), nil
 }
 
 // typeNames returns a comma-separated list of the type names corresponding to vars.
@@ -152,13 +2253,49 @@ func typeNames(vars []*types.Var) string {
 	return buf.String()
 }
 
+type unpackPolicy struct {
+	zeroCopy string // Handling of values that refer to R memory.
+}
+
+// unpackPolicyFor returns the unpacking policy specified by opts.
+func unpackPolicyFor(opts Options) (unpackPolicy, error) {
+	zeroCopy, err := zeroCopy(opts)
+	if err != nil {
+		return unpackPolicy{}, err
+	}
+	return unpackPolicy{zeroCopy: zeroCopy}, nil
+}
+
+// gostring returns the name of the function used to obtain Go strings
+// from R character vectors under the policy.
+func (p unpackPolicy) gostring() string {
+	if p.zeroCopy == "share" {
+		return "C.R_gostring"
+	}
+	return "gostring"
+}
+
+// unpackSEXP returns a closure that returns the source of functions to
+// unpack R SEXP parameters into Go types using the policy specified by
+// opts.
+func unpackSEXP(opts Options) func([]types.Type) (string, error) {
+	return func(typs []types.Type) (string, error) {
+		policy, err := unpackPolicyFor(opts)
+		if err != nil {
+			return "", err
+		}
+		return unpackSEXPFuncGo(typs, policy), nil
+	}
+}
+
 // unpackSEXPFuncGo returns the source of functions to unpack R SEXP parameters
-// into the given Go types.
-func unpackSEXPFuncGo(typs []types.Type) string {
+// into the given Go types. Values that refer to R memory are handled according
+// to the given policy.
+func unpackSEXPFuncGo(typs []types.Type, policy unpackPolicy) string {
 	var buf bytes.Buffer
 	for _, typ := range typs {
 		fmt.Fprintf(&buf, "func unpackSEXP%s(p C.SEXP) %s {\n", pkg.Mangle(typ), nameOf(typ))
-		unpackSEXPFuncBodyGo(&buf, typ)
+		unpackSEXPFuncBodyGo(&buf, typ, policy)
 		buf.WriteString("}\n\n")
 	}
 	return buf.String()
@@ -166,35 +2303,52 @@ func unpackSEXPFuncGo(typs []types.Type) string {
 
 // unpackSEXPFuncBodyGo returns the body of a function to unpack R SEXP parameters
 // into the given Go types.
-func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
+func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type, policy unpackPolicy) {
 	switch typ := typ.(type) {
 	case *types.Named:
+		if pkg.IsConnection(typ) {
+			fmt.Fprint(buf, `	class := C.CString("connection")
+	defer C.free(unsafe.Pointer(class))
+	if C.Rf_inherits(p, class) == 0 {
+		panic(&typeError{want: "connection", got: describe(C.TYPEOF(p), int(C.Rf_xlength(p)))})
+	}
+	return connection{p}
+`)
+			return
+		}
 		fmt.Fprintf(buf, "\treturn %s(unpackSEXP%s(p))\n", nameOf(typ), pkg.Mangle(typ.Underlying()))
 
 	case *types.Array:
+		if dims, elem, ok := pkg.ArrayDims(typ); ok {
+			unpackArrayBodyGo(buf, typ, dims, elem, policy)
+			return
+		}
 		// TODO(kortschak): Only do this for [n]int32, [n]float64, [n]complex128 and [n]byte.
 		// Otherwise we have a double copy.
-		fmt.Fprintf(buf, `	var a %s
+		fmt.Fprintf(buf, `	checkSEXP(p, C.%s, %d)
+	var a %s
 	copy(a[:], unpackSEXP%s(p))
 	return a
-`, typ, pkg.Mangle(types.NewSlice(typ.Elem())))
+`, sexpTypeOf(typ.Elem()), typ.Len(), typ, pkg.Mangle(types.NewSlice(typ.Elem())))
 
 	case *types.Basic:
 		switch typ.Kind() {
 		case types.Bool:
-			fmt.Fprintln(buf, "\treturn *C.RAW(p) == 1")
-		case types.Int, types.Int8, types.Int16, types.Int32, types.Int64, types.Uint, types.Uint16, types.Uint32, types.Uint64:
-			fmt.Fprintf(buf, "\treturn %s(*C.INTEGER(p))\n", nameOf(typ))
-		case types.Uint8:
-			fmt.Fprintf(buf, "\treturn %s(*C.RAW(p))\n", nameOf(typ))
+			fmt.Fprintln(buf, "\tcheckSEXP(p, C.LGLSXP, 1)\n\treturn *C.LOGICAL(p) == 1")
+		case types.Int, types.Int8, types.Int16, types.Int32, types.Int64, types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64:
+			if min, max, ok := intRange(typ.Kind()); ok {
+				fmt.Fprintf(buf, "\tcheckSEXP(p, C.INTSXP, 1)\n\tv := int32(*C.INTEGER(p))\n\tcheckRange(v, %d, %d)\n\treturn %s(v)\n", min, max, nameOf(typ))
+				break
+			}
+			fmt.Fprintf(buf, "\tcheckSEXP(p, C.INTSXP, 1)\n\treturn %s(*C.INTEGER(p))\n", nameOf(typ))
 		case types.Float64, types.Float32:
-			fmt.Fprintf(buf, "\treturn %s(*C.REAL(p))\n", nameOf(typ))
+			fmt.Fprintf(buf, "\tcheckSEXP(p, C.REALSXP, 1)\n\treturn %s(*C.REAL(p))\n", nameOf(typ))
 		case types.Complex128:
-			fmt.Fprintf(buf, "\treturn %s(*(*complex128)(unsafe.Pointer(C.COMPLEX(p))))\n", nameOf(typ))
+			fmt.Fprintf(buf, "\tcheckSEXP(p, C.CPLXSXP, 1)\n\treturn %s(*(*complex128)(unsafe.Pointer(C.COMPLEX(p))))\n", nameOf(typ))
 		case types.Complex64:
 			fmt.Fprintf(buf, "\treturn %s(unpackSEXP%s(p))\n", nameOf(typ), pkg.Mangle(types.Typ[types.Complex128]))
 		case types.String:
-			fmt.Fprintln(buf, "\treturn C.R_gostring(p, 0)")
+			fmt.Fprintf(buf, "\tcheckSEXP(p, C.STRSXP, 1)\n\treturn %s(p, 0)\n", policy.gostring())
 		default:
 			panic(fmt.Sprintf("unhandled type: %s", typ))
 		}
@@ -212,83 +2366,95 @@ func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 			case types.Int, types.Int8, types.Int16, types.Int32, types.Uint, types.Uint16, types.Uint32:
 				// Maximum length array type for this element type.
 				type a [1 << 47]int32
-				fmt.Fprintf(buf, `	n := int(C.Rf_xlength(p))
+				fmt.Fprintf(buf, `	checkSEXP(p, C.INTSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
 	r := make(map[string]%[2]s, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
 	values := (*[%[1]d]int32)(unsafe.Pointer(C.INTEGER(p)))[:n:n]
 	for i, elem := range values {
-		key := string(C.R_gostring(names, C.R_xlen_t(i)))
+%[3]s		key := string(%[4]s(names, C.R_xlen_t(i)))
 		r[key] = %[2]s(elem)
 	}
 	return r
-`, len(&a{}), nameOf(elem))
+`, len(&a{}), nameOf(elem), rangeCheck("elem", basic.Kind(), 2), policy.gostring())
 				return
 			case types.Uint8:
 				// Maximum length array type for this element type.
 				type a [1 << 49]byte
-				fmt.Fprintf(buf, `	n := int(C.Rf_xlength(p))
+				fmt.Fprintf(buf, `	checkSEXP(p, C.RAWSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
 	r := make(map[string]%[2]s, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
 	values := (*[%[1]d]%[2]s)(unsafe.Pointer(C.RAW(p)))[:n:n]
 	for i, elem := range values {
-		key := string(C.R_gostring(names, C.R_xlen_t(i)))
+		key := string(%[3]s(names, C.R_xlen_t(i)))
 		r[key] = elem
 	}
 	return r
-`, len(&a{}), nameOf(elem))
+`, len(&a{}), nameOf(elem), policy.gostring())
 				return
 			case types.Float32, types.Float64:
 				// Maximum length array type for this element type.
 				type a [1 << 46]float64
-				fmt.Fprintf(buf, `	n := int(C.Rf_xlength(p))
+				fmt.Fprintf(buf, `	checkSEXP(p, C.REALSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
 	r := make(map[string]%[2]s, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
 	values := (*[%[1]d]float64)(unsafe.Pointer(C.REAL(p)))[:n:n]
 	for i, elem := range values {
-		key := string(C.R_gostring(names, C.R_xlen_t(i)))
+		key := string(%[3]s(names, C.R_xlen_t(i)))
 		r[key] = %[2]s(elem)
 	}
 	return r
-`, len(&a{}), nameOf(elem))
+`, len(&a{}), nameOf(elem), policy.gostring())
 				return
 			case types.Complex64, types.Complex128:
 				// Maximum length array type for this element type.
 				type a [1 << 45]complex128
-				fmt.Fprintf(buf, `	n := int(C.Rf_xlength(p))
+				fmt.Fprintf(buf, `	checkSEXP(p, C.CPLXSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
 	r := make(map[string]%[2]s, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
 	values := (*[%[1]d]complex128)(unsafe.Pointer(C.COMPLEX(p)))[:n:n]
 	for i, elem := range values {
-		key := string(C.R_gostring(names, C.R_xlen_t(i)))
+		key := string(%[3]s(names, C.R_xlen_t(i)))
 		r[key] = %[2]s(elem)
 	}
 	return r
-`, len(&a{}), nameOf(elem))
+`, len(&a{}), nameOf(elem), policy.gostring())
 				return
 			case types.Bool:
 				// Maximum length array type for this element type.
 				type a [1 << 47]int32
-				fmt.Fprintf(buf, `	n := int(C.Rf_xlength(p))
+				fmt.Fprintf(buf, `	checkSEXP(p, C.LGLSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
 	r := make(map[string]%[2]s, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
 	values := (*[%[1]d]int32)(unsafe.Pointer(C.LOGICAL(p)))[:n:n]
 	for i, elem := range values {
-		key := string(C.R_gostring(names, C.R_xlen_t(i)))
+		key := string(%[3]s(names, C.R_xlen_t(i)))
 		r[key] = (elem == 1)
 	}
 	return r
-`, len(&a{}), nameOf(elem))
+`, len(&a{}), nameOf(elem), policy.gostring())
 				return
 			case types.String:
-				fmt.Fprintf(buf, `	n := int(C.Rf_xlength(p))
+				fmt.Fprintf(buf, `	checkSEXP(p, C.STRSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
 	r := make(map[string]%[1]s, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
 	for i := 0; i < n; i++ {
-		key := string(C.R_gostring(names, C.R_xlen_t(i)))
-		r[key] = %[1]s(C.R_gostring(p, C.R_xlen_t(i)))
+		key := string(%[2]s(names, C.R_xlen_t(i)))
+		r[key] = %[1]s(%[2]s(p, C.R_xlen_t(i)))
 	}
 	return r
-`, nameOf(elem))
+`, nameOf(elem), policy.gostring())
 				return
 			}
 		}
@@ -310,6 +2476,7 @@ func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	}
 `)
 		elem := typ.Elem()
+		fmt.Fprintf(buf, "\tcheckSEXP(p, C.%s, -1)\n", sexpTypeOf(elem))
 		if elem, ok := elem.(*types.Basic); ok {
 			switch elem.Kind() {
 			// TODO(kortschak): Make the fast path available
@@ -317,50 +2484,62 @@ func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 			case types.Int32:
 				// Maximum length array type for this element type.
 				type a [1 << 47]int32
-				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
-	return (*[%d]%s)(unsafe.Pointer(C.INTEGER(p)))[:n:n]
-`, len(&a{}), nameOf(elem))
+				unpackViewGo(buf, typ, len(&a{}), "INTEGER", 4, policy)
 				return
 			case types.Uint8:
 				// Maximum length array type for this element type.
 				type a [1 << 49]byte
-				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
-	return (*[%d]%s)(unsafe.Pointer(C.RAW(p)))[:n:n]
-`, len(&a{}), nameOf(elem))
+				unpackViewGo(buf, typ, len(&a{}), "RAW", 1, policy)
 				return
 			case types.Float64:
 				// Maximum length array type for this element type.
 				type a [1 << 46]float64
-				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
-	return (*[%d]%s)(unsafe.Pointer(C.REAL(p)))[:n:n]
-`, len(&a{}), nameOf(elem))
+				unpackViewGo(buf, typ, len(&a{}), "REAL", 8, policy)
 				return
 			case types.Complex128:
 				// Maximum length array type for this element type.
 				type a [1 << 45]complex128
-				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
-	return (*[%d]%s)(unsafe.Pointer(C.COMPLEX(p)))[:n:n]
-`, len(&a{}), nameOf(elem))
+				unpackViewGo(buf, typ, len(&a{}), "COMPLEX", 16, policy)
 				return
 			case types.Bool:
 				// Maximum length array type for this element type.
 				type a [1 << 47]int32
 				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
 	r := make(%s, n)
-	for i, b := range (*[%d]%s)(unsafe.Pointer(C.BOOL(p)))[:n] {
+	for i, b := range (*[%d]%s)(unsafe.Pointer(C.LOGICAL(p)))[:n] {
 		r[i] = (b == 1)
 	}
 	return r
 `, nameOf(typ), len(&a{}), nameOf(types.Typ[types.Int32]))
 				return
 			case types.String:
+				if policy.zeroCopy == "poison" {
+					fmt.Fprintf(buf, `	s := gostrings(p)
+	r := make(%s, len(s))
+	for i, e := range s {
+		r[i] = %s(e)
+	}
+	return r
+`, nameOf(typ), nameOf(elem))
+					return
+				}
 				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
 	r := make(%s, n)
 	for i := range r {
-		r[i] = %s(C.R_gostring(p, C.R_xlen_t(i)))
+		r[i] = %s(%s(p, C.R_xlen_t(i)))
 	}
 	return r
-`, nameOf(typ), nameOf(elem))
+`, nameOf(typ), nameOf(elem), policy.gostring())
+				return
+			default:
+				v := vectorOf(elem.Kind())
+				fmt.Fprintf(buf, `	n := C.Rf_xlength(p)
+	r := make(%s, n)
+	for i, v := range (*[%d]%s)(unsafe.Pointer(C.%s(p)))[:n] {
+%s		r[i] = %s(v)
+	}
+	return r
+`, nameOf(typ), v.max, v.elem, v.accessor, rangeCheck("v", elem.Kind(), 2), nameOf(elem))
 				return
 			}
 		}
@@ -374,16 +2553,28 @@ func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 
 	case *types.Struct:
 		n := typ.NumFields()
-		fmt.Fprintf(buf, `	switch n := C.Rf_xlength(p); {
-	case n < %[1]d:
-		panic(`+"`missing list element for %[2]s`"+`)
-	case n > %[1]d:
-		err := C.CString(`+"`extra list element ignored for %[2]s`"+`)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		// Fields that may be nil are optional.
+		required := 0
+		for i := 0; i < n; i++ {
+			if !isNillable(typ.Field(i).Type()) {
+				required++
+			}
+		}
+		fmt.Fprintln(buf, "\tcheckSEXP(p, C.VECSXP, -1)")
+		if n != 0 {
+			fmt.Fprintln(buf, "\tcheckNames(p)")
+		}
+		fmt.Fprint(buf, "\tswitch n := C.Rf_xlength(p); {\n")
+		if required != 0 {
+			fmt.Fprintf(buf, `	case n < %[1]d:
+		panic(&typeError{want: "list of length at least %[1]d", got: describe(C.VECSXP, int(n))})
+`, required)
+		}
+		fmt.Fprintf(buf, `	case n > %[1]d:
+		panic(&typeError{want: "list of length at most %[1]d", got: describe(C.VECSXP, int(n))})
 	}
 	var r %[2]s
-	var i C.int
+	var i C.R_xlen_t
 `, n, nameOf(typ))
 		for i := 0; i < n; i++ {
 			f := typ.Field(i)
@@ -391,11 +2582,19 @@ func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 			fmt.Fprintf(buf, `	key_%s := C.CString("%[1]s")
 	defer C.free(unsafe.Pointer(key_%[1]s))
 	i = C.getListElementIndex(p, key_%[1]s)
-	if i < 0 {
-		panic("no list element for field: %[2]s")
+`, targetFieldName(typ, i))
+			if isNillable(f.Type()) {
+				fmt.Fprintf(buf, `	if i >= 0 {
+		r.%s = unpackSEXP%s(C.VECTOR_ELT(p, i))
+	}
+`, f.Name(), pkg.Mangle(f.Type()))
+				continue
+			}
+			fmt.Fprintf(buf, `	if i < 0 {
+		panic(&typeError{want: %q, got: describe(C.VECSXP, -1) + %q})
 	}
-	r.%[2]s = unpackSEXP%s(C.VECTOR_ELT(p, C.R_xlen_t(i)))
-`, targetFieldName(typ, i), f.Name(), pkg.Mangle(f.Type()))
+	r.%s = unpackSEXP%s(C.VECTOR_ELT(p, i))
+`, fmt.Sprintf("list with element %q", targetFieldName(typ, i)), " without it", f.Name(), pkg.Mangle(f.Type()))
 		}
 		fmt.Fprintln(buf, "\treturn r")
 
@@ -404,21 +2603,112 @@ func unpackSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	}
 }
 
+// packPolicy holds the policies for packing Go values that R cannot
+// represent directly.
+type packPolicy struct {
+	overflow string // Handling of integers out of range for R integers.
+	strings  string // Handling of invalid UTF-8 and NUL bytes in strings.
+}
+
+// packSEXP returns a closure that returns the source of functions to pack
+// Go-typed parameters into R SEXP values using the policies specified by
+// opts.
+func packSEXP(opts Options) func([]types.Type) (string, error) {
+	return func(typs []types.Type) (string, error) {
+		overflow, err := intOverflow(opts)
+		if err != nil {
+			return "", err
+		}
+		strings, err := invalidString(opts)
+		if err != nil {
+			return "", err
+		}
+		return packSEXPFuncGo(typs, packPolicy{overflow: overflow, strings: strings}), nil
+	}
+}
+
 // packSEXPFuncGo returns the source of functions to pack the given Go-typed
-// parameters into R SEXP values.
-func packSEXPFuncGo(typs []types.Type) string {
+// parameters into R SEXP values. Values that R cannot represent directly
+// are handled according to the given policy.
+func packSEXPFuncGo(typs []types.Type, policy packPolicy) string {
 	var buf bytes.Buffer
 	for _, typ := range typs {
 		fmt.Fprintf(&buf, "func packSEXP%s(p %s) C.SEXP {\n", pkg.Mangle(typ), nameOf(typ))
-		packSEXPFuncBodyGo(&buf, typ)
+		packSEXPFuncBodyGo(&buf, typ, policy)
 		buf.WriteString("}\n\n")
 	}
 	return buf.String()
 }
 
+// packArgGo returns the source of a function to pack the Go values passed
+// to R functions by the runtime package into R SEXP values using the
+// packers for the given Go types. Interface types are not packed.
+func packArgGo(typs []types.Type) string {
+	var buf bytes.Buffer
+	buf.WriteString(`// packArg returns an R value for the Go value v passed to an R function
+// by the runtime package.
+func packArg(v interface{}) C.SEXP {
+	switch v := v.(type) {
+	case nil:
+		return C.R_NilValue
+`)
+	for _, typ := range runtimeCases(typs) {
+		fmt.Fprintf(&buf, "\tcase %s:\n\t\treturn packSEXP%s(v)\n", nameOf(typ), pkg.Mangle(typ))
+	}
+	buf.WriteString(`	default:
+		panic(fmt.Sprintf("unsupported argument type %T", v))
+	}
+}
+
+`)
+	return buf.String()
+}
+
+// unpackResultGo returns the source of a function to unpack the R SEXP
+// values returned to the runtime package into Go values using the
+// unpackers for the given Go types. Interface types are not unpacked.
+func unpackResultGo(typs []types.Type) string {
+	var buf bytes.Buffer
+	buf.WriteString(`// unpackResult stores the R value p in the value pointed to by dst. If
+// dst is nil, p is discarded.
+func unpackResult(dst interface{}, p C.SEXP) {
+	switch dst := dst.(type) {
+	case nil:
+`)
+	for _, typ := range runtimeCases(typs) {
+		fmt.Fprintf(&buf, "\tcase *%s:\n\t\t*dst = unpackSEXP%s(p)\n", nameOf(typ), pkg.Mangle(typ))
+	}
+	buf.WriteString(`	default:
+		panic(fmt.Sprintf("unsupported result type %T", dst))
+	}
+}
+
+`)
+	return buf.String()
+}
+
+// runtimeCases returns the types in typs that are not interfaces with
+// identical types removed, for use as type switch cases.
+func runtimeCases(typs []types.Type) []types.Type {
+	var cases []types.Type
+outer:
+	for _, typ := range typs {
+		if _, ok := typ.Underlying().(*types.Interface); ok {
+			continue
+		}
+		for _, c := range cases {
+			if types.Identical(typ, c) {
+				continue outer
+			}
+		}
+		cases = append(cases, typ)
+	}
+	return cases
+}
+
 // packSEXPFuncGo returns the body of a function to pack the given Go-typed
 // parameters into R SEXP values.
-func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
+func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type, policy packPolicy) {
 	switch typ := typ.(type) {
 	case *types.Named:
 		if pkg.IsError(typ) {
@@ -437,6 +2727,10 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 		}
 
 	case *types.Array:
+		if dims, elem, ok := pkg.ArrayDims(typ); ok {
+			packArrayBodyGo(buf, dims, elem, policy)
+			return
+		}
 		fmt.Fprintf(buf, "\treturn packSEXP%s(p[:])\n", pkg.Mangle(types.NewSlice(typ.Elem())))
 
 	case *types.Basic:
@@ -448,47 +2742,43 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	}
 	return C.ScalarLogical(b)
 `)
-		case types.Int, types.Int8, types.Int16, types.Int32, types.Int64, types.Uint, types.Uint16, types.Uint32, types.Uint64:
+		case types.Int, types.Int32, types.Uint, types.Uint32:
+			switch policy.overflow {
+			case "double":
+				fmt.Fprintln(buf, "\treturn C.ScalarReal(C.double(p))")
+			case "promote":
+				fmt.Fprintf(buf, `	if !%s {
+		return C.ScalarReal(C.double(p))
+	}
+	return C.ScalarInteger(C.int(p))
+`, intCall("fits", typ.Kind(), "p"))
+			default:
+				fmt.Fprintf(buf, "\t%s\n\treturn C.ScalarInteger(C.int(p))\n", intCall("check", typ.Kind(), "p"))
+			}
+		case types.Int8, types.Int16, types.Int64, types.Uint8, types.Uint16, types.Uint64:
 			fmt.Fprintln(buf, "\treturn C.ScalarInteger(C.int(p))")
-		case types.Uint8:
-			fmt.Fprintln(buf, "\treturn C.ScalarRaw(C.Rbyte(p))")
 		case types.Float64, types.Float32:
 			fmt.Fprintln(buf, "\treturn C.ScalarReal(C.double(p))")
 		case types.Complex128, types.Complex64:
-			fmt.Fprintln(buf, "\treturn C.ScalarComplex(C.struct_Rcomplex{r: C.double(real(p)), i: C.double(imag(p))})")
+			// Rcomplex has the layout of complex128 but is not a
+			// tagged struct and is a union since R 4.3.
+			fmt.Fprintln(buf, "\tc := complex128(p)\n\treturn C.ScalarComplex(*(*C.Rcomplex)(unsafe.Pointer(&c)))")
 		case types.String:
-			fmt.Fprintln(buf, `	s := C.Rf_mkCharLenCE(C._GoStringPtr(p), C.int(len(p)), C.CE_UTF8)
-	return C.ScalarString(s)`)
-		default:
-			panic(fmt.Sprintf("unhandled type: %s", typ))
-		}
-
-	case *types.Map:
-		// TODO(kortschak): Handle named simple types properly.
-		elem := typ.Elem()
-		if basic, ok := elem.Underlying().(*types.Basic); ok {
-			switch basic.Kind() {
-			// TODO(kortschak): Make the fast path available
-			// to []T where T is one of these kinds.
-			case types.Int, types.Int8, types.Int16, types.Int32, types.Uint, types.Uint16, types.Uint32:
-				// Maximum length array type for this element type.
-				type a [1 << 47]int32
-				fmt.Fprintf(buf, `	n := len(p)
-	r := C.Rf_allocVector(C.%[1]s, C.R_xlen_t(n))
-	C.Rf_protect(r)
-	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
-	C.Rf_protect(names)
-	s := (*[%[2]d]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
-	var i C.R_xlen_t
-	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
-		s[i] = int32(v)
-		i++
-	}
-	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
-	C.Rf_unprotect(2)
-	return r
-`, rTypeLabelFor(elem), len(&a{}))
+			if policy.strings == "raw" {
+				fmt.Fprintln(buf, "\tif !validString(p) {\n\t\treturn rawVector(p)\n\t}")
+			}
+			fmt.Fprintln(buf, "\treturn C.ScalarString(mkChar(p))")
+		default:
+			panic(fmt.Sprintf("unhandled type: %s", typ))
+		}
+
+	case *types.Map:
+		// TODO(kortschak): Handle named simple types properly.
+		elem := typ.Elem()
+		if basic, ok := elem.Underlying().(*types.Basic); ok {
+			switch basic.Kind() {
+			case types.Int, types.Int8, types.Int16, types.Int32, types.Uint, types.Uint16, types.Uint32, types.Float32, types.Float64, types.Complex64, types.Complex128:
+				packVectorBodyGo(buf, basic.Kind(), true, policy.overflow)
 				return
 
 			case types.Uint8:
@@ -502,7 +2792,7 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	s := (*[%[2]d]uint8)(unsafe.Pointer(C.RAW(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		i++
 	}
 	copy(s, p)
@@ -512,64 +2802,8 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 `, rTypeLabelFor(elem), len(&a{}), pkg.Mangle(elem))
 				return
 
-			case types.Float32, types.Float64:
-				// Maximum length array type for this element type.
-				type a [1 << 46]float64
-				fmt.Fprintf(buf, `	n := len(p)
-	r := C.Rf_allocVector(C.%[1]s, C.R_xlen_t(n))
-	C.Rf_protect(r)
-	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
-	C.Rf_protect(names)
-	s := (*[%[2]d]float64)(unsafe.Pointer(C.REAL(r)))[:len(p):len(p)]
-	var i C.R_xlen_t
-	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
-		s[i] = float64(v)
-		i++
-	}
-	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
-	C.Rf_unprotect(2)
-	return r
-`, rTypeLabelFor(elem), len(&a{}))
-				return
-
-			case types.Complex64, types.Complex128:
-				// Maximum length array type for this element type.
-				type a [1 << 45]complex128
-				fmt.Fprintf(buf, `	n := len(p)
-	r := C.Rf_allocVector(C.%[1]s, C.R_xlen_t(n))
-	C.Rf_protect(r)
-	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
-	C.Rf_protect(names)
-	s := (*[%[2]d]complex128)(unsafe.Pointer(C.COMPLEX(r)))[:len(p):len(p)]
-	var i C.R_xlen_t
-	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
-		s[i] = complex128(v)
-		i++
-	}
-	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
-	C.Rf_unprotect(2)
-	return r
-`, rTypeLabelFor(elem), len(&a{}))
-				return
-
 			case types.String:
-				fmt.Fprintf(buf, `	n := len(p)
-	r := C.Rf_allocVector(C.%[1]s, C.R_xlen_t(n))
-	C.Rf_protect(r)
-	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
-	C.Rf_protect(names)
-	var i C.R_xlen_t
-	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
-		C.SET_STRING_ELT(r, i, packSEXP%s(v))
-		i++
-	}
-	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
-	C.Rf_unprotect(2)
-	return r
-`, rTypeLabelFor(elem), pkg.Mangle(elem))
+				packStringsBodyGo(buf, true, policy.strings)
 				return
 
 			case types.Bool:
@@ -590,7 +2824,7 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	s := (*[%d]int32)(unsafe.Pointer(C.LOGICAL(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		if v {
 			s[i] = 1
 		} else {
@@ -608,25 +2842,7 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 
 		switch {
 		case elem.String() == "error":
-			fmt.Fprintf(buf, `	n := len(p)
-	r := C.Rf_allocVector(C.%[1]s, C.R_xlen_t(n))
-	C.Rf_protect(r)
-	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
-	C.Rf_protect(names)
-	var i C.R_xlen_t
-	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
-		s := C.R_NilValue
-		if v != nil {
-			C.SET_STRING_ELT(r, i, packSEXP%[2]s(v))
-		}
-		C.SET_STRING_ELT(r, i, s)
-		i++
-	}
-	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
-	C.Rf_unprotect(2)
-	return r
-`, rTypeLabelFor(elem), pkg.Mangle(elem))
+			packErrorsBodyGo(buf, true)
 
 		default:
 			fmt.Fprintf(buf, `	n := len(p)
@@ -636,7 +2852,7 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	C.Rf_protect(names)
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		C.SET_VECTOR_ELT(r, i, packSEXP%s(v))
 		i++
 	}
@@ -658,18 +2874,8 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 		elem := typ.Elem()
 		if elem, ok := elem.(*types.Basic); ok {
 			switch elem.Kind() {
-			// TODO(kortschak): Make the fast path available
-			// to []T where T is one of these kinds.
-			case types.Int32:
-				// Maximum length array type for this element type.
-				type a [1 << 47]int32
-				fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(len(p)))
-	C.Rf_protect(r)
-	s := (*[%d]%s)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
-	copy(s, p)
-	C.Rf_unprotect(1)
-	return r
-`, len(&a{}), nameOf(elem))
+			case types.Int, types.Int8, types.Int16, types.Int32, types.Uint, types.Uint16, types.Uint32, types.Float32, types.Float64, types.Complex64, types.Complex128:
+				packVectorBodyGo(buf, elem.Kind(), false, policy.overflow)
 				return
 			case types.Uint8:
 				// Maximum length array type for this element type.
@@ -680,28 +2886,6 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	copy(s, p)
 	C.Rf_unprotect(1)
 	return r
-`, len(&a{}), nameOf(elem))
-				return
-			case types.Float64:
-				// Maximum length array type for this element type.
-				type a [1 << 46]float64
-				fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.REALSXP, C.R_xlen_t(len(p)))
-	C.Rf_protect(r)
-	s := (*[%d]%s)(unsafe.Pointer(C.REAL(r)))[:len(p):len(p)]
-	copy(s, p)
-	C.Rf_unprotect(1)
-	return r
-`, len(&a{}), nameOf(elem))
-				return
-			case types.Complex128:
-				// Maximum length array type for this element type.
-				type a [1 << 45]complex128
-				fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.CPLXSXP, C.R_xlen_t(len(p)))
-	C.Rf_protect(r)
-	s := (*[%d]%s)(unsafe.Pointer(C.CPLXSXP(r)))[:len(p):len(p)]
-	copy(s, p)
-	C.Rf_unprotect(1)
-	return r
 `, len(&a{}), nameOf(elem))
 				return
 			case types.Bool:
@@ -716,7 +2900,7 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 				//  }
 				fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.LGLSXP, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
-	s := (*[%d]%s)(unsafe.Pointer(C.LOGICAL(r)))[:len(p):len(p)]
+	s := (*[%d]int32)(unsafe.Pointer(C.LOGICAL(r)))[:len(p):len(p)]
 	for i, v := range p {
 		if v {
 			s[i] = 1
@@ -726,35 +2910,16 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 	}
 	C.Rf_unprotect(1)
 	return r
-`, len(&a{}), nameOf(elem))
+`, len(&a{}))
 				return
 			}
 		}
 
 		switch {
 		case elem.String() == "string":
-			fmt.Fprint(buf, `	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(p)))
-	C.Rf_protect(r)
-	for i, v := range p {
-		s := C.Rf_mkCharLenCE(C._GoStringPtr(string(v)), C.int(len(v)), C.CE_UTF8)
-		C.SET_STRING_ELT(r, C.R_xlen_t(i), s)
-	}
-	C.Rf_unprotect(1)
-	return r
-`)
+			packStringsBodyGo(buf, false, policy.strings)
 		case elem.String() == "error":
-			fmt.Fprint(buf, `	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(p)))
-	C.Rf_protect(r)
-	for i, v := range p {
-		s := C.R_NilValue
-		if v != nil {
-			s = C.Rf_mkCharLenCE(C._GoStringPtr(v), C.int(len(v)), C.CE_UTF8)
-		}
-		C.SET_STRING_ELT(r, C.R_xlen_t(i), s)
-	}
-	C.Rf_unprotect(1)
-	return r
-`)
+			packErrorsBodyGo(buf, false)
 		default:
 			fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.%s, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
@@ -768,25 +2933,428 @@ func packSEXPFuncBodyGo(buf *bytes.Buffer, typ types.Type) {
 
 	case *types.Struct:
 		n := typ.NumFields()
-		fmt.Fprintf(buf, "\tr := C.allocList(%d)\n\tC.Rf_protect(r)\n", n)
+		fmt.Fprintf(buf, "\tr := C.Rf_allocVector(C.VECSXP, %d)\n\tC.Rf_protect(r)\n", n)
 		fmt.Fprintf(buf, "\tnames := C.Rf_allocVector(C.STRSXP, %d)\n\tC.Rf_protect(names)\n", n)
-		fmt.Fprintln(buf, "\targ := r")
 		for i := 0; i < n; i++ {
 			f := typ.Field(i)
 			rName := targetFieldName(typ, i)
 			fmt.Fprintf(buf, "\tC.SET_STRING_ELT(names, %d, C.Rf_mkCharLenCE(C._GoStringPtr(`%s`), %d, C.CE_UTF8))\n", i, rName, len(rName))
-			fmt.Fprintf(buf, "\tC.SETCAR(arg, packSEXP%s(p.%s))\n", pkg.Mangle(f.Type()), f.Name())
-			if i < n-1 {
-				fmt.Fprintln(buf, "\targ = C.CDR(arg)")
-			}
+			fmt.Fprintf(buf, "\tC.SET_VECTOR_ELT(r, %d, packSEXP%s(p.%s))\n", i, pkg.Mangle(f.Type()), f.Name())
 		}
-		fmt.Fprintln(buf, "\tC.setAttrib(r, packSEXP_types_Basic_string(`names`), names)\n\tC.Rf_unprotect(2)\n\treturn r")
+		fmt.Fprintln(buf, "\tC.setAttrib(r, C.R_NamesSymbol, names)\n\tC.Rf_unprotect(2)\n\treturn r")
 
 	default:
 		panic(fmt.Sprintf("unhandled type: %s", typ))
 	}
 }
 
+// unpackViewGo writes the statements of a function to unpack the R vector p
+// into the slice type typ, which has an element type with the same memory
+// layout as the R vector's elements. The R vector memory is obtained with
+// the accessor and is viewed through an array type of length max with
+// elements of the given size. The vector memory is shared with, copied to
+// or preserved for Go code according to the given policy. Shared vectors
+// are duplicated before their memory is shared or preserved.
+func unpackViewGo(buf *bytes.Buffer, typ *types.Slice, max int, accessor string, size int, policy unpackPolicy) {
+	view := fmt.Sprintf("(*[%d]%s)(unsafe.Pointer(C.%s(p)))[:n:n]", max, nameOf(typ.Elem()), accessor)
+	switch policy.zeroCopy {
+	case "share", "preserve":
+		buf.WriteString("\tp = unshared(p)\n")
+	}
+	buf.WriteString("\tn := C.Rf_xlength(p)\n")
+	switch policy.zeroCopy {
+	case "copy":
+		fmt.Fprintf(buf, "\tr := make(%s, n)\n\tcopy(r, %s)\n\treturn r\n", nameOf(typ), view)
+	case "preserve":
+		fmt.Fprintf(buf, "\tpreserve(p)\n\treturn %s\n", view)
+	case "poison":
+		fmt.Fprintf(buf, "\treturn (*[%d]%s)(viewOf(unsafe.Pointer(C.%s(p)), int(n)*%d))[:n:n]\n", max, nameOf(typ.Elem()), accessor, size)
+	default:
+		fmt.Fprintf(buf, "\treturn %s\n", view)
+	}
+}
+
+// unpackArrayBodyGo writes the body of a function to unpack an R array with
+// the given dimensions into a multi-dimensional Go array. R arrays are stored
+// in column-major order.
+func unpackArrayBodyGo(buf *bytes.Buffer, typ types.Type, dims []int64, elem types.Type, policy unpackPolicy) {
+	n := product(dims)
+	kind := elem.Underlying().(*types.Basic).Kind()
+	d := make([]string, len(dims))
+	for i, l := range dims {
+		d[i] = fmt.Sprint(l)
+	}
+	fmt.Fprintf(buf, "\tcheckSEXP(p, C.%s, %d)\n\tcheckDim(p, %s)\n", vectorOf(kind).sexptype, n, strings.Join(d, ", "))
+	fmt.Fprintf(buf, "\tvar r %s\n", nameOf(typ))
+	var val string
+	if kind == types.String {
+		val = fmt.Sprintf("%s(%s(p, C.R_xlen_t(%s)))", nameOf(elem), policy.gostring(), arrayIndex(dims))
+	} else {
+		v := vectorOf(kind)
+		fmt.Fprintf(buf, "\ts := (*[%d]%s)(unsafe.Pointer(C.%s(p)))[:%d:%d]\n", v.max, v.elem, v.accessor, n, n)
+		if check := rangeCheck("v", kind, 2); check != "" && v.sexptype == "INTSXP" {
+			fmt.Fprintf(buf, "\tfor _, v := range s {\n%s\t}\n", check)
+		}
+		val = fmt.Sprintf("s[%s]", arrayIndex(dims))
+		if kind == types.Bool {
+			val += " == 1"
+		}
+		val = fmt.Sprintf("%s(%s)", nameOf(elem), val)
+	}
+	ref := arrayLoops(buf, "r", len(dims))
+	fmt.Fprintf(buf, "%s%s = %s\n", indent(len(dims)+1), ref, val)
+	closeLoops(buf, len(dims))
+	fmt.Fprintln(buf, "\treturn r")
+}
+
+// packArrayBodyGo writes the body of a function to pack a multi-dimensional
+// Go array into an R array with the given dimensions. R arrays are stored
+// in column-major order. Values that R cannot represent directly are handled
+// according to the given policy.
+func packArrayBodyGo(buf *bytes.Buffer, dims []int64, elem types.Type, policy packPolicy) {
+	kind := elem.Underlying().(*types.Basic).Kind()
+	v := vectorOf(kind)
+	if kind == types.String && policy.strings == "raw" {
+		fmt.Fprintln(buf, "\traw := false")
+		ref := arrayLoops(buf, "p", len(dims))
+		fmt.Fprintf(buf, "%sraw = raw || !validString(string(%s))\n", indent(len(dims)+1), ref)
+		closeLoops(buf, len(dims))
+		var raw bytes.Buffer
+		writeArrayGo(&raw, dims, kind, rVector{sexptype: "VECSXP"})
+		fmt.Fprintf(buf, "\tif raw {\n%s\t}\n", reindent(raw.String(), 1))
+	}
+	if overflows(kind) {
+		switch policy.overflow {
+		case "double":
+			v = vectorOf(types.Float64)
+		case "promote":
+			fmt.Fprintln(buf, "\tpromote := false")
+			ref := arrayLoops(buf, "p", len(dims))
+			fmt.Fprintf(buf, "%spromote = promote || !%s\n", indent(len(dims)+1), intCall("fits", kind, ref))
+			closeLoops(buf, len(dims))
+			var double bytes.Buffer
+			writeArrayGo(&double, dims, kind, vectorOf(types.Float64))
+			fmt.Fprintf(buf, "\tif promote {\n%s\t}\n", reindent(double.String(), 1))
+		default:
+			ref := arrayLoops(buf, "p", len(dims))
+			fmt.Fprintf(buf, "%s%s\n", indent(len(dims)+1), intCall("check", kind, ref))
+			closeLoops(buf, len(dims))
+		}
+	}
+	writeArrayGo(buf, dims, kind, v)
+}
+
+// writeArrayGo writes statements packing the multi-dimensional Go array p
+// of the given element kind into an R array stored as v and returning it.
+// Strings are stored as raw vectors in a list when v is a VECSXP.
+func writeArrayGo(buf *bytes.Buffer, dims []int64, kind types.BasicKind, v rVector) {
+	n := product(dims)
+	fmt.Fprintf(buf, "\tr := C.Rf_allocVector(C.%s, %d)\n\tC.Rf_protect(r)\n", v.sexptype, n)
+	if kind != types.String {
+		fmt.Fprintf(buf, "\ts := (*[%d]%s)(unsafe.Pointer(C.%s(r)))[:%d:%d]\n", v.max, v.elem, v.accessor, n, n)
+	}
+	ref := arrayLoops(buf, "p", len(dims))
+	in := indent(len(dims) + 1)
+	switch {
+	case v.sexptype == "VECSXP":
+		fmt.Fprintf(buf, "%sC.SET_VECTOR_ELT(r, C.R_xlen_t(%s), rawVector(string(%s)))\n", in, arrayIndex(dims), ref)
+	case kind == types.String:
+		fmt.Fprintf(buf, "%sC.SET_STRING_ELT(r, C.R_xlen_t(%s), mkChar(string(%s)))\n", in, arrayIndex(dims), ref)
+	case kind == types.Bool:
+		fmt.Fprintf(buf, "%[1]sif %[2]s {\n%[1]s\ts[%[3]s] = 1\n%[1]s} else {\n%[1]s\ts[%[3]s] = 0\n%[1]s}\n", in, ref, arrayIndex(dims))
+	default:
+		fmt.Fprintf(buf, "%ss[%s] = %s(%s)\n", in, arrayIndex(dims), v.elem, ref)
+	}
+	closeLoops(buf, len(dims))
+	fmt.Fprintf(buf, "\tdim := C.Rf_allocVector(C.INTSXP, %d)\n\tC.Rf_protect(dim)\n", len(dims))
+	d := make([]string, len(dims))
+	for i, l := range dims {
+		d[i] = fmt.Sprint(l)
+	}
+	fmt.Fprintf(buf, "\t*(*[%d]int32)(unsafe.Pointer(C.INTEGER(dim))) = [%[1]d]int32{%s}\n", len(dims), strings.Join(d, ", "))
+	fmt.Fprintln(buf, "\tC.setAttrib(r, C.R_DimSymbol, dim)\n\tC.Rf_unprotect(2)\n\treturn r")
+}
+
+// packVectorBodyGo writes the body of a function to pack a slice, or a map
+// with string keys when named is true, of Go numbers of the given kind into
+// an R vector. Integer values that cannot be represented as R integers are
+// handled according to the overflow policy.
+func packVectorBodyGo(buf *bytes.Buffer, kind types.BasicKind, named bool, overflow string) {
+	v := vectorOf(kind)
+	if overflows(kind) {
+		switch overflow {
+		case "double":
+			v = vectorOf(types.Float64)
+		case "promote":
+			var double bytes.Buffer
+			writeVectorGo(&double, kind, named, vectorOf(types.Float64))
+			fmt.Fprintf(buf, "\tfor _, v := range p {\n\t\tif !%s {\n%s\t\t}\n\t}\n", intCall("fits", kind, "v"), reindent(double.String(), 2))
+		default:
+			fmt.Fprintf(buf, "\tfor _, v := range p {\n\t\t%s\n\t}\n", intCall("check", kind, "v"))
+		}
+	}
+	writeVectorGo(buf, kind, named, v)
+}
+
+// writeVectorGo writes statements packing the slice or map p of Go numbers
+// of the given kind into an R vector stored as v and returning it.
+func writeVectorGo(buf *bytes.Buffer, kind types.BasicKind, named bool, v rVector) {
+	if !named {
+		fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.%s, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	s := (*[%d]%s)(unsafe.Pointer(C.%s(r)))[:len(p):len(p)]
+`, v.sexptype, v.max, v.elem, v.accessor)
+		if nameOf(types.Typ[kind]) == v.elem {
+			fmt.Fprintln(buf, "\tcopy(s, p)")
+		} else {
+			fmt.Fprintf(buf, "\tfor i, v := range p {\n\t\ts[i] = %s(v)\n\t}\n", v.elem)
+		}
+		fmt.Fprint(buf, "\tC.Rf_unprotect(1)\n\treturn r\n")
+		return
+	}
+	fmt.Fprintf(buf, `	n := len(p)
+	r := C.Rf_allocVector(C.%[1]s, C.R_xlen_t(n))
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(names)
+	s := (*[%[2]d]%[3]s)(unsafe.Pointer(C.%[4]s(r)))[:len(p):len(p)]
+	var i C.R_xlen_t
+	for k, v := range p {
+		C.SET_STRING_ELT(names, i, mkChar(k))
+		s[i] = %[3]s(v)
+		i++
+	}
+	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
+	C.Rf_unprotect(2)
+	return r
+`, v.sexptype, v.max, v.elem, v.accessor)
+}
+
+// packStringsBodyGo writes the body of a function to pack a slice, or a map
+// with string keys when named is true, of Go strings into an R character
+// vector. Under the "raw" policy a list of raw vectors is returned when any
+// string cannot be held in a character vector.
+func packStringsBodyGo(buf *bytes.Buffer, named bool, policy string) {
+	if policy == "raw" {
+		var raw bytes.Buffer
+		writeStringsGo(&raw, named, true)
+		fmt.Fprintf(buf, "\tfor _, v := range p {\n\t\tif !validString(string(v)) {\n%s\t\t}\n\t}\n", reindent(raw.String(), 2))
+	}
+	writeStringsGo(buf, named, false)
+}
+
+// writeStringsGo writes statements packing the slice or map p of Go strings
+// into an R character vector, or into a list of raw vectors if raw is true,
+// and returning it.
+func writeStringsGo(buf *bytes.Buffer, named, raw bool) {
+	sexptype, set, val := "STRSXP", "SET_STRING_ELT", "mkChar(string(v))"
+	if raw {
+		sexptype, set, val = "VECSXP", "SET_VECTOR_ELT", "rawVector(string(v))"
+	}
+	if !named {
+		fmt.Fprintf(buf, `	r := C.Rf_allocVector(C.%s, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	for i, v := range p {
+		C.%s(r, C.R_xlen_t(i), %s)
+	}
+	C.Rf_unprotect(1)
+	return r
+`, sexptype, set, val)
+		return
+	}
+	fmt.Fprintf(buf, `	n := len(p)
+	r := C.Rf_allocVector(C.%s, C.R_xlen_t(n))
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(names)
+	var i C.R_xlen_t
+	for k, v := range p {
+		C.SET_STRING_ELT(names, i, mkChar(k))
+		C.%s(r, i, %s)
+		i++
+	}
+	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
+	C.Rf_unprotect(2)
+	return r
+`, sexptype, set, val)
+}
+
+// packErrorsBodyGo writes the body of a function to pack a slice, or a map
+// with string keys when named is true, of Go errors into an R character
+// vector holding the error messages. Nil errors are packed as NA.
+func packErrorsBodyGo(buf *bytes.Buffer, named bool) {
+	if !named {
+		fmt.Fprint(buf, `	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	for i, v := range p {
+		s := C.R_NaString
+		if v != nil {
+			s = mkChar(v.Error())
+		}
+		C.SET_STRING_ELT(r, C.R_xlen_t(i), s)
+	}
+	C.Rf_unprotect(1)
+	return r
+`)
+		return
+	}
+	fmt.Fprint(buf, `	n := len(p)
+	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(names)
+	var i C.R_xlen_t
+	for k, v := range p {
+		C.SET_STRING_ELT(names, i, mkChar(k))
+		s := C.R_NaString
+		if v != nil {
+			s = mkChar(v.Error())
+		}
+		C.SET_STRING_ELT(r, i, s)
+		i++
+	}
+	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
+	C.Rf_unprotect(2)
+	return r
+`)
+}
+
+// intCall returns a call to the generated helper named by prefix for the
+// Go integer expression v of the given kind; fitsInt or checkInt for
+// signed kinds and fitsUint or checkUint for unsigned kinds.
+func intCall(prefix string, kind types.BasicKind, v string) string {
+	if types.Typ[kind].Info()&types.IsUnsigned != 0 {
+		return fmt.Sprintf("%sUint(uint64(%s))", prefix, v)
+	}
+	return fmt.Sprintf("%sInt(int64(%s))", prefix, v)
+}
+
+// reindent returns src with each non-empty line indented by a further
+// n tabs.
+func reindent(src string, n int) string {
+	lines := strings.SplitAfter(src, "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			lines[i] = indent(n) + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// arrayLoops writes the opening of nested range loops over each dimension
+// of the array named v and returns the expression for the indexed element.
+// Loop indexes are named i0, i1, ... from the outermost loop.
+func arrayLoops(buf *bytes.Buffer, v string, n int) string {
+	ref := v
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(buf, "%sfor i%d := range %s {\n", indent(i+1), i, ref)
+		ref = fmt.Sprintf("%s[i%d]", ref, i)
+	}
+	return ref
+}
+
+// closeLoops writes the closing braces of n nested loops.
+func closeLoops(buf *bytes.Buffer, n int) {
+	for i := n; i > 0; i-- {
+		fmt.Fprintf(buf, "%s}\n", indent(i))
+	}
+}
+
+// arrayIndex returns the expression for the column-major index into an R
+// array with the given dimensions corresponding to the loop indexes written
+// by arrayLoops.
+func arrayIndex(dims []int64) string {
+	var buf strings.Builder
+	stride := int64(1)
+	for i, d := range dims {
+		if i == 0 {
+			buf.WriteString("i0")
+		} else {
+			fmt.Fprintf(&buf, "+%d*i%d", stride, i)
+		}
+		stride *= d
+	}
+	return buf.String()
+}
+
+// product returns the product of the values in dims.
+func product(dims []int64) int64 {
+	p := int64(1)
+	for _, d := range dims {
+		p *= d
+	}
+	return p
+}
+
+// rangeCheck returns a statement at the given indentation that checks
+// that the int32 variable v is in range for the given Go integer kind,
+// or the empty string if no check is needed.
+func rangeCheck(v string, kind types.BasicKind, depth int) string {
+	min, max, ok := intRange(kind)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%scheckRange(%s, %d, %d)\n", indent(depth), v, min, max)
+}
+
+// sexpTypeOf returns the R SEXPTYPE label of an R vector holding
+// values of the given Go element type.
+func sexpTypeOf(elem types.Type) string {
+	if basic, ok := elem.(*types.Basic); ok {
+		return vectorOf(basic.Kind()).sexptype
+	}
+	return "VECSXP"
+}
+
+// indent returns a string of n tabs.
+func indent(n int) string {
+	return strings.Repeat("\t", n)
+}
+
+// rVector describes the storage of an R vector holding
+// elements of a Go basic kind.
+type rVector struct {
+	sexptype string // R SEXPTYPE label.
+	accessor string // C function returning a pointer to the vector's data.
+	elem     string // Go type with the same memory layout as the R element.
+	max      int    // Maximum length array type for the element type.
+}
+
+// vectorOf returns the R vector storage details for the given kind. Character
+// vectors have no accessor since their elements are not directly addressable.
+func vectorOf(kind types.BasicKind) rVector {
+	switch kind {
+	case types.Bool:
+		return rVector{sexptype: "LGLSXP", accessor: "LOGICAL", elem: "int32", max: 1 << 47}
+	case types.Int, types.Int8, types.Int16, types.Int32, types.Uint, types.Uint16, types.Uint32:
+		return rVector{sexptype: "INTSXP", accessor: "INTEGER", elem: "int32", max: 1 << 47}
+	case types.Uint8:
+		return rVector{sexptype: "RAWSXP", accessor: "RAW", elem: "byte", max: 1 << 49}
+	case types.Float32, types.Float64:
+		return rVector{sexptype: "REALSXP", accessor: "REAL", elem: "float64", max: 1 << 46}
+	case types.Complex64, types.Complex128:
+		return rVector{sexptype: "CPLXSXP", accessor: "COMPLEX", elem: "complex128", max: 1 << 45}
+	case types.String:
+		return rVector{sexptype: "STRSXP"}
+	default:
+		panic(fmt.Sprintf("unhandled kind: %v", kind))
+	}
+}
+
+// fixedImports holds the import paths that are always imported by
+// the generated Go code.
+var fixedImports = map[string]bool{
+	"fmt":           true,
+	"log":           true,
+	"math":          true,
+	"os":            true,
+	"runtime/debug": true,
+	"strings":       true,
+	"sync":          true,
+	"unicode/utf8":  true,
+	"unsafe":        true,
+}
+
 func imports(info *pkg.Info) []string {
 	us := info.Pkg()
 	pkgs := make(map[string]bool)
@@ -797,7 +3365,7 @@ func imports(info *pkg.Info) []string {
 				continue
 			}
 			pkg := named.Obj().Pkg()
-			if pkg == nil || pkg == us {
+			if pkg == nil || pkg == us || fixedImports[pkg.Path()] {
 				continue
 			}
 			pkgs[pkg.Path()] = true
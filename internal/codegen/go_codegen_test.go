@@ -5,9 +5,12 @@
 package codegen
 
 import (
+	"go/ast"
 	"go/types"
 	"strings"
 	"testing"
+
+	"github.com/rgonomic/rgo/internal/pkg"
 )
 
 var mockPkg = types.NewPackage("path/to/pkg", "pkg")
@@ -25,14 +28,14 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Typ[types.String]},
 		wantUnpack: `func unpackSEXP_types_Basic_string(p C.SEXP) string {
+	checkSEXP(p, C.STRSXP, 1)
 	return C.R_gostring(p, 0)
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_string(p))
 }`,
 		wantPack: `func packSEXP_types_Basic_string(p string) C.SEXP {
-	s := C.Rf_mkCharLenCE(C._GoStringPtr(p), C.int(len(p)), C.CE_UTF8)
-	return C.ScalarString(s)
+	return C.ScalarString(mkChar(p))
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
 	return packSEXP_types_Basic_string(string(p))
@@ -42,27 +45,49 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Typ[types.Int32]},
 		wantUnpack: `func unpackSEXP_types_Basic_int32(p C.SEXP) int32 {
+	checkSEXP(p, C.INTSXP, 1)
 	return int32(*C.INTEGER(p))
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_int32(p))
 }`,
 		wantPack: `func packSEXP_types_Basic_int32(p int32) C.SEXP {
+	checkInt(int64(p))
 	return C.ScalarInteger(C.int(p))
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
 	return packSEXP_types_Basic_int32(int32(p))
+}`,
+	},
+	{
+		typs: []types.Type{types.Typ[types.Uint16]},
+		wantUnpack: `func unpackSEXP_types_Basic_uint16(p C.SEXP) uint16 {
+	checkSEXP(p, C.INTSXP, 1)
+	v := int32(*C.INTEGER(p))
+	checkRange(v, 0, 65535)
+	return uint16(v)
+}`,
+		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
+	return pkg.T(unpackSEXP_types_Basic_uint16(p))
+}`,
+		wantPack: `func packSEXP_types_Basic_uint16(p uint16) C.SEXP {
+	return C.ScalarInteger(C.int(p))
+}`,
+		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
+	return packSEXP_types_Basic_uint16(uint16(p))
 }`,
 	},
 	{
 		typs: []types.Type{types.Universe.Lookup("rune").Type()},
 		wantUnpack: `func unpackSEXP_types_Basic_rune(p C.SEXP) rune {
+	checkSEXP(p, C.INTSXP, 1)
 	return rune(*C.INTEGER(p))
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_rune(p))
 }`,
 		wantPack: `func packSEXP_types_Basic_rune(p rune) C.SEXP {
+	checkInt(int64(p))
 	return C.ScalarInteger(C.int(p))
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
@@ -73,13 +98,16 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Typ[types.Uint8]},
 		wantUnpack: `func unpackSEXP_types_Basic_uint8(p C.SEXP) uint8 {
-	return uint8(*C.RAW(p))
+	checkSEXP(p, C.INTSXP, 1)
+	v := int32(*C.INTEGER(p))
+	checkRange(v, 0, 255)
+	return uint8(v)
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_uint8(p))
 }`,
 		wantPack: `func packSEXP_types_Basic_uint8(p uint8) C.SEXP {
-	return C.ScalarRaw(C.Rbyte(p))
+	return C.ScalarInteger(C.int(p))
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
 	return packSEXP_types_Basic_uint8(uint8(p))
@@ -88,13 +116,16 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Universe.Lookup("byte").Type()},
 		wantUnpack: `func unpackSEXP_types_Basic_byte(p C.SEXP) byte {
-	return byte(*C.RAW(p))
+	checkSEXP(p, C.INTSXP, 1)
+	v := int32(*C.INTEGER(p))
+	checkRange(v, 0, 255)
+	return byte(v)
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_byte(p))
 }`,
 		wantPack: `func packSEXP_types_Basic_byte(p byte) C.SEXP {
-	return C.ScalarRaw(C.Rbyte(p))
+	return C.ScalarInteger(C.int(p))
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
 	return packSEXP_types_Basic_byte(byte(p))
@@ -104,6 +135,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Typ[types.Float64]},
 		wantUnpack: `func unpackSEXP_types_Basic_float64(p C.SEXP) float64 {
+	checkSEXP(p, C.REALSXP, 1)
 	return float64(*C.REAL(p))
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
@@ -120,13 +152,15 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Typ[types.Complex128]},
 		wantUnpack: `func unpackSEXP_types_Basic_complex128(p C.SEXP) complex128 {
+	checkSEXP(p, C.CPLXSXP, 1)
 	return complex128(*(*complex128)(unsafe.Pointer(C.COMPLEX(p))))
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_complex128(p))
 }`,
 		wantPack: `func packSEXP_types_Basic_complex128(p complex128) C.SEXP {
-	return C.ScalarComplex(C.struct_Rcomplex{r: C.double(real(p)), i: C.double(imag(p))})
+	c := complex128(p)
+	return C.ScalarComplex(*(*C.Rcomplex)(unsafe.Pointer(&c)))
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
 	return packSEXP_types_Basic_complex128(complex128(p))
@@ -136,7 +170,8 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.Typ[types.Bool]},
 		wantUnpack: `func unpackSEXP_types_Basic_bool(p C.SEXP) bool {
-	return *C.RAW(p) == 1
+	checkSEXP(p, C.LGLSXP, 1)
+	return *C.LOGICAL(p) == 1
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Basic_bool(p))
@@ -340,6 +375,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Typ[types.String], 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_string(p C.SEXP) [10]string {
+	checkSEXP(p, C.STRSXP, 10)
 	var a [10]string
 	copy(a[:], unpackSEXP_types_Slice___string(p))
 	return a
@@ -358,6 +394,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Typ[types.Int32], 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_int32(p C.SEXP) [10]int32 {
+	checkSEXP(p, C.INTSXP, 10)
 	var a [10]int32
 	copy(a[:], unpackSEXP_types_Slice___int32(p))
 	return a
@@ -375,6 +412,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Universe.Lookup("rune").Type(), 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_rune(p C.SEXP) [10]rune {
+	checkSEXP(p, C.INTSXP, 10)
 	var a [10]rune
 	copy(a[:], unpackSEXP_types_Slice___rune(p))
 	return a
@@ -393,6 +431,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Typ[types.Uint8], 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_uint8(p C.SEXP) [10]uint8 {
+	checkSEXP(p, C.RAWSXP, 10)
 	var a [10]uint8
 	copy(a[:], unpackSEXP_types_Slice___uint8(p))
 	return a
@@ -410,6 +449,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Universe.Lookup("byte").Type(), 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_byte(p C.SEXP) [10]byte {
+	checkSEXP(p, C.RAWSXP, 10)
 	var a [10]byte
 	copy(a[:], unpackSEXP_types_Slice___byte(p))
 	return a
@@ -428,6 +468,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Typ[types.Float64], 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_float64(p C.SEXP) [10]float64 {
+	checkSEXP(p, C.REALSXP, 10)
 	var a [10]float64
 	copy(a[:], unpackSEXP_types_Slice___float64(p))
 	return a
@@ -446,6 +487,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Typ[types.Complex128], 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_complex128(p C.SEXP) [10]complex128 {
+	checkSEXP(p, C.CPLXSXP, 10)
 	var a [10]complex128
 	copy(a[:], unpackSEXP_types_Slice___complex128(p))
 	return a
@@ -464,6 +506,7 @@ var sexpFuncGoTests = []struct {
 	{
 		typs: []types.Type{types.NewArray(types.Typ[types.Bool], 10)},
 		wantUnpack: `func unpackSEXP_types_Array__10_bool(p C.SEXP) [10]bool {
+	checkSEXP(p, C.LGLSXP, 10)
 	var a [10]bool
 	copy(a[:], unpackSEXP_types_Slice___bool(p))
 	return a
@@ -479,6 +522,84 @@ var sexpFuncGoTests = []struct {
 }`,
 	},
 
+	// Multi-dimensional array types.
+	{
+		typs: []types.Type{types.NewArray(types.NewArray(types.Typ[types.Float64], 3), 2)},
+		wantUnpack: `func unpackSEXP_types_Array__2__3_float64(p C.SEXP) [2][3]float64 {
+	checkSEXP(p, C.REALSXP, 6)
+	checkDim(p, 2, 3)
+	var r [2][3]float64
+	s := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(p)))[:6:6]
+	for i0 := range r {
+		for i1 := range r[i0] {
+			r[i0][i1] = float64(s[i0+2*i1])
+		}
+	}
+	return r
+}`,
+		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
+	return pkg.T(unpackSEXP_types_Array__2__3_float64(p))
+}`,
+		wantPack: `func packSEXP_types_Array__2__3_float64(p [2][3]float64) C.SEXP {
+	r := C.Rf_allocVector(C.REALSXP, 6)
+	C.Rf_protect(r)
+	s := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(r)))[:6:6]
+	for i0 := range p {
+		for i1 := range p[i0] {
+			s[i0+2*i1] = float64(p[i0][i1])
+		}
+	}
+	dim := C.Rf_allocVector(C.INTSXP, 2)
+	C.Rf_protect(dim)
+	*(*[2]int32)(unsafe.Pointer(C.INTEGER(dim))) = [2]int32{2, 3}
+	C.setAttrib(r, C.R_DimSymbol, dim)
+	C.Rf_unprotect(2)
+	return r
+}`,
+		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
+	return packSEXP_types_Array__2__3_float64([2][3]float64(p))
+}`,
+	},
+	{
+		typs: []types.Type{types.NewArray(types.NewArray(types.NewArray(types.Typ[types.String], 4), 3), 2)},
+		wantUnpack: `func unpackSEXP_types_Array__2__3__4_string(p C.SEXP) [2][3][4]string {
+	checkSEXP(p, C.STRSXP, 24)
+	checkDim(p, 2, 3, 4)
+	var r [2][3][4]string
+	for i0 := range r {
+		for i1 := range r[i0] {
+			for i2 := range r[i0][i1] {
+				r[i0][i1][i2] = string(C.R_gostring(p, C.R_xlen_t(i0+2*i1+6*i2)))
+			}
+		}
+	}
+	return r
+}`,
+		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
+	return pkg.T(unpackSEXP_types_Array__2__3__4_string(p))
+}`,
+		wantPack: `func packSEXP_types_Array__2__3__4_string(p [2][3][4]string) C.SEXP {
+	r := C.Rf_allocVector(C.STRSXP, 24)
+	C.Rf_protect(r)
+	for i0 := range p {
+		for i1 := range p[i0] {
+			for i2 := range p[i0][i1] {
+				C.SET_STRING_ELT(r, C.R_xlen_t(i0+2*i1+6*i2), mkChar(string(p[i0][i1][i2])))
+			}
+		}
+	}
+	dim := C.Rf_allocVector(C.INTSXP, 3)
+	C.Rf_protect(dim)
+	*(*[3]int32)(unsafe.Pointer(C.INTEGER(dim))) = [3]int32{2, 3, 4}
+	C.setAttrib(r, C.R_DimSymbol, dim)
+	C.Rf_unprotect(2)
+	return r
+}`,
+		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
+	return packSEXP_types_Array__2__3__4_string([2][3][4]string(p))
+}`,
+	},
+
 	// Slice types.
 	{
 		typs: []types.Type{types.NewSlice(types.Typ[types.String])},
@@ -486,6 +607,7 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.STRSXP, -1)
 	n := C.Rf_xlength(p)
 	r := make([]string, n)
 	for i := range r {
@@ -500,8 +622,7 @@ var sexpFuncGoTests = []struct {
 	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
 	for i, v := range p {
-		s := C.Rf_mkCharLenCE(C._GoStringPtr(string(v)), C.int(len(v)), C.CE_UTF8)
-		C.SET_STRING_ELT(r, C.R_xlen_t(i), s)
+		C.SET_STRING_ELT(r, C.R_xlen_t(i), mkChar(string(v)))
 	}
 	C.Rf_unprotect(1)
 	return r
@@ -517,6 +638,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.INTSXP, -1)
+	p = unshared(p)
 	n := C.Rf_xlength(p)
 	return (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(p)))[:n:n]
 }`,
@@ -524,6 +647,9 @@ var sexpFuncGoTests = []struct {
 	return pkg.T(unpackSEXP_types_Slice___int32(p))
 }`,
 		wantPack: `func packSEXP_types_Slice___int32(p []int32) C.SEXP {
+	for _, v := range p {
+		checkInt(int64(v))
+	}
 	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
 	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
@@ -541,6 +667,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.INTSXP, -1)
+	p = unshared(p)
 	n := C.Rf_xlength(p)
 	return (*[140737488355328]rune)(unsafe.Pointer(C.INTEGER(p)))[:n:n]
 }`,
@@ -548,9 +676,12 @@ var sexpFuncGoTests = []struct {
 	return pkg.T(unpackSEXP_types_Slice___rune(p))
 }`,
 		wantPack: `func packSEXP_types_Slice___rune(p []rune) C.SEXP {
+	for _, v := range p {
+		checkInt(int64(v))
+	}
 	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
-	s := (*[140737488355328]rune)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
+	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
 	copy(s, p)
 	C.Rf_unprotect(1)
 	return r
@@ -566,6 +697,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.RAWSXP, -1)
+	p = unshared(p)
 	n := C.Rf_xlength(p)
 	return (*[562949953421312]uint8)(unsafe.Pointer(C.RAW(p)))[:n:n]
 }`,
@@ -590,6 +723,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.RAWSXP, -1)
+	p = unshared(p)
 	n := C.Rf_xlength(p)
 	return (*[562949953421312]byte)(unsafe.Pointer(C.RAW(p)))[:n:n]
 }`,
@@ -615,6 +750,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.REALSXP, -1)
+	p = unshared(p)
 	n := C.Rf_xlength(p)
 	return (*[70368744177664]float64)(unsafe.Pointer(C.REAL(p)))[:n:n]
 }`,
@@ -640,6 +777,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.CPLXSXP, -1)
+	p = unshared(p)
 	n := C.Rf_xlength(p)
 	return (*[35184372088832]complex128)(unsafe.Pointer(C.COMPLEX(p)))[:n:n]
 }`,
@@ -649,7 +788,7 @@ var sexpFuncGoTests = []struct {
 		wantPack: `func packSEXP_types_Slice___complex128(p []complex128) C.SEXP {
 	r := C.Rf_allocVector(C.CPLXSXP, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
-	s := (*[35184372088832]complex128)(unsafe.Pointer(C.CPLXSXP(r)))[:len(p):len(p)]
+	s := (*[35184372088832]complex128)(unsafe.Pointer(C.COMPLEX(r)))[:len(p):len(p)]
 	copy(s, p)
 	C.Rf_unprotect(1)
 	return r
@@ -665,9 +804,10 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.LGLSXP, -1)
 	n := C.Rf_xlength(p)
 	r := make([]bool, n)
-	for i, b := range (*[140737488355328]int32)(unsafe.Pointer(C.BOOL(p)))[:n] {
+	for i, b := range (*[140737488355328]int32)(unsafe.Pointer(C.LOGICAL(p)))[:n] {
 		r[i] = (b == 1)
 	}
 	return r
@@ -678,7 +818,7 @@ var sexpFuncGoTests = []struct {
 		wantPack: `func packSEXP_types_Slice___bool(p []bool) C.SEXP {
 	r := C.Rf_allocVector(C.LGLSXP, C.R_xlen_t(len(p)))
 	C.Rf_protect(r)
-	s := (*[140737488355328]bool)(unsafe.Pointer(C.LOGICAL(r)))[:len(p):len(p)]
+	s := (*[140737488355328]int32)(unsafe.Pointer(C.LOGICAL(r)))[:len(p):len(p)]
 	for i, v := range p {
 		if v {
 			s[i] = 1
@@ -701,6 +841,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.STRSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]string, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -721,8 +863,8 @@ var sexpFuncGoTests = []struct {
 	C.Rf_protect(names)
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
-		C.SET_STRING_ELT(r, i, packSEXP_types_Basic_string(v))
+		C.SET_STRING_ELT(names, i, mkChar(k))
+		C.SET_STRING_ELT(r, i, mkChar(string(v)))
 		i++
 	}
 	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
@@ -740,6 +882,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.INTSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]int32, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -754,6 +898,9 @@ var sexpFuncGoTests = []struct {
 	return pkg.T(unpackSEXP_types_Map_map_string_int32(p))
 }`,
 		wantPack: `func packSEXP_types_Map_map_string_int32(p map[string]int32) C.SEXP {
+	for _, v := range p {
+		checkInt(int64(v))
+	}
 	n := len(p)
 	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(n))
 	C.Rf_protect(r)
@@ -762,7 +909,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		s[i] = int32(v)
 		i++
 	}
@@ -780,6 +927,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.INTSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]rune, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -794,6 +943,9 @@ var sexpFuncGoTests = []struct {
 	return pkg.T(unpackSEXP_types_Map_map_string_rune(p))
 }`,
 		wantPack: `func packSEXP_types_Map_map_string_rune(p map[string]rune) C.SEXP {
+	for _, v := range p {
+		checkInt(int64(v))
+	}
 	n := len(p)
 	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(n))
 	C.Rf_protect(r)
@@ -802,7 +954,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		s[i] = int32(v)
 		i++
 	}
@@ -821,6 +973,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.RAWSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]uint8, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -843,7 +997,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[562949953421312]uint8)(unsafe.Pointer(C.RAW(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		i++
 	}
 	copy(s, p)
@@ -861,6 +1015,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.RAWSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]byte, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -883,7 +1039,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[562949953421312]uint8)(unsafe.Pointer(C.RAW(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		i++
 	}
 	copy(s, p)
@@ -902,6 +1058,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.REALSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]float64, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -924,7 +1082,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		s[i] = float64(v)
 		i++
 	}
@@ -943,6 +1101,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.CPLXSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]complex128, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -965,7 +1125,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[35184372088832]complex128)(unsafe.Pointer(C.COMPLEX(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		s[i] = complex128(v)
 		i++
 	}
@@ -984,6 +1144,8 @@ var sexpFuncGoTests = []struct {
 	if C.Rf_isNull(p) != 0 {
 		return nil
 	}
+	checkSEXP(p, C.LGLSXP, -1)
+	checkNames(p)
 	n := int(C.Rf_xlength(p))
 	r := make(map[string]bool, n)
 	names := C.getAttrib(p, C.R_NamesSymbol)
@@ -1006,7 +1168,7 @@ var sexpFuncGoTests = []struct {
 	s := (*[140737488355328]int32)(unsafe.Pointer(C.LOGICAL(r)))[:len(p):len(p)]
 	var i C.R_xlen_t
 	for k, v := range p {
-		C.SET_STRING_ELT(names, i, C.Rf_mkCharLenCE(C._GoStringPtr(k), C.int(len(k)), C.CE_UTF8))
+		C.SET_STRING_ELT(names, i, mkChar(k))
 		if v {
 			s[i] = 1
 		} else {
@@ -1030,47 +1192,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Typ[types.String], false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_string__rgo___Rname_____F2_string_(p C.SEXP) struct{F1 string "rgo:\"Rname\""; F2 string} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 string \"rgo:\\\"Rname\\\"\"; F2 string}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 string \"rgo:\\\"Rname\\\"\"; F2 string}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 string "rgo:\"Rname\""; F2 string}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_string(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_string(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_string(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_string(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_string__rgo___Rname_____F2_string_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_string__rgo___Rname_____F2_string_(p struct{F1 string "rgo:\"Rname\""; F2 string}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_string(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_string(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_string(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_string(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1085,47 +1245,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Typ[types.Int32], false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_int32__rgo___Rname_____F2_int32_(p C.SEXP) struct{F1 int32 "rgo:\"Rname\""; F2 int32} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 int32 \"rgo:\\\"Rname\\\"\"; F2 int32}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 int32 \"rgo:\\\"Rname\\\"\"; F2 int32}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 int32 "rgo:\"Rname\""; F2 int32}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_int32(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_int32(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_int32(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_int32(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_int32__rgo___Rname_____F2_int32_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_int32__rgo___Rname_____F2_int32_(p struct{F1 int32 "rgo:\"Rname\""; F2 int32}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_int32(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_int32(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_int32(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_int32(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1139,47 +1297,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Universe.Lookup("rune").Type(), false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_rune__rgo___Rname_____F2_rune_(p C.SEXP) struct{F1 rune "rgo:\"Rname\""; F2 rune} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 rune \"rgo:\\\"Rname\\\"\"; F2 rune}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 rune \"rgo:\\\"Rname\\\"\"; F2 rune}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 rune "rgo:\"Rname\""; F2 rune}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_rune(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_rune(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_rune(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_rune(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_rune__rgo___Rname_____F2_rune_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_rune__rgo___Rname_____F2_rune_(p struct{F1 rune "rgo:\"Rname\""; F2 rune}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_rune(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_rune(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_rune(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_rune(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1194,47 +1350,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Typ[types.Uint8], false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_uint8__rgo___Rname_____F2_uint8_(p C.SEXP) struct{F1 uint8 "rgo:\"Rname\""; F2 uint8} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 uint8 \"rgo:\\\"Rname\\\"\"; F2 uint8}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 uint8 \"rgo:\\\"Rname\\\"\"; F2 uint8}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 uint8 "rgo:\"Rname\""; F2 uint8}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_uint8(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_uint8(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_uint8(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_uint8(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_uint8__rgo___Rname_____F2_uint8_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_uint8__rgo___Rname_____F2_uint8_(p struct{F1 uint8 "rgo:\"Rname\""; F2 uint8}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_uint8(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_uint8(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_uint8(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_uint8(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1248,47 +1402,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Universe.Lookup("byte").Type(), false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_byte__rgo___Rname_____F2_byte_(p C.SEXP) struct{F1 byte "rgo:\"Rname\""; F2 byte} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 byte \"rgo:\\\"Rname\\\"\"; F2 byte}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 byte \"rgo:\\\"Rname\\\"\"; F2 byte}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 byte "rgo:\"Rname\""; F2 byte}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_byte(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_byte(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_byte(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_byte(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_byte__rgo___Rname_____F2_byte_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_byte__rgo___Rname_____F2_byte_(p struct{F1 byte "rgo:\"Rname\""; F2 byte}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_byte(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_byte(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_byte(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_byte(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1303,47 +1455,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Typ[types.Float64], false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_float64__rgo___Rname_____F2_float64_(p C.SEXP) struct{F1 float64 "rgo:\"Rname\""; F2 float64} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 float64 \"rgo:\\\"Rname\\\"\"; F2 float64}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 float64 \"rgo:\\\"Rname\\\"\"; F2 float64}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 float64 "rgo:\"Rname\""; F2 float64}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_float64(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_float64(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_float64(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_float64(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_float64__rgo___Rname_____F2_float64_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_float64__rgo___Rname_____F2_float64_(p struct{F1 float64 "rgo:\"Rname\""; F2 float64}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_float64(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_float64(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_float64(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_float64(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1358,47 +1508,45 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Typ[types.Complex128], false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_complex128__rgo___Rname_____F2_complex128_(p C.SEXP) struct{F1 complex128 "rgo:\"Rname\""; F2 complex128} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 complex128 \"rgo:\\\"Rname\\\"\"; F2 complex128}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 complex128 \"rgo:\\\"Rname\\\"\"; F2 complex128}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 complex128 "rgo:\"Rname\""; F2 complex128}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_complex128(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_complex128(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_complex128(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_complex128(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_complex128__rgo___Rname_____F2_complex128_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_complex128__rgo___Rname_____F2_complex128_(p struct{F1 complex128 "rgo:\"Rname\""; F2 complex128}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_complex128(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_complex128(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_complex128(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_complex128(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
@@ -1413,59 +1561,109 @@ var sexpFuncGoTests = []struct {
 			types.NewField(0, mockPkg, "F2", types.Typ[types.Bool], false),
 		}, []string{`rgo:"Rname"`})},
 		wantUnpack: `func unpackSEXP_types_Struct_struct_F1_bool__rgo___Rname_____F2_bool_(p C.SEXP) struct{F1 bool "rgo:\"Rname\""; F2 bool} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
 	switch n := C.Rf_xlength(p); {
 	case n < 2:
-		panic(` + "`missing list element for struct{F1 bool \"rgo:\\\"Rname\\\"\"; F2 bool}`" + `)
+		panic(&typeError{want: "list of length at least 2", got: describe(C.VECSXP, int(n))})
 	case n > 2:
-		err := C.CString(` + "`extra list element ignored for struct{F1 bool \"rgo:\\\"Rname\\\"\"; F2 bool}`" + `)
-		C.R_error(err)
-		C.free(unsafe.Pointer(err))
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
 	}
 	var r struct{F1 bool "rgo:\"Rname\""; F2 bool}
-	var i C.int
+	var i C.R_xlen_t
 	key_Rname := C.CString("Rname")
 	defer C.free(unsafe.Pointer(key_Rname))
 	i = C.getListElementIndex(p, key_Rname)
 	if i < 0 {
-		panic("no list element for field: F1")
+		panic(&typeError{want: "list with element \"Rname\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F1 = unpackSEXP_types_Basic_bool(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F1 = unpackSEXP_types_Basic_bool(C.VECTOR_ELT(p, i))
 	key_F2 := C.CString("F2")
 	defer C.free(unsafe.Pointer(key_F2))
 	i = C.getListElementIndex(p, key_F2)
 	if i < 0 {
-		panic("no list element for field: F2")
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
 	}
-	r.F2 = unpackSEXP_types_Basic_bool(C.VECTOR_ELT(p, C.R_xlen_t(i)))
+	r.F2 = unpackSEXP_types_Basic_bool(C.VECTOR_ELT(p, i))
 	return r
 }`,
 		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
 	return pkg.T(unpackSEXP_types_Struct_struct_F1_bool__rgo___Rname_____F2_bool_(p))
 }`,
 		wantPack: `func packSEXP_types_Struct_struct_F1_bool__rgo___Rname_____F2_bool_(p struct{F1 bool "rgo:\"Rname\""; F2 bool}) C.SEXP {
-	r := C.allocList(2)
+	r := C.Rf_allocVector(C.VECSXP, 2)
 	C.Rf_protect(r)
 	names := C.Rf_allocVector(C.STRSXP, 2)
 	C.Rf_protect(names)
-	arg := r
 	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`Rname`" + `), 5, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_bool(p.F1))
-	arg = C.CDR(arg)
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_bool(p.F1))
 	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
-	C.SETCAR(arg, packSEXP_types_Basic_bool(p.F2))
-	C.setAttrib(r, packSEXP_types_Basic_string(` + "`names`" + `), names)
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_bool(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
 	C.Rf_unprotect(2)
 	return r
 }`,
 		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
 	return packSEXP_types_Struct_struct_F1_bool__rgo___Rname_____F2_bool_(struct{F1 bool "rgo:\"Rname\""; F2 bool}(p))
+}`,
+	},
+
+	{
+		typs: []types.Type{types.NewStruct([]*types.Var{
+			types.NewField(0, mockPkg, "F1", types.NewSlice(types.Typ[types.Float64]), false),
+			types.NewField(0, mockPkg, "F2", types.Typ[types.Int], false),
+		}, nil)},
+		wantUnpack: `func unpackSEXP_types_Struct_struct_F1___float64__F2_int_(p C.SEXP) struct{F1 []float64; F2 int} {
+	checkSEXP(p, C.VECSXP, -1)
+	checkNames(p)
+	switch n := C.Rf_xlength(p); {
+	case n < 1:
+		panic(&typeError{want: "list of length at least 1", got: describe(C.VECSXP, int(n))})
+	case n > 2:
+		panic(&typeError{want: "list of length at most 2", got: describe(C.VECSXP, int(n))})
+	}
+	var r struct{F1 []float64; F2 int}
+	var i C.R_xlen_t
+	key_F1 := C.CString("F1")
+	defer C.free(unsafe.Pointer(key_F1))
+	i = C.getListElementIndex(p, key_F1)
+	if i >= 0 {
+		r.F1 = unpackSEXP_types_Slice___float64(C.VECTOR_ELT(p, i))
+	}
+	key_F2 := C.CString("F2")
+	defer C.free(unsafe.Pointer(key_F2))
+	i = C.getListElementIndex(p, key_F2)
+	if i < 0 {
+		panic(&typeError{want: "list with element \"F2\"", got: describe(C.VECSXP, -1) + " without it"})
+	}
+	r.F2 = unpackSEXP_types_Basic_int(C.VECTOR_ELT(p, i))
+	return r
+}`,
+		wantUnpackNamed: `func unpackSEXP_types_Named_path_to_pkg_T(p C.SEXP) pkg.T {
+	return pkg.T(unpackSEXP_types_Struct_struct_F1___float64__F2_int_(p))
+}`,
+		wantPack: `func packSEXP_types_Struct_struct_F1___float64__F2_int_(p struct{F1 []float64; F2 int}) C.SEXP {
+	r := C.Rf_allocVector(C.VECSXP, 2)
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, 2)
+	C.Rf_protect(names)
+	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F1`" + `), 2, C.CE_UTF8))
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Slice___float64(p.F1))
+	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr(` + "`F2`" + `), 2, C.CE_UTF8))
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Basic_int(p.F2))
+	C.setAttrib(r, C.R_NamesSymbol, names)
+	C.Rf_unprotect(2)
+	return r
+}`,
+		wantPackNamed: `func packSEXP_types_Named_path_to_pkg_T(p pkg.T) C.SEXP {
+	return packSEXP_types_Struct_struct_F1___float64__F2_int_(struct{F1 []float64; F2 int}(p))
 }`,
 	},
 }
 
 func TestUnpackSEXPFuncGo(t *testing.T) {
 	for i, test := range sexpFuncGoTests {
-		got := strings.TrimSpace(unpackSEXPFuncGo(test.typs))
+		got := strings.TrimSpace(unpackSEXPFuncGo(test.typs, unpackPolicy{zeroCopy: "share"}))
 		if got != test.wantUnpack {
 			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.wantUnpack)
 		}
@@ -1476,7 +1674,7 @@ func TestUnpackSEXPFuncGo(t *testing.T) {
 		for j, u := range test.typs {
 			typs[j] = types.NewNamed(types.NewTypeName(0, mockPkg, "T", nil), u, nil)
 		}
-		got := strings.TrimSpace(unpackSEXPFuncGo(typs))
+		got := strings.TrimSpace(unpackSEXPFuncGo(typs, unpackPolicy{zeroCopy: "share"}))
 		if got != test.wantUnpackNamed {
 			t.Errorf("unexpected result for named type test %d:\ngot:\n%s\nwant:\n%s", i, got, test.wantUnpackNamed)
 		}
@@ -1485,7 +1683,7 @@ func TestUnpackSEXPFuncGo(t *testing.T) {
 
 func TestPackSEXPFuncGo(t *testing.T) {
 	for i, test := range sexpFuncGoTests {
-		got := strings.TrimSpace(packSEXPFuncGo(test.typs))
+		got := strings.TrimSpace(packSEXPFuncGo(test.typs, packPolicy{overflow: "error", strings: "error"}))
 		if got != test.wantPack {
 			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.wantPack)
 		}
@@ -1496,9 +1694,1006 @@ func TestPackSEXPFuncGo(t *testing.T) {
 		for j, u := range test.typs {
 			typs[j] = types.NewNamed(types.NewTypeName(0, mockPkg, "T", nil), u, nil)
 		}
-		got := strings.TrimSpace(packSEXPFuncGo(typs))
+		got := strings.TrimSpace(packSEXPFuncGo(typs, packPolicy{overflow: "error", strings: "error"}))
 		if got != test.wantPackNamed {
 			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.wantPackNamed)
 		}
 	}
 }
+
+var packErrorsTests = []struct {
+	typ  types.Type
+	want string
+}{
+	{
+		typ: types.NewSlice(types.Universe.Lookup("error").Type()),
+		want: `func packSEXP_types_Slice___error(p []error) C.SEXP {
+	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	for i, v := range p {
+		s := C.R_NaString
+		if v != nil {
+			s = mkChar(v.Error())
+		}
+		C.SET_STRING_ELT(r, C.R_xlen_t(i), s)
+	}
+	C.Rf_unprotect(1)
+	return r
+}`,
+	},
+	{
+		typ: types.NewMap(types.Typ[types.String], types.Universe.Lookup("error").Type()),
+		want: `func packSEXP_types_Map_map_string_error(p map[string]error) C.SEXP {
+	n := len(p)
+	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(names)
+	var i C.R_xlen_t
+	for k, v := range p {
+		C.SET_STRING_ELT(names, i, mkChar(k))
+		s := C.R_NaString
+		if v != nil {
+			s = mkChar(v.Error())
+		}
+		C.SET_STRING_ELT(r, i, s)
+		i++
+	}
+	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
+	C.Rf_unprotect(2)
+	return r
+}`,
+	},
+}
+
+func TestPackErrors(t *testing.T) {
+	for i, test := range packErrorsTests {
+		got := strings.TrimSpace(packSEXPFuncGo([]types.Type{test.typ}, packPolicy{overflow: "error", strings: "error"}))
+		if got != test.want {
+			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.want)
+		}
+	}
+}
+
+var packPolicyTests = []struct {
+	policy packPolicy
+	typ    types.Type
+	want   string
+}{
+	{
+		policy: packPolicy{overflow: "promote", strings: "error"},
+		typ:    types.Typ[types.Int],
+		want: `func packSEXP_types_Basic_int(p int) C.SEXP {
+	if !fitsInt(int64(p)) {
+		return C.ScalarReal(C.double(p))
+	}
+	return C.ScalarInteger(C.int(p))
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "double", strings: "error"},
+		typ:    types.Typ[types.Uint32],
+		want: `func packSEXP_types_Basic_uint32(p uint32) C.SEXP {
+	return C.ScalarReal(C.double(p))
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "error", strings: "error"},
+		typ:    types.NewSlice(types.Typ[types.Uint]),
+		want: `func packSEXP_types_Slice___uint(p []uint) C.SEXP {
+	for _, v := range p {
+		checkUint(uint64(v))
+	}
+	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
+	for i, v := range p {
+		s[i] = int32(v)
+	}
+	C.Rf_unprotect(1)
+	return r
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "promote", strings: "error"},
+		typ:    types.NewSlice(types.Typ[types.Uint]),
+		want: `func packSEXP_types_Slice___uint(p []uint) C.SEXP {
+	for _, v := range p {
+		if !fitsUint(uint64(v)) {
+			r := C.Rf_allocVector(C.REALSXP, C.R_xlen_t(len(p)))
+			C.Rf_protect(r)
+			s := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(r)))[:len(p):len(p)]
+			for i, v := range p {
+				s[i] = float64(v)
+			}
+			C.Rf_unprotect(1)
+			return r
+		}
+	}
+	r := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:len(p):len(p)]
+	for i, v := range p {
+		s[i] = int32(v)
+	}
+	C.Rf_unprotect(1)
+	return r
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "double", strings: "error"},
+		typ:    types.NewMap(types.Typ[types.String], types.Typ[types.Int]),
+		want: `func packSEXP_types_Map_map_string_int(p map[string]int) C.SEXP {
+	n := len(p)
+	r := C.Rf_allocVector(C.REALSXP, C.R_xlen_t(n))
+	C.Rf_protect(r)
+	names := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(n))
+	C.Rf_protect(names)
+	s := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(r)))[:len(p):len(p)]
+	var i C.R_xlen_t
+	for k, v := range p {
+		C.SET_STRING_ELT(names, i, mkChar(k))
+		s[i] = float64(v)
+		i++
+	}
+	C.setAttrib(r, packSEXP_types_Basic_string("names"), names)
+	C.Rf_unprotect(2)
+	return r
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "promote", strings: "error"},
+		typ:    types.NewArray(types.NewArray(types.Typ[types.Int], 3), 2),
+		want: `func packSEXP_types_Array__2__3_int(p [2][3]int) C.SEXP {
+	promote := false
+	for i0 := range p {
+		for i1 := range p[i0] {
+			promote = promote || !fitsInt(int64(p[i0][i1]))
+		}
+	}
+	if promote {
+		r := C.Rf_allocVector(C.REALSXP, 6)
+		C.Rf_protect(r)
+		s := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(r)))[:6:6]
+		for i0 := range p {
+			for i1 := range p[i0] {
+				s[i0+2*i1] = float64(p[i0][i1])
+			}
+		}
+		dim := C.Rf_allocVector(C.INTSXP, 2)
+		C.Rf_protect(dim)
+		*(*[2]int32)(unsafe.Pointer(C.INTEGER(dim))) = [2]int32{2, 3}
+		C.setAttrib(r, C.R_DimSymbol, dim)
+		C.Rf_unprotect(2)
+		return r
+	}
+	r := C.Rf_allocVector(C.INTSXP, 6)
+	C.Rf_protect(r)
+	s := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(r)))[:6:6]
+	for i0 := range p {
+		for i1 := range p[i0] {
+			s[i0+2*i1] = int32(p[i0][i1])
+		}
+	}
+	dim := C.Rf_allocVector(C.INTSXP, 2)
+	C.Rf_protect(dim)
+	*(*[2]int32)(unsafe.Pointer(C.INTEGER(dim))) = [2]int32{2, 3}
+	C.setAttrib(r, C.R_DimSymbol, dim)
+	C.Rf_unprotect(2)
+	return r
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "error", strings: "raw"},
+		typ:    types.Typ[types.String],
+		want: `func packSEXP_types_Basic_string(p string) C.SEXP {
+	if !validString(p) {
+		return rawVector(p)
+	}
+	return C.ScalarString(mkChar(p))
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "error", strings: "raw"},
+		typ:    types.NewSlice(types.Typ[types.String]),
+		want: `func packSEXP_types_Slice___string(p []string) C.SEXP {
+	for _, v := range p {
+		if !validString(string(v)) {
+			r := C.Rf_allocVector(C.VECSXP, C.R_xlen_t(len(p)))
+			C.Rf_protect(r)
+			for i, v := range p {
+				C.SET_VECTOR_ELT(r, C.R_xlen_t(i), rawVector(string(v)))
+			}
+			C.Rf_unprotect(1)
+			return r
+		}
+	}
+	r := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(p)))
+	C.Rf_protect(r)
+	for i, v := range p {
+		C.SET_STRING_ELT(r, C.R_xlen_t(i), mkChar(string(v)))
+	}
+	C.Rf_unprotect(1)
+	return r
+}`,
+	},
+	{
+		policy: packPolicy{overflow: "error", strings: "raw"},
+		typ:    types.NewArray(types.NewArray(types.Typ[types.String], 2), 2),
+		want: `func packSEXP_types_Array__2__2_string(p [2][2]string) C.SEXP {
+	raw := false
+	for i0 := range p {
+		for i1 := range p[i0] {
+			raw = raw || !validString(string(p[i0][i1]))
+		}
+	}
+	if raw {
+		r := C.Rf_allocVector(C.VECSXP, 4)
+		C.Rf_protect(r)
+		for i0 := range p {
+			for i1 := range p[i0] {
+				C.SET_VECTOR_ELT(r, C.R_xlen_t(i0+2*i1), rawVector(string(p[i0][i1])))
+			}
+		}
+		dim := C.Rf_allocVector(C.INTSXP, 2)
+		C.Rf_protect(dim)
+		*(*[2]int32)(unsafe.Pointer(C.INTEGER(dim))) = [2]int32{2, 2}
+		C.setAttrib(r, C.R_DimSymbol, dim)
+		C.Rf_unprotect(2)
+		return r
+	}
+	r := C.Rf_allocVector(C.STRSXP, 4)
+	C.Rf_protect(r)
+	for i0 := range p {
+		for i1 := range p[i0] {
+			C.SET_STRING_ELT(r, C.R_xlen_t(i0+2*i1), mkChar(string(p[i0][i1])))
+		}
+	}
+	dim := C.Rf_allocVector(C.INTSXP, 2)
+	C.Rf_protect(dim)
+	*(*[2]int32)(unsafe.Pointer(C.INTEGER(dim))) = [2]int32{2, 2}
+	C.setAttrib(r, C.R_DimSymbol, dim)
+	C.Rf_unprotect(2)
+	return r
+}`,
+	},
+}
+
+func TestPackPolicy(t *testing.T) {
+	for i, test := range packPolicyTests {
+		got := strings.TrimSpace(packSEXPFuncGo([]types.Type{test.typ}, test.policy))
+		if got != test.want {
+			t.Errorf("unexpected result for test %d with %+v policy:\ngot:\n%s\nwant:\n%s", i, test.policy, got, test.want)
+		}
+	}
+}
+
+var unpackPolicyTests = []struct {
+	policy unpackPolicy
+	typ    types.Type
+	want   string
+}{
+	{
+		policy: unpackPolicy{zeroCopy: "copy"},
+		typ:    types.NewSlice(types.Typ[types.Float64]),
+		want: `func unpackSEXP_types_Slice___float64(p C.SEXP) []float64 {
+	if C.Rf_isNull(p) != 0 {
+		return nil
+	}
+	checkSEXP(p, C.REALSXP, -1)
+	n := C.Rf_xlength(p)
+	r := make([]float64, n)
+	copy(r, (*[70368744177664]float64)(unsafe.Pointer(C.REAL(p)))[:n:n])
+	return r
+}`,
+	},
+	{
+		policy: unpackPolicy{zeroCopy: "preserve"},
+		typ:    types.NewSlice(types.Typ[types.Int32]),
+		want: `func unpackSEXP_types_Slice___int32(p C.SEXP) []int32 {
+	if C.Rf_isNull(p) != 0 {
+		return nil
+	}
+	checkSEXP(p, C.INTSXP, -1)
+	p = unshared(p)
+	n := C.Rf_xlength(p)
+	preserve(p)
+	return (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(p)))[:n:n]
+}`,
+	},
+	{
+		policy: unpackPolicy{zeroCopy: "poison"},
+		typ:    types.NewSlice(types.Typ[types.Complex128]),
+		want: `func unpackSEXP_types_Slice___complex128(p C.SEXP) []complex128 {
+	if C.Rf_isNull(p) != 0 {
+		return nil
+	}
+	checkSEXP(p, C.CPLXSXP, -1)
+	n := C.Rf_xlength(p)
+	return (*[35184372088832]complex128)(viewOf(unsafe.Pointer(C.COMPLEX(p)), int(n)*16))[:n:n]
+}`,
+	},
+	{
+		policy: unpackPolicy{zeroCopy: "preserve"},
+		typ:    types.Typ[types.String],
+		want: `func unpackSEXP_types_Basic_string(p C.SEXP) string {
+	checkSEXP(p, C.STRSXP, 1)
+	return gostring(p, 0)
+}`,
+	},
+	{
+		policy: unpackPolicy{zeroCopy: "copy"},
+		typ:    types.NewMap(types.Typ[types.String], types.Typ[types.String]),
+		want: `func unpackSEXP_types_Map_map_string_string(p C.SEXP) map[string]string {
+	if C.Rf_isNull(p) != 0 {
+		return nil
+	}
+	checkSEXP(p, C.STRSXP, -1)
+	checkNames(p)
+	n := int(C.Rf_xlength(p))
+	r := make(map[string]string, n)
+	names := C.getAttrib(p, C.R_NamesSymbol)
+	for i := 0; i < n; i++ {
+		key := string(gostring(names, C.R_xlen_t(i)))
+		r[key] = string(gostring(p, C.R_xlen_t(i)))
+	}
+	return r
+}`,
+	},
+}
+
+func TestUnpackPolicy(t *testing.T) {
+	for i, test := range unpackPolicyTests {
+		got := strings.TrimSpace(unpackSEXPFuncGo([]types.Type{test.typ}, test.policy))
+		if got != test.want {
+			t.Errorf("unexpected result for test %d with %+v policy:\ngot:\n%s\nwant:\n%s", i, test.policy, got, test.want)
+		}
+	}
+}
+
+var vectorisedBodyTests = []struct {
+	params []*types.Var
+	result types.Type
+	want   string
+}{
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.Typ[types.Float64]),
+		},
+		result: types.Typ[types.Bool],
+		want: `_arg = "x"
+	checkSEXP(_R_x, C.REALSXP, -1)
+	_l0 := int(C.Rf_xlength(_R_x))
+	_x0 := (*[70368744177664]float64)(unsafe.Pointer(C.REAL(_R_x)))[:_l0:_l0]
+	_n := recycledLength(_l0)
+	_r := make([]bool, _n)
+	_na := make([]bool, _n)
+	for _i := range _r {
+		_e0 := _x0[_i%_l0]
+		if isNA(_e0) {
+			_na[_i] = true
+			continue
+		}
+		_r[_i] = bool(pkg.F(float64(_e0)))
+	}
+	return setNA(packSEXP_types_Slice___bool(_r), _na)`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "n", types.Typ[types.Int8]),
+			types.NewParam(0, mockPkg, "s", types.Typ[types.String]),
+		},
+		result: types.Typ[types.Uint8],
+		want: `_arg = "n"
+	checkSEXP(_R_n, C.INTSXP, -1)
+	_l0 := int(C.Rf_xlength(_R_n))
+	_x0 := (*[140737488355328]int32)(unsafe.Pointer(C.INTEGER(_R_n)))[:_l0:_l0]
+	_arg = "s"
+	checkSEXP(_R_s, C.STRSXP, -1)
+	_l1 := int(C.Rf_xlength(_R_s))
+	_n := recycledLength(_l0, _l1)
+	_r := make([]uint16, _n)
+	_na := make([]bool, _n)
+	for _i := range _r {
+		_e0 := _x0[_i%_l0]
+		_e1 := C.STRING_ELT(_R_s, C.R_xlen_t(_i%_l1))
+		if _e0 == naInt || _e1 == C.R_NaString {
+			_na[_i] = true
+			continue
+		}
+		_arg = "n"
+		checkRange(_e0, -128, 127)
+		_r[_i] = uint16(pkg.F(int8(_e0), string(C.R_gostring(_R_s, C.R_xlen_t(_i%_l1)))))
+	}
+	return setNA(packSEXP_types_Slice___uint16(_r), _na)`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "b", types.Typ[types.Bool]),
+			types.NewParam(0, mockPkg, "c", types.Typ[types.Complex128]),
+		},
+		result: types.Typ[types.String],
+		want: `_arg = "b"
+	checkSEXP(_R_b, C.LGLSXP, -1)
+	_l0 := int(C.Rf_xlength(_R_b))
+	_x0 := (*[140737488355328]int32)(unsafe.Pointer(C.LOGICAL(_R_b)))[:_l0:_l0]
+	_arg = "c"
+	checkSEXP(_R_c, C.CPLXSXP, -1)
+	_l1 := int(C.Rf_xlength(_R_c))
+	_x1 := (*[35184372088832]complex128)(unsafe.Pointer(C.COMPLEX(_R_c)))[:_l1:_l1]
+	_n := recycledLength(_l0, _l1)
+	_r := make([]string, _n)
+	_na := make([]bool, _n)
+	for _i := range _r {
+		_e0 := _x0[_i%_l0]
+		_e1 := _x1[_i%_l1]
+		if _e0 == naInt || isNA(real(_e1)) || isNA(imag(_e1)) {
+			_na[_i] = true
+			continue
+		}
+		_r[_i] = string(pkg.F(bool(_e0 == 1), complex128(_e1)))
+	}
+	return setNA(packSEXP_types_Slice___string(_r), _na)`,
+	},
+}
+
+func TestVectorisedBodyGo(t *testing.T) {
+	for i, test := range vectorisedBodyTests {
+		results := types.NewTuple(types.NewParam(0, mockPkg, "", test.result))
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), results, false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, "F", sig)}
+		got := vectorisedBodyGo(fn, unpackPolicy{zeroCopy: "share"})
+		if got != test.want {
+			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.want)
+		}
+	}
+}
+
+// namedInterface returns an empty interface type with the given name
+// in the package with the given path.
+func namedInterface(path, name string) types.Type {
+	p := types.NewPackage(path, path)
+	return types.NewNamed(types.NewTypeName(0, p, name, nil), types.NewInterfaceType(nil, nil), nil)
+}
+
+func namedStruct(path, name string) types.Type {
+	p := types.NewPackage(path, path)
+	return types.NewNamed(types.NewTypeName(0, p, name, nil), types.NewStruct(nil, nil), nil)
+}
+
+var contextCallTests = []struct {
+	params  []*types.Var
+	results []*types.Var
+	served  bool
+	want    string
+}{
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "ctx", namedInterface("context", "Context")),
+		},
+		want: `_arg = ".timeout"
+	_ctx, _cancel := contextFor(_timeout)
+	defer _cancel()
+	interruptible(_cancel, func() {
+		pkg.F(_ctx)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "ctx", namedInterface("context", "Context")),
+			types.NewParam(0, mockPkg, "x", types.Typ[types.Float64]),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.NewSlice(types.Typ[types.Int])),
+			types.NewParam(0, mockPkg, "", types.Universe.Lookup("error").Type()),
+		},
+		want: `_arg = ".timeout"
+	_ctx, _cancel := contextFor(_timeout)
+	defer _cancel()
+	var (
+		_r0 []int
+		_r1 error
+	)
+	interruptible(_cancel, func() {
+		_r0, _r1 = pkg.F(_ctx, _p0)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "ctx", namedInterface("context", "Context")),
+			types.NewParam(0, mockPkg, "r", namedInterface("io", "Reader")),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Int]),
+		},
+		want: `_arg = ".timeout"
+	_ctx, _cancel := contextFor(_timeout)
+	defer _cancel()
+	var (
+		_r0 int
+	)
+	_r0 = pkg.F(_ctx, _p0)
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "ctx", namedInterface("context", "Context")),
+			types.NewParam(0, mockPkg, "r", namedInterface("io", "Reader")),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Int]),
+		},
+		served: true,
+		want: `_arg = ".timeout"
+	_ctx, _cancel := contextFor(_timeout)
+	defer _cancel()
+	var (
+		_r0 int
+	)
+	interruptible(_cancel, func() {
+		_r0 = pkg.F(_ctx, _p0)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}`,
+	},
+}
+
+func TestContextCallGo(t *testing.T) {
+	for i, test := range contextCallTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, "F", sig)}
+		got := contextCallGo(fn, test.served)
+		if got != test.want {
+			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.want)
+		}
+	}
+}
+
+var servedCallTests = []struct {
+	params  []*types.Var
+	results []*types.Var
+	want    string
+}{
+	{
+		want: `interruptible(nil, func() {
+		pkg.F()
+	})`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.Typ[types.Float64]),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.NewSlice(types.Typ[types.Int])),
+			types.NewParam(0, mockPkg, "", types.Universe.Lookup("error").Type()),
+		},
+		want: `var (
+		_r0 []int
+		_r1 error
+	)
+	interruptible(nil, func() {
+		_r0, _r1 = pkg.F(_p0)
+	})`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "r", namedInterface("io", "Reader")),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Int]),
+		},
+		want: `var (
+		_r0 int
+	)
+	interruptible(nil, func() {
+		_r0 = pkg.F(_p0)
+	})`,
+	},	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "src", namedStruct("github.com/rgonomic/rgo/r", "Source")),
+			types.NewParam(0, mockPkg, "x", types.Typ[types.Float64]),
+		},
+		want: `interruptible(nil, func() {
+		pkg.F(rgo.Source{}, _p0)
+	})`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "rnd", types.NewPointer(namedStruct("math/rand", "Rand"))),
+		},
+		want: `interruptible(nil, func() {
+		pkg.F(rgo.NewRand())
+	})`,
+	},
+}
+
+func TestServedCallGo(t *testing.T) {
+	for i, test := range servedCallTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, "F", sig)}
+		got := servedCallGo(fn)
+		if got != test.want {
+			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.want)
+		}
+	}
+}
+
+var asyncBodyTests = []struct {
+	params  []*types.Var
+	results []*types.Var
+	opts    Options
+	want    string
+}{
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64])),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Float64]),
+		},
+		want: `_arg = "x"
+	_p0 := unpackSEXP_types_Slice___float64(_R_x)
+	copyArg(&_p0)
+	return startAsync(func() {}, func() func(*C.SEXP) C.SEXP {
+		_r0 := pkg.F(_p0)
+		return func(_err *C.SEXP) C.SEXP {
+			return packSEXP_F(_r0)
+		}
+	})`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "ctx", namedInterface("context", "Context")),
+			types.NewParam(0, mockPkg, "s", types.Typ[types.String]),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.NewSlice(types.Typ[types.Int])),
+			types.NewParam(0, mockPkg, "", types.Universe.Lookup("error").Type()),
+		},
+		opts: Options{ErrorCondition: true},
+		want: `_arg = "s"
+	_p0 := unpackSEXP_types_Basic_string(_R_s)
+	copyArg(&_p0)
+	_arg = ".timeout"
+	_ctx, _cancel := contextFor(_timeout)
+	return startAsync(_cancel, func() func(*C.SEXP) C.SEXP {
+		_r0, _r1 := pkg.F(_ctx, _p0)
+		_ctxErr := _ctx.Err()
+		return func(_err *C.SEXP) C.SEXP {
+			if _ctxErr != nil {
+				*_err = interruptCondition(_ctxErr)
+				return C.R_NilValue
+			}
+			if _r1 != nil {
+				*_err = goError(_r1)
+				return C.R_NilValue
+			}
+			return packSEXP_F(_r0)
+		}
+	})`,
+	},
+	{
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Int]),
+			types.NewParam(0, mockPkg, "", types.Typ[types.Bool]),
+		},
+		opts: Options{CommaOk: map[string]bool{"F": true}},
+		want: `return startAsync(func() {}, func() func(*C.SEXP) C.SEXP {
+		_r0, _r1 := pkg.F()
+		return func(_err *C.SEXP) C.SEXP {
+			if !_r1 {
+				return C.R_NilValue
+			}
+			return packSEXP_F(_r0)
+		}
+	})`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64])),
+			types.NewParam(0, mockPkg, "s", types.Typ[types.String]),
+		},
+		opts: Options{ReadOnly: "^F$", CheckMutation: true},
+		want: `_arg = "x"
+	_p0 := unpackSEXP_types_Slice___float64(_R_x)
+	copyArg(&_p0)
+	_h0 := C.R_hash(_R_x)
+	_arg = "s"
+	_p1 := unpackSEXP_types_Basic_string(_R_s)
+	copyArg(&_p1)
+	return startAsync(func() {}, func() func(*C.SEXP) C.SEXP {
+		pkg.F(_p0, _p1)
+		return func(_err *C.SEXP) C.SEXP {
+			checkUnmodified("x", _R_x, _h0)
+			return C.R_NilValue
+		}
+	}, _R_x)`,
+	},
+}
+
+func TestAsyncBodyGo(t *testing.T) {
+	for i, test := range asyncBodyTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, "F", sig)}
+		got := asyncBodyGo(test.opts)(fn)
+		if got != test.want {
+			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.want)
+		}
+	}
+}
+
+var parallelBodyTests = []struct {
+	params  []*types.Var
+	results []*types.Var
+	opts    Options
+	want    string
+}{
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Float64])),
+			types.NewParam(0, mockPkg, "s", types.Typ[types.String]),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "", types.Typ[types.Float64]),
+			types.NewParam(0, mockPkg, "", types.Universe.Lookup("error").Type()),
+		},
+		opts: Options{ErrorCondition: true},
+		want: `_arg = "args"
+	checkSEXP(_R_args, C.VECSXP, -1)
+	_arg = ".workers"
+	_workers := workersFor(_R_workers)
+	_ctx, _cancel := context.WithCancel(context.Background())
+	defer _cancel()
+	_res := C.Rf_allocVector(C.VECSXP, C.Rf_xlength(_R_args))
+	C.Rf_protect(_res)
+	defer C.Rf_unprotect(1)
+	_calls := make([]func() func(*C.SEXP) C.SEXP, C.Rf_xlength(_R_args))
+	for _i := range _calls {
+		mapElement(_res, _i, &_arg, func() {
+			_arg = "args"
+			_args := mapArgs(_R_args, _i, 2)
+			_arg = "x"
+			_p0 := unpackSEXP_types_Slice___float64(C.VECTOR_ELT(_args, 0))
+			_arg = "s"
+			_p1 := unpackSEXP_types_Basic_string(C.VECTOR_ELT(_args, 1))
+			_calls[_i] = func() func(*C.SEXP) C.SEXP {
+				_r0, _r1 := pkg.F(_p0, _p1)
+				return func(_err *C.SEXP) C.SEXP {
+					if _r1 != nil {
+						*_err = goError(_r1)
+						return C.R_NilValue
+					}
+					return packSEXP_F(_r0)
+				}
+			}
+		})
+	}
+	var _packs []func(*C.SEXP) C.SEXP
+	interruptible(_cancel, func() {
+		_packs = callParallel(_ctx, _calls, _workers)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}
+	packElements(_res, _packs)
+	return _res`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "ctx", namedInterface("context", "Context")),
+		},
+		want: `_arg = "args"
+	checkSEXP(_R_args, C.VECSXP, -1)
+	_arg = ".workers"
+	_workers := workersFor(_R_workers)
+	_arg = ".timeout"
+	_ctx, _cancel := contextFor(_timeout)
+	defer _cancel()
+	_res := C.Rf_allocVector(C.VECSXP, C.Rf_xlength(_R_args))
+	C.Rf_protect(_res)
+	defer C.Rf_unprotect(1)
+	_calls := make([]func() func(*C.SEXP) C.SEXP, C.Rf_xlength(_R_args))
+	for _i := range _calls {
+		mapElement(_res, _i, &_arg, func() {
+			_arg = "args"
+			mapArgs(_R_args, _i, 0)
+			_calls[_i] = func() func(*C.SEXP) C.SEXP {
+				pkg.F(_ctx)
+				return func(_err *C.SEXP) C.SEXP {
+					return C.R_NilValue
+				}
+			}
+		})
+	}
+	var _packs []func(*C.SEXP) C.SEXP
+	interruptible(_cancel, func() {
+		_packs = callParallel(_ctx, _calls, _workers)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}
+	packElements(_res, _packs)
+	return _res`,
+	},
+	{
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.NewSlice(types.Typ[types.Int32])),
+		},
+		opts: Options{ReadOnly: "^F$", CheckMutation: true},
+		want: `_arg = "args"
+	checkSEXP(_R_args, C.VECSXP, -1)
+	_arg = ".workers"
+	_workers := workersFor(_R_workers)
+	_ctx, _cancel := context.WithCancel(context.Background())
+	defer _cancel()
+	_res := C.Rf_allocVector(C.VECSXP, C.Rf_xlength(_R_args))
+	C.Rf_protect(_res)
+	defer C.Rf_unprotect(1)
+	_calls := make([]func() func(*C.SEXP) C.SEXP, C.Rf_xlength(_R_args))
+	for _i := range _calls {
+		mapElement(_res, _i, &_arg, func() {
+			_arg = "args"
+			_args := mapArgs(_R_args, _i, 1)
+			_arg = "x"
+			_p0 := unpackSEXP_types_Slice___int32(C.VECTOR_ELT(_args, 0))
+			_h0 := C.R_hash(C.VECTOR_ELT(_args, 0))
+			_calls[_i] = func() func(*C.SEXP) C.SEXP {
+				pkg.F(_p0)
+				return func(_err *C.SEXP) C.SEXP {
+					checkUnmodified("x", C.VECTOR_ELT(_args, 0), _h0)
+					return C.R_NilValue
+				}
+			}
+		})
+	}
+	var _packs []func(*C.SEXP) C.SEXP
+	interruptible(_cancel, func() {
+		_packs = callParallel(_ctx, _calls, _workers)
+	})
+	if _ctx.Err() != nil {
+		*_err = interruptCondition(_ctx.Err())
+		return C.R_NilValue
+	}
+	packElements(_res, _packs)
+	return _res`,
+	},
+}
+
+func TestParallelBodyGo(t *testing.T) {
+	for i, test := range parallelBodyTests {
+		sig := types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, "F", sig)}
+		got := parallelBodyGo(test.opts)(fn)
+		if got != test.want {
+			t.Errorf("unexpected result for test %d:\ngot:\n%s\nwant:\n%s", i, got, test.want)
+		}
+	}
+}
+
+func TestRuntimeSwitchGo(t *testing.T) {
+	named := types.NewNamed(types.NewTypeName(0, mockPkg, "T", nil), types.Typ[types.Float64], nil)
+	typs := []types.Type{
+		types.Typ[types.Uint8],
+		types.Universe.Lookup("byte").Type(),
+		types.Universe.Lookup("error").Type(),
+		named,
+	}
+
+	got := strings.TrimSpace(packArgGo(typs))
+	want := `// packArg returns an R value for the Go value v passed to an R function
+// by the runtime package.
+func packArg(v interface{}) C.SEXP {
+	switch v := v.(type) {
+	case nil:
+		return C.R_NilValue
+	case uint8:
+		return packSEXP_types_Basic_uint8(v)
+	case pkg.T:
+		return packSEXP_types_Named_path_to_pkg_T(v)
+	default:
+		panic(fmt.Sprintf("unsupported argument type %T", v))
+	}
+}`
+	if got != want {
+		t.Errorf("unexpected packArg result:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = strings.TrimSpace(unpackResultGo(typs))
+	want = `// unpackResult stores the R value p in the value pointed to by dst. If
+// dst is nil, p is discarded.
+func unpackResult(dst interface{}, p C.SEXP) {
+	switch dst := dst.(type) {
+	case nil:
+	case *uint8:
+		*dst = unpackSEXP_types_Basic_uint8(p)
+	case *pkg.T:
+		*dst = unpackSEXP_types_Named_path_to_pkg_T(p)
+	default:
+		panic(fmt.Sprintf("unsupported result type %T", dst))
+	}
+}`
+	if got != want {
+		t.Errorf("unexpected unpackResult result:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+var inOutTests = []struct {
+	name    string
+	params  []*types.Var
+	results []*types.Var
+	inOut   []int // Indices of in-out parameters.
+	want    []string
+}{
+	{
+		name: "F",
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "x", types.NewPointer(types.Typ[types.Float64])),
+		},
+		inOut: []int{0},
+		want: []string{
+			"return packSEXP_F(_p0)",
+			`func packSEXP_F(p0 *float64) C.SEXP {
+	return packSEXP_types_Pointer__float64(p0)
+}`,
+		},
+	},
+	{
+		name: "F",
+		params: []*types.Var{
+			types.NewParam(0, mockPkg, "res", types.NewPointer(types.Typ[types.Float64])),
+			types.NewParam(0, mockPkg, "_", types.NewPointer(types.Typ[types.Int32])),
+		},
+		results: []*types.Var{
+			types.NewParam(0, mockPkg, "res", types.Typ[types.Float64]),
+		},
+		inOut: []int{0, 1},
+		want: []string{
+			"_r0 := pkg.F(_p0, _p1)",
+			"return packSEXP_F(_r0, _p0, _p1)",
+			"func packSEXP_F(p0 float64, p1 *float64, p2 *int32) C.SEXP {",
+			`	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(C._GoStringPtr("res"), 3, C.CE_UTF8))
+	C.SET_VECTOR_ELT(r, 0, packSEXP_types_Basic_float64(p0))`,
+			`	C.SET_STRING_ELT(names, 1, C.Rf_mkCharLenCE(C._GoStringPtr("res"), 3, C.CE_UTF8))
+	C.SET_VECTOR_ELT(r, 1, packSEXP_types_Pointer__float64(p1))`,
+			`	C.SET_STRING_ELT(names, 2, C.Rf_mkCharLenCE(C._GoStringPtr("r2"), 2, C.CE_UTF8))
+	C.SET_VECTOR_ELT(r, 2, packSEXP_types_Pointer__int32(p2))`,
+		},
+	},
+}
+
+func TestInOutGo(t *testing.T) {
+	for _, test := range inOutTests {
+		fn := pkg.FuncInfo{
+			Func:     types.NewFunc(0, mockPkg, test.name, types.NewSignature(nil, types.NewTuple(test.params...), types.NewTuple(test.results...), false)),
+			FuncDecl: &ast.FuncDecl{Name: ast.NewIdent(test.name)},
+		}
+		for _, i := range test.inOut {
+			fn.InOut = append(fn.InOut, test.params[i])
+		}
+		var buf strings.Builder
+		err := GoFuncTemplate(Options{}).Execute(&buf, &pkg.Info{Funcs: []pkg.FuncInfo{fn}})
+		if err != nil {
+			t.Fatalf("unexpected error executing template for %s: %v", fn.Func, err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("generated code for %s does not contain:\n%s", fn.Func, want)
+			}
+		}
+	}
+}
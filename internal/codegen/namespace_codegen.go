@@ -5,15 +5,88 @@
 package codegen
 
 import (
+	"fmt"
 	"text/template"
+
+	"github.com/rgonomic/rgo/internal/pkg"
 )
 
-func NamespaceTemplate(words []string) *template.Template {
+func NamespaceTemplate(words []string, opts Options) *template.Template {
 	return template.Must(template.New("NAMESPACE").Funcs(template.FuncMap{
-		"snake": snake(words),
+		"snake":    snake(words),
+		"async":    asynchronous(opts),
+		"anyAsync": anyAsync(opts),
+		"parallel": parallel(opts),
 	}).Parse(`# Code generated by rgnonomic/rgo; DO NOT EDIT.
 
 useDynLib({{$.Pkg.Name}})
 {{range $func := .Funcs}}export({{snake $func.Func.Name}})
+{{if async $func}}export({{snake $func.Func.Name}}_async)
+{{end}}{{if parallel $func}}export({{snake $func.Func.Name}}_map)
+{{end}}{{end}}export({{$.Pkg.Name}}_go_runtime_set)
+export({{$.Pkg.Name}}_go_runtime_stats)
+export({{$.Pkg.Name}}_go_runtime_gc)
+{{if anyAsync .}}S3method(future::resolved, go_async)
+S3method(future::value, go_async)
 {{end}}`))
 }
+
+// runtimeFuncs are the suffixes of the names of the generated R functions
+// that control and inspect the Go runtime. The names are prefixed with
+// the package name so that they do not mask the functions of other
+// attached rgo packages.
+var runtimeFuncs = []string{"_go_runtime_set", "_go_runtime_stats", "_go_runtime_gc"}
+
+// runtimeRoutines are the names of the native routines called by the
+// generated R functions that control and inspect the Go runtime.
+var runtimeRoutines = []string{"rgo_runtime_set", "rgo_runtime_stats", "rgo_runtime_gc"}
+
+// CheckNames returns an error if the R function or native routine names
+// generated for the functions in info collide with each other or with the
+// names of the R functions and native routines generated for every
+// package.
+func CheckNames(words []string, opts Options, info *pkg.Info) error {
+	used := make(map[string]string)
+	for _, name := range runtimeFuncs {
+		used[info.Pkg().Name()+name] = "the generated Go runtime function"
+	}
+	for _, name := range runtimeRoutines {
+		used[name] = "the generated Go runtime routine"
+	}
+	isAsync := asynchronous(opts)
+	hasAsync, err := anyAsync(opts)(info)
+	if err != nil {
+		return err
+	}
+	if hasAsync {
+		for _, m := range asyncMethods {
+			used["rgo_async_"+snake(words)(m)] = "the generated asynchronous call routine"
+		}
+	}
+	isParallel := parallel(opts)
+	for _, fn := range info.Funcs {
+		name := snake(words)(fn.Func.Name())
+		names := []struct{ name, desc string }{{name, "function " + fn.Func.Name()}}
+		ok, err := isAsync(fn)
+		if err != nil {
+			return err
+		}
+		if ok {
+			names = append(names, struct{ name, desc string }{name + "_async", "asynchronous variant of " + fn.Func.Name()})
+		}
+		ok, err = isParallel(fn)
+		if err != nil {
+			return err
+		}
+		if ok {
+			names = append(names, struct{ name, desc string }{name + "_map", "parallel variant of " + fn.Func.Name()})
+		}
+		for _, n := range names {
+			if other, ok := used[n.name]; ok {
+				return fmt.Errorf("generated name %s for the %s collides with %s", n.name, n.desc, other)
+			}
+			used[n.name] = "the " + n.desc
+		}
+	}
+	return nil
+}
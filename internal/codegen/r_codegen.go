@@ -18,36 +18,212 @@ import (
 // TODO(kortchak): Check input types for validity before making .Call.
 
 // rCall is the template for R .Call function file generation.
-func RCallTemplate(words []string) *template.Template {
+func RCallTemplate(words []string, opts Options) *template.Template {
 	return template.Must(template.New("R .Call").Funcs(template.FuncMap{
 		"base":      path.Base,
 		"snake":     snake(words),
 		"varsOf":    varsOf,
 		"names":     names,
+		"params":    rParams(opts.NullDefault),
 		"doc":       doc,
-		"typecheck": typeCheck,
-		"returns":   returns,
+		"typecheck": typeCheck(opts.Coerce),
+		"returns":   returns(opts),
+		"vector":    vectorised(opts),
+		"recycle":   recycle,
+		"timeout":   func() string { return timeoutCheck },
+		"async":     asynchronous(opts),
+		"anyAsync":  anyAsync(opts),
+		"parallel":  parallel(opts),
+		"anyMap":    anyParallel(opts),
+		"workers":   func() string { return workersCheck },
+		"quoted":    quoted,
 		"seelso":    seelso,
 		"replace":   strings.ReplaceAll,
 	}).Parse(`{{$pkg := .Pkg}}# Code generated by rgnonomic/rgo; DO NOT EDIT.
 
 #' @useDynLib {{base $pkg.Path}}{{range $func := .Funcs}}
-{{$params := varsOf $func.Signature.Params}}
+{{$params := varsOf $func.Params}}{{$vector := vector $func}}
 #' {{snake $func.Func.Name}}
 #'
 #' {{replace $func.FuncDecl.Doc.Text "\n" "\n#' "}}
-{{range $p := $params}}{{doc $p}}
-{{end}}{{returns $func.Signature.Results}}{{seelso $pkg $func.Func}}
+{{range $p := $params}}{{doc $p $vector}}
+{{end}}{{if $func.Context}}#' @param .timeout is NULL or the number of seconds after which the call is interrupted
+{{end}}{{returns $func}}{{seelso $pkg $func.Func}}
 #' @export
-{{snake $func.Func.Name}} <- function({{names false $params}}) {
-	{{range $p := $params}}{{typecheck $p}}
-	{{end}}.Call("{{snake $func.Func.Name}}"{{names true $params}}, PACKAGE = "{{base $pkg.Path}}")
+{{snake $func.Func.Name}} <- function({{params $params}}{{if $func.Context}}{{if $params}}, {{end}}.timeout = NULL{{end}}) {
+	{{range $p := $params}}{{typecheck $p $vector}}
+	{{end}}{{if $func.Context}}{{timeout}}
+	{{end}}{{if $vector}}{{recycle $params}}{{end}}.Call("{{snake $func.Func.Name}}"{{names true $params}}{{if $func.Context}}, .timeout{{end}}, PACKAGE = "{{base $pkg.Path}}")
+}{{if async $func}}
+
+#' {{snake $func.Func.Name}}_async
+#'
+#' Asynchronous version of {{snake $func.Func.Name}}.
+#'
+#' @inheritParams {{snake $func.Func.Name}}
+#' @return A go_async handle with resolved, value and cancel methods
+#' @export
+{{snake $func.Func.Name}}_async <- function({{params $params}}{{if $func.Context}}{{if $params}}, {{end}}.timeout = NULL{{end}}) {
+	{{range $p := $params}}{{typecheck $p false}}
+	{{end}}{{if $func.Context}}{{timeout}}
+	{{end}}.go_async(.Call("{{snake $func.Func.Name}}_async"{{names true $params}}{{if $func.Context}}, .timeout{{end}}, PACKAGE = "{{base $pkg.Path}}"))
+}{{end}}{{if parallel $func}}
+
+#' {{snake $func.Func.Name}}_map
+#'
+#' Parallel apply of {{snake $func.Func.Name}} over a list of argument lists.
+#'
+#' @param args is a list of argument lists for {{snake $func.Func.Name}}, each matched by name and then by position
+#' @param .workers is NULL or the maximum number of concurrent calls, defaulting to GOMAXPROCS
+{{if $func.Context}}#' @param .timeout is NULL or the number of seconds after which the calls are interrupted
+{{end}}#' @return A list holding the result of each call, or the R condition describing its failure
+#' @export
+{{snake $func.Func.Name}}_map <- function(args, .workers = getOption("{{base $pkg.Path}}.workers"){{if $func.Context}}, .timeout = NULL{{end}}) {
+	if (!is.list(args)) {
+		stop("Argument 'args' must be of type 'list'.")
+	}
+	{{workers}}
+	{{if $func.Context}}{{timeout}}
+	{{end}}.Call("{{snake $func.Func.Name}}_map", .go_map_args(args, {{quoted $params}}), .workers{{if $func.Context}}, .timeout{{end}}, PACKAGE = "{{base $pkg.Path}}")
+}{{end}}{{end}}{{if anyAsync .}}
+
+.go_async <- function(id) {
+	reg.finalizer(environment(), function(e) .Call("rgo_async_release", id, PACKAGE = "{{base $pkg.Path}}"), onexit = TRUE)
+	structure(list(
+		resolved = function() .Call("rgo_async_resolved", id, PACKAGE = "{{base $pkg.Path}}"),
+		value = function() .Call("rgo_async_value", id, PACKAGE = "{{base $pkg.Path}}"),
+		cancel = function() invisible(.Call("rgo_async_cancel", id, PACKAGE = "{{base $pkg.Path}}"))
+	), class = "go_async")
+}
+
+#' @exportS3Method future::resolved
+resolved.go_async <- function(x, ...) x$resolved()
+
+#' @exportS3Method future::value
+value.go_async <- function(future, ...) future$value(){{end}}{{if anyMap .}}
+
+.go_map_args <- function(args, params) {
+	matched <- lapply(seq_along(args), function(i) {
+		a <- args[[i]]
+		if (!is.list(a) || is.null(names(a))) {
+			return(a)
+		}
+		given <- names(a)
+		given[is.na(given)] <- ""
+		named <- given != ""
+		unused <- setdiff(given[named], params)
+		if (length(unused) != 0) {
+			stop(sprintf("Element %d of argument 'args' has unused argument '%s'.", i, unused[1]))
+		}
+		if (anyDuplicated(given[named])) {
+			stop(sprintf("Element %d of argument 'args' matches a parameter more than once.", i))
+		}
+		free <- setdiff(params, given[named])
+		if (sum(!named) > length(free)) {
+			stop(sprintf("Element %d of argument 'args' has too many arguments.", i))
+		}
+		r <- vector("list", length(params))
+		names(r) <- params
+		r[given[named]] <- a[named]
+		r[free[seq_len(sum(!named))]] <- a[!named]
+		r
+	})
+	names(matched) <- names(args)
+	matched
 }{{end}}
+
+#' {{$pkg.Name}}_go_runtime_set
+#'
+#' Sets parameters of the Go runtime used by {{base $pkg.Path}}. Parameters
+#' that are NULL are left unchanged. The initial values are taken from the
+#' {{base $pkg.Path}}.maxprocs, {{base $pkg.Path}}.gc_percent and
+#' {{base $pkg.Path}}.memory_limit options when the package is loaded.
+#'
+#' @param maxprocs is NULL or the maximum number of threads executing Go code simultaneously (GOMAXPROCS)
+#' @param gc_percent is NULL or the garbage collection target percentage (GOGC), negative to disable garbage collection
+#' @param memory_limit is NULL or the soft memory limit in bytes (GOMEMLIMIT), Inf for no limit; finite limits need the package to be built with Go 1.19 or later
+#' @return The previous settings as a list, invisibly
+#' @export
+{{$pkg.Name}}_go_runtime_set <- function(maxprocs = NULL, gc_percent = NULL, memory_limit = NULL) {
+	if (!is.null(maxprocs)) {
+		if (!is.numeric(maxprocs) || length(maxprocs) != 1 || is.na(maxprocs) || maxprocs < 1 || maxprocs > .Machine$integer.max) {
+			stop("Argument 'maxprocs' must be NULL or a positive number.")
+		}
+		maxprocs <- as.integer(maxprocs)
+	}
+	if (!is.null(gc_percent)) {
+		if (!is.numeric(gc_percent) || length(gc_percent) != 1 || is.na(gc_percent) || abs(gc_percent) > .Machine$integer.max) {
+			stop("Argument 'gc_percent' must be NULL or a number.")
+		}
+		gc_percent <- as.integer(gc_percent)
+	}
+	if (!is.null(memory_limit)) {
+		if (!is.numeric(memory_limit) || length(memory_limit) != 1 || is.na(memory_limit) || memory_limit < 0) {
+			stop("Argument 'memory_limit' must be NULL or a non-negative number of bytes.")
+		}
+		storage.mode(memory_limit) <- "double"
+	}
+	invisible(.Call("rgo_runtime_set", maxprocs, gc_percent, memory_limit, PACKAGE = "{{base $pkg.Path}}"))
+}
+
+#' {{$pkg.Name}}_go_runtime_stats
+#'
+#' Returns statistics of the Go runtime used by {{base $pkg.Path}}, including
+#' its memory statistics. Sizes are in bytes and times in seconds.
+#'
+#' @return A named list of numeric values
+#' @export
+{{$pkg.Name}}_go_runtime_stats <- function() {
+	.Call("rgo_runtime_stats", PACKAGE = "{{base $pkg.Path}}")
+}
+
+#' {{$pkg.Name}}_go_runtime_gc
+#'
+#' Runs a garbage collection in the Go runtime used by {{base $pkg.Path}}.
+#'
+#' @export
+{{$pkg.Name}}_go_runtime_gc <- function() {
+	invisible(.Call("rgo_runtime_gc", PACKAGE = "{{base $pkg.Path}}"))
+}
+
+.onLoad <- function(libname, pkgname) {
+	{{$pkg.Name}}_go_runtime_set(
+		maxprocs = getOption("{{base $pkg.Path}}.maxprocs"),
+		gc_percent = getOption("{{base $pkg.Path}}.gc_percent"),
+		memory_limit = getOption("{{base $pkg.Path}}.memory_limit")
+	)
+}
 `))
 }
 
-// doc returns an R documentation line for the variable v.
-func doc(v *types.Var) string {
+// rParams returns a closure that returns a comma-separated list of the
+// names of the variables in vars for use as R function parameters. If
+// nullDefault is true, parameters that may be nil in Go default to NULL.
+func rParams(nullDefault bool) func([]*types.Var) string {
+	return func(vars []*types.Var) string {
+		var buf strings.Builder
+		for i, v := range vars {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(v.Name())
+			if nullDefault && isNillable(v.Type()) {
+				buf.WriteString(" = NULL")
+			}
+		}
+		return buf.String()
+	}
+}
+
+// doc returns an R documentation line for the variable v. If vector is
+// true, v is a parameter of a vectorised function.
+func doc(v *types.Var, vector bool) string {
+	if vector {
+		return fmt.Sprintf("#' @param %s is a %s", v.Name(), rDocFor(vectorType(v.Type())))
+	}
+	if isNillable(v.Type()) {
+		return fmt.Sprintf("#' @param %s is a %s or NULL", v.Name(), rDocFor(v.Type()))
+	}
 	return fmt.Sprintf("#' @param %s is a %s", v.Name(), rDocFor(v.Type()))
 }
 
@@ -57,40 +233,94 @@ func seelso(pkg *types.Package, fn *types.Func) string {
 	return fmt.Sprintf("#' @seelso <https://godoc.org/%s#%s>", pkg.Path(), fn.Name())
 }
 
-// returns returns an R documentation table for the returned values in t.
-func returns(t *types.Tuple) string {
-	if t.Len() == 0 {
-		return ""
-	}
-	var buf strings.Builder
-	switch t.Len() {
-	case 0:
-	case 1:
-		v := t.At(0)
-		doc := rDocFor(v.Type())
-		name := v.Name()
-		if name != "" {
-			name = ", " + name
-		}
-		fmt.Fprintf(&buf, "#' @return %s%s\n", article(doc, true), name)
-	default:
-		fmt.Fprintf(&buf, "#' @return A structured value containing:\n")
-		for i := 0; i < t.Len(); i++ {
-			v := t.At(i)
-			doc := rDocFor(v.Type())
+// returns returns a closure that returns an R documentation table for the
+// returned values of a function, including its in-out parameters.
+func returns(opts Options) func(pkg.FuncInfo) string {
+	isCommaOk := commaOk(opts)
+	isVectorised := vectorised(opts)
+	outputs := outputs(opts)
+	// Invalid policies are reported when the Go code is generated.
+	overflow, _ := intOverflow(opts)
+	invalid, _ := invalidString(opts)
+	policy := packPolicy{overflow: overflow, strings: invalid}
+	return func(fn pkg.FuncInfo) string {
+		t := outputs(fn)
+		if len(t) == 0 {
+			return ""
+		}
+		var ok string
+		if isCommaOk(fn) {
+			res := fn.Signature().Results()
+			ok = res.At(res.Len() - 1).Name()
+			if ok == "" {
+				ok = "the bool result"
+			}
+		}
+		var buf strings.Builder
+		switch len(t) {
+		case 0:
+		case 1:
+			v := t[0]
+			typ := v.Type()
+			if ok, _ := isVectorised(fn); ok {
+				typ = vectorType(typ)
+			}
+			doc := resultDoc(typ, policy)
 			name := v.Name()
-			if name == "" {
-				name = fmt.Sprintf("r%d", i)
+			if name != "" {
+				name = ", " + name
+			}
+			if isInOut(fn, v) {
+				name += " after the call"
+			}
+			if ok != "" {
+				name += fmt.Sprintf(", or NULL if %s is false", ok)
 			}
-			fmt.Fprintf(&buf, "#' @return - %s, $%s\n", article(doc, false), name)
+			fmt.Fprintf(&buf, "#' @return %s%s\n", article(doc, true), name)
+		default:
+			fmt.Fprintf(&buf, "#' @return A structured value containing:\n")
+			for i, v := range t {
+				doc := resultDoc(v.Type(), policy)
+				name := v.Name()
+				if name == "" {
+					name = fmt.Sprintf("r%d", i)
+				}
+				var after string
+				if isInOut(fn, v) {
+					after = " after the call"
+				}
+				fmt.Fprintf(&buf, "#' @return - %s, $%s%s\n", article(doc, false), name, after)
+			}
+			if ok != "" {
+				fmt.Fprintf(&buf, "#' @return The structured value is NULL if %s is false.\n", ok)
+			}
+		}
+		return buf.String()
+	}
+}
+
+// isInOut returns whether v is an in-out parameter of fn.
+func isInOut(fn pkg.FuncInfo, v *types.Var) bool {
+	for _, p := range fn.InOut {
+		if p == v {
+			return true
 		}
 	}
-	return buf.String()
+	return false
 }
 
 // rDocFor returns a string describing the R type based on the given Go type.
 func rDocFor(typ types.Type) string {
+	switch {
+	case pkg.IsReader(typ):
+		return "connection, raw vector or file path to read from"
+	case pkg.IsWriter(typ):
+		return "connection or file path to write to"
+	}
 	rtyp, length := rTypeOf(typ)
+	if dims, _, ok := pkg.ArrayDims(typ); ok {
+		return fmt.Sprintf("%s array with dimensions %s", rtyp, rDims(dims, false))
+	}
 	switch typ := typ.Underlying().(type) {
 	case *types.Pointer:
 		return rDocFor(typ.Elem())
@@ -114,6 +344,33 @@ func rDocFor(typ types.Type) string {
 	}
 }
 
+// resultDoc returns a string describing the R type returned for a result
+// of the given Go type under the given packing policy.
+func resultDoc(typ types.Type, policy packPolicy) string {
+	doc := rDocFor(typ)
+	elem, ok := elemBasic(typ)
+	if !ok {
+		return doc
+	}
+	if elem.Kind() == types.String && policy.strings == "raw" {
+		if strings.HasPrefix(doc, "scalar") {
+			return doc + " or raw vector"
+		}
+		return doc + " or list of raw vectors"
+	}
+	if !overflows(elem.Kind()) {
+		return doc
+	}
+	switch policy.overflow {
+	case "promote":
+		return strings.Replace(doc, "integer", "integer or double", 1)
+	case "double":
+		return strings.Replace(doc, "integer", "double", 1)
+	default:
+		return doc
+	}
+}
+
 // article returns a correct article for a given noun.
 func article(noun string, capital bool) string {
 	vowel := "a"
@@ -128,22 +385,195 @@ func article(noun string, capital bool) string {
 	}
 }
 
-func typeCheck(p *types.Var) string {
-	rtyp, length := rTypeOf(p.Type())
-	check := fmt.Sprintf(`if (!is.%[1]s(%[2]s)) {
+// typeCheck returns a closure that returns R code checking that the
+// argument for the parameter p has the R type and shape required by
+// the Go parameter and holds values in range for it. If coerce is
+// true, integral double arguments are first coerced to integer and
+// logical and integer arguments to double when required. If vector is
+// true, p is a parameter of a vectorised function and the argument may
+// have any length and hold NA values.
+func typeCheck(coerce bool) func(p *types.Var, vector bool) string {
+	return func(p *types.Var, vector bool) string {
+		if pkg.IsConnection(p.Type()) {
+			return connectionCheck(p)
+		}
+		typ := p.Type()
+		if vector {
+			typ = vectorType(typ)
+		}
+		rtyp, length := rTypeOf(typ)
+		var check string
+		if coerce {
+			check = coercion(p.Name(), rtyp)
+		}
+		check += fmt.Sprintf(`if (!is.%[1]s(%[2]s)) {
 		stop("Argument '%[2]s' must be of type '%[1]s'.")
 	}`, rtyp, p.Name())
-	if length > 0 {
-		var plural string
-		if length != 1 {
-			plural = "s"
-		}
-		check += fmt.Sprintf(`
+		if dims, _, ok := pkg.ArrayDims(p.Type()); ok {
+			check += fmt.Sprintf(`
+	if (!identical(dim(%[1]s), %[2]s)) {
+		stop("Argument '%[1]s' must be an array with dimensions %[3]s.")
+	}`, p.Name(), rDims(dims, true), rDims(dims, false))
+		} else if length > 0 {
+			var plural string
+			if length != 1 {
+				plural = "s"
+			}
+			check += fmt.Sprintf(`
 	if (length(%[1]s) != %[2]d) {
 		stop("Argument '%[1]s' must have %d element%s.")
 	}`, p.Name(), length, plural)
+		}
+		if elem, ok := elemBasic(p.Type()); ok && rtyp == "integer" {
+			min, max, ok := intRange(elem.Kind())
+			switch {
+			case ok && vector:
+				check += fmt.Sprintf(`
+	if (any(!is.na(%[1]s) & (%[1]s < %[2]dL | %[1]s > %[3]dL))) {
+		stop("Argument '%[1]s' has values out of range for %[4]s.")
+	}`, p.Name(), min, max, types.Typ[elem.Kind()])
+			case ok:
+				check += fmt.Sprintf(`
+	if (any(is.na(%[1]s) | %[1]s < %[2]dL | %[1]s > %[3]dL)) {
+		stop("Argument '%[1]s' has values out of range for %[4]s.")
+	}`, p.Name(), min, max, types.Typ[elem.Kind()])
+			}
+		}
+		if isNillable(p.Type()) {
+			check = fmt.Sprintf("if (!is.null(%s)) {\n\t\t%s\n\t}", p.Name(), strings.ReplaceAll(check, "\n", "\n\t"))
+		}
+		return check
+	}
+}
+
+// timeoutCheck is R code checking the .timeout argument of functions
+// taking a context.Context and converting it to double.
+const timeoutCheck = `if (!is.null(.timeout)) {
+		if (!is.numeric(.timeout) || length(.timeout) != 1 || !is.finite(.timeout) || .timeout <= 0) {
+			stop("Argument '.timeout' must be NULL or a positive finite number of seconds.")
+		}
+		storage.mode(.timeout) <- "double"
+	}`
+
+// workersCheck is R code checking the .workers argument of parallel
+// apply functions and converting it to integer.
+const workersCheck = `if (!is.null(.workers)) {
+		if (!is.numeric(.workers) || length(.workers) != 1 || is.na(.workers) || .workers < 1) {
+			stop("Argument '.workers' must be NULL or a positive number.")
+		}
+		.workers <- as.integer(.workers)
+	}`
+
+// quoted returns an R character vector expression holding the names of
+// the variables in vars.
+func quoted(vars []*types.Var) string {
+	if len(vars) == 0 {
+		return "character()"
 	}
-	return check
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = fmt.Sprintf("%q", v.Name())
+	}
+	return "c(" + strings.Join(names, ", ") + ")"
+}
+
+// recycle returns R code followed by a line break that warns when the
+// lengths of the arguments for the parameters of a vectorised function
+// are not multiples of each other, as R's arithmetic operators do.
+func recycle(params []*types.Var) string {
+	if len(params) < 2 {
+		return ""
+	}
+	lengths := make([]string, len(params))
+	for i, p := range params {
+		lengths[i] = fmt.Sprintf("length(%s)", p.Name())
+	}
+	return fmt.Sprintf(`.lengths <- c(%s)
+	if (all(.lengths > 0) && any(max(.lengths) %%%% .lengths != 0)) {
+		warning("longer object length is not a multiple of shorter object length")
+	}
+	`, strings.Join(lengths, ", "))
+}
+
+// coercion returns R code followed by a line break that coerces the
+// variable v to the R type rtyp following R's coercion rules. Only
+// integral doubles are coerced to integer.
+func coercion(v, rtyp string) string {
+	switch rtyp {
+	case "integer":
+		return fmt.Sprintf(`if (is.double(%[1]s) && all(is.na(%[1]s) | (%[1]s == trunc(%[1]s) & abs(%[1]s) <= .Machine$integer.max))) {
+		storage.mode(%[1]s) <- "integer"
+	}
+	`, v)
+	case "double":
+		return fmt.Sprintf(`if (is.logical(%[1]s) || is.integer(%[1]s)) {
+		storage.mode(%[1]s) <- "double"
+	}
+	`, v)
+	default:
+		return ""
+	}
+}
+
+// elemBasic returns the basic element type of the R vector
+// corresponding to typ if it has one.
+func elemBasic(typ types.Type) (*types.Basic, bool) {
+	switch typ := typ.Underlying().(type) {
+	case *types.Pointer:
+		return elemBasic(typ.Elem())
+	case *types.Basic:
+		return typ, true
+	case *types.Slice:
+		elem, ok := typ.Elem().(*types.Basic)
+		return elem, ok
+	case *types.Array:
+		if _, elem, ok := pkg.ArrayDims(typ); ok {
+			return elem.Underlying().(*types.Basic), true
+		}
+		elem, ok := typ.Elem().(*types.Basic)
+		return elem, ok
+	default:
+		return nil, false
+	}
+}
+
+// isNillable returns whether values of typ may be nil and so
+// may be passed as NULL from R.
+func isNillable(typ types.Type) bool {
+	switch typ.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// connectionCheck returns R code that ensures the parameter p refers to
+// an open R connection, opening a connection for file paths and, for
+// readers, raw vectors. Unopened connections are opened for appending
+// by writers so that their contents are not truncated. Connections opened
+// by the wrapper are closed when the wrapper returns.
+func connectionCheck(p *types.Var) string {
+	if pkg.IsReader(p.Type()) {
+		return fmt.Sprintf(`if (is.character(%[1]s) || is.raw(%[1]s)) {
+		%[1]s <- if (is.raw(%[1]s)) rawConnection(%[1]s, "r") else file(%[1]s, "rb")
+		on.exit(close(%[1]s), add = TRUE)
+	} else if (!inherits(%[1]s, "connection")) {
+		stop("Argument '%[1]s' must be a connection, raw vector or file path.")
+	} else if (!isOpen(%[1]s)) {
+		open(%[1]s, "rb")
+		on.exit(close(%[1]s), add = TRUE)
+	}`, p.Name())
+	}
+	return fmt.Sprintf(`if (is.character(%[1]s)) {
+		%[1]s <- file(%[1]s, "wb")
+		on.exit(close(%[1]s), add = TRUE)
+	} else if (!inherits(%[1]s, "connection")) {
+		stop("Argument '%[1]s' must be a connection or file path.")
+	} else if (!isOpen(%[1]s)) {
+		open(%[1]s, "ab")
+		on.exit(close(%[1]s), add = TRUE)
+	}`, p.Name())
 }
 
 func rTypeOf(typ types.Type) (rtyp string, length int64) {
@@ -157,6 +587,9 @@ func rTypeOf(typ types.Type) (rtyp string, length int64) {
 		return basicRtype(typ), 1
 	case *types.Slice:
 		elem := typ.Elem()
+		if pkg.IsError(elem) {
+			return "character", -1
+		}
 		if etyp, ok := elem.(*types.Basic); ok {
 			if etyp.Kind() == types.Uint8 {
 				return "raw", -1
@@ -164,7 +597,17 @@ func rTypeOf(typ types.Type) (rtyp string, length int64) {
 			return basicRtype(etyp), -1
 		}
 	case *types.Array:
+		if dims, elem, ok := pkg.ArrayDims(typ); ok {
+			etyp := elem.Underlying().(*types.Basic)
+			if etyp.Kind() == types.Uint8 {
+				return "raw", product(dims)
+			}
+			return basicRtype(etyp), product(dims)
+		}
 		elem := typ.Elem()
+		if pkg.IsError(elem) {
+			return "character", typ.Len()
+		}
 		if etyp, ok := elem.(*types.Basic); ok {
 			if etyp.Kind() == types.Uint8 {
 				return "raw", typ.Len()
@@ -179,6 +622,19 @@ func rTypeOf(typ types.Type) (rtyp string, length int64) {
 	return "", -1
 }
 
+// rDims returns an R vector literal of the given array dimensions.
+// If integer is true, the elements are integer literals.
+func rDims(dims []int64, integer bool) string {
+	d := make([]string, len(dims))
+	for i, l := range dims {
+		d[i] = fmt.Sprint(l)
+		if integer {
+			d[i] += "L"
+		}
+	}
+	return fmt.Sprintf("c(%s)", strings.Join(d, ", "))
+}
+
 func basicRtype(typ *types.Basic) string {
 	switch info := typ.Info(); {
 	case info&types.IsBoolean != 0:
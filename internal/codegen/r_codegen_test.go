@@ -0,0 +1,309 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"go/types"
+	"testing"
+
+	"github.com/rgonomic/rgo/internal/pkg"
+)
+
+var typeCheckTests = []struct {
+	typ  types.Type
+	want string
+}{
+	{
+		typ: types.Typ[types.Float64],
+		want: `if (!is.double(x)) {
+		stop("Argument 'x' must be of type 'double'.")
+	}
+	if (length(x) != 1) {
+		stop("Argument 'x' must have 1 element.")
+	}`,
+	},
+	{
+		typ: types.NewPointer(types.Typ[types.Float64]),
+		want: `if (!is.null(x)) {
+		if (!is.double(x)) {
+			stop("Argument 'x' must be of type 'double'.")
+		}
+		if (length(x) != 1) {
+			stop("Argument 'x' must have 1 element.")
+		}
+	}`,
+	},
+	{
+		typ: types.NewSlice(types.Typ[types.Int]),
+		want: `if (!is.null(x)) {
+		if (!is.integer(x)) {
+			stop("Argument 'x' must be of type 'integer'.")
+		}
+	}`,
+	},
+	{
+		typ: types.NewMap(types.Typ[types.String], types.Typ[types.Int]),
+		want: `if (!is.null(x)) {
+		if (!is.vector(x)) {
+			stop("Argument 'x' must be of type 'vector'.")
+		}
+	}`,
+	},
+}
+
+var typeCheckCoerceTests = []struct {
+	typ  types.Type
+	want string
+}{
+	{
+		typ: types.Typ[types.Int],
+		want: `if (is.double(x) && all(is.na(x) | (x == trunc(x) & abs(x) <= .Machine$integer.max))) {
+		storage.mode(x) <- "integer"
+	}
+	if (!is.integer(x)) {
+		stop("Argument 'x' must be of type 'integer'.")
+	}
+	if (length(x) != 1) {
+		stop("Argument 'x' must have 1 element.")
+	}`,
+	},
+	{
+		typ: types.NewSlice(types.Typ[types.Float64]),
+		want: `if (!is.null(x)) {
+		if (is.logical(x) || is.integer(x)) {
+			storage.mode(x) <- "double"
+		}
+		if (!is.double(x)) {
+			stop("Argument 'x' must be of type 'double'.")
+		}
+	}`,
+	},
+	{
+		typ: types.Typ[types.Int8],
+		want: `if (is.double(x) && all(is.na(x) | (x == trunc(x) & abs(x) <= .Machine$integer.max))) {
+		storage.mode(x) <- "integer"
+	}
+	if (!is.integer(x)) {
+		stop("Argument 'x' must be of type 'integer'.")
+	}
+	if (length(x) != 1) {
+		stop("Argument 'x' must have 1 element.")
+	}
+	if (any(is.na(x) | x < -128L | x > 127L)) {
+		stop("Argument 'x' has values out of range for int8.")
+	}`,
+	},
+	{
+		typ: types.Typ[types.String],
+		want: `if (!is.character(x)) {
+		stop("Argument 'x' must be of type 'character'.")
+	}
+	if (length(x) != 1) {
+		stop("Argument 'x' must have 1 element.")
+	}`,
+	},
+}
+
+var typeCheckVectorTests = []struct {
+	typ  types.Type
+	want string
+}{
+	{
+		typ: types.Typ[types.Float64],
+		want: `if (!is.double(x)) {
+		stop("Argument 'x' must be of type 'double'.")
+	}`,
+	},
+	{
+		typ: types.Typ[types.Uint8],
+		want: `if (!is.integer(x)) {
+		stop("Argument 'x' must be of type 'integer'.")
+	}
+	if (any(!is.na(x) & (x < 0L | x > 255L))) {
+		stop("Argument 'x' has values out of range for uint8.")
+	}`,
+	},
+	{
+		typ: types.Typ[types.String],
+		want: `if (!is.character(x)) {
+		stop("Argument 'x' must be of type 'character'.")
+	}`,
+	},
+}
+
+func TestTypeCheck(t *testing.T) {
+	for _, test := range typeCheckTests {
+		got := typeCheck(false)(types.NewParam(0, mockPkg, "x", test.typ), false)
+		if got != test.want {
+			t.Errorf("unexpected result for %s:\ngot:\n%s\nwant:\n%s", test.typ, got, test.want)
+		}
+	}
+	for _, test := range typeCheckCoerceTests {
+		got := typeCheck(true)(types.NewParam(0, mockPkg, "x", test.typ), false)
+		if got != test.want {
+			t.Errorf("unexpected result for coerced %s:\ngot:\n%s\nwant:\n%s", test.typ, got, test.want)
+		}
+	}
+	for _, test := range typeCheckVectorTests {
+		got := typeCheck(false)(types.NewParam(0, mockPkg, "x", test.typ), true)
+		if got != test.want {
+			t.Errorf("unexpected result for vectorised %s:\ngot:\n%s\nwant:\n%s", test.typ, got, test.want)
+		}
+	}
+}
+
+func TestRecycle(t *testing.T) {
+	x := types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])
+	y := types.NewParam(0, mockPkg, "y", types.Typ[types.Int])
+	if got := recycle([]*types.Var{x}); got != "" {
+		t.Errorf("unexpected result for single parameter: got:%q want:%q", got, "")
+	}
+	got := recycle([]*types.Var{x, y})
+	want := `.lengths <- c(length(x), length(y))
+	if (all(.lengths > 0) && any(max(.lengths) %% .lengths != 0)) {
+		warning("longer object length is not a multiple of shorter object length")
+	}
+	`
+	if got != want {
+		t.Errorf("unexpected result:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestQuoted(t *testing.T) {
+	x := types.NewParam(0, mockPkg, "x", types.Typ[types.Float64])
+	y := types.NewParam(0, mockPkg, "y", types.Typ[types.Int])
+	for _, test := range []struct {
+		vars []*types.Var
+		want string
+	}{
+		{vars: nil, want: "character()"},
+		{vars: []*types.Var{x, y}, want: `c("x", "y")`},
+	} {
+		got := quoted(test.vars)
+		if got != test.want {
+			t.Errorf("unexpected result for %d parameters: got:%q want:%q", len(test.vars), got, test.want)
+		}
+	}
+}
+
+func TestRParams(t *testing.T) {
+	vars := []*types.Var{
+		types.NewParam(0, mockPkg, "a", types.Typ[types.Int]),
+		types.NewParam(0, mockPkg, "b", types.NewPointer(types.Typ[types.Int])),
+		types.NewParam(0, mockPkg, "c", types.NewSlice(types.Typ[types.Int])),
+	}
+	for _, test := range []struct {
+		nullDefault bool
+		want        string
+	}{
+		{nullDefault: false, want: "a, b, c"},
+		{nullDefault: true, want: "a, b = NULL, c = NULL"},
+	} {
+		got := rParams(test.nullDefault)(vars)
+		if got != test.want {
+			t.Errorf("unexpected result for nullDefault=%t: got:%q want:%q", test.nullDefault, got, test.want)
+		}
+	}
+}
+
+func TestResultDoc(t *testing.T) {
+	for _, test := range []struct {
+		typ      types.Type
+		overflow string
+		strings  string
+		want     string
+	}{
+		{typ: types.Typ[types.Int], overflow: "error", want: "scalar integer"},
+		{typ: types.Typ[types.Int], overflow: "promote", want: "scalar integer or double"},
+		{typ: types.NewSlice(types.Typ[types.Uint32]), overflow: "double", want: "double vector"},
+		{typ: types.NewArray(types.Typ[types.Int], 3), overflow: "double", want: "double vector with 3 elements"},
+		{typ: types.NewSlice(types.Typ[types.Int16]), overflow: "double", want: "integer vector"},
+		{typ: types.Typ[types.String], strings: "raw", want: "scalar character or raw vector"},
+		{typ: types.NewSlice(types.Typ[types.String]), strings: "raw", want: "character vector or list of raw vectors"},
+		{typ: types.NewSlice(types.Typ[types.String]), strings: "replace", want: "character vector"},
+		{typ: types.NewSlice(types.Universe.Lookup("error").Type()), want: "character vector"},
+		{typ: types.NewArray(types.Universe.Lookup("error").Type(), 2), want: "character vector with 2 elements"},
+	} {
+		got := resultDoc(test.typ, packPolicy{overflow: test.overflow, strings: test.strings})
+		if got != test.want {
+			t.Errorf("unexpected result for %s with %s/%s policy: got:%q want:%q", test.typ, test.overflow, test.strings, got, test.want)
+		}
+	}
+}
+
+func TestConnectionCheck(t *testing.T) {
+	io := types.NewPackage("io", "io")
+	named := func(name string) types.Type {
+		return types.NewNamed(types.NewTypeName(0, io, name, nil), types.NewInterfaceType(nil, nil), nil)
+	}
+	for _, test := range []struct {
+		typ  types.Type
+		want string
+	}{
+		{
+			typ: named("Reader"),
+			want: `if (is.character(x) || is.raw(x)) {
+		x <- if (is.raw(x)) rawConnection(x, "r") else file(x, "rb")
+		on.exit(close(x), add = TRUE)
+	} else if (!inherits(x, "connection")) {
+		stop("Argument 'x' must be a connection, raw vector or file path.")
+	} else if (!isOpen(x)) {
+		open(x, "rb")
+		on.exit(close(x), add = TRUE)
+	}`,
+		},
+		{
+			typ: named("Writer"),
+			want: `if (is.character(x)) {
+		x <- file(x, "wb")
+		on.exit(close(x), add = TRUE)
+	} else if (!inherits(x, "connection")) {
+		stop("Argument 'x' must be a connection or file path.")
+	} else if (!isOpen(x)) {
+		open(x, "ab")
+		on.exit(close(x), add = TRUE)
+	}`,
+		},
+	} {
+		got := connectionCheck(types.NewParam(0, mockPkg, "x", test.typ))
+		if got != test.want {
+			t.Errorf("unexpected result for %s:\ngot:\n%s\nwant:\n%s", test.typ, got, test.want)
+		}
+	}
+}
+
+func TestReturnsCommaOk(t *testing.T) {
+	f64 := types.Typ[types.Float64]
+	for _, test := range []struct {
+		results []*types.Var
+		want    string
+	}{
+		{
+			results: []*types.Var{
+				types.NewParam(0, mockPkg, "v", f64),
+				types.NewParam(0, mockPkg, "ok", types.Typ[types.Bool]),
+			},
+			want: "#' @return A scalar double, v, or NULL if ok is false\n",
+		},
+		{
+			results: []*types.Var{
+				types.NewParam(0, mockPkg, "x", f64),
+				types.NewParam(0, mockPkg, "y", f64),
+				types.NewParam(0, mockPkg, "ok", types.Typ[types.Bool]),
+			},
+			want: `#' @return A structured value containing:
+#' @return - a scalar double, $x
+#' @return - a scalar double, $y
+#' @return The structured value is NULL if ok is false.
+`,
+		},
+	} {
+		fn := pkg.FuncInfo{Func: types.NewFunc(0, mockPkg, "F", types.NewSignature(nil, nil, types.NewTuple(test.results...), false))}
+		got := returns(Options{})(fn)
+		if got != test.want {
+			t.Errorf("unexpected result for %s:\ngot:\n%s\nwant:\n%s", fn.Func, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// goRuntimeConstraints holds the build constraints of the Go runtime
+// settings source for each Go version handled by GoRuntimeTemplate.
+var goRuntimeConstraints = map[string][2]string{
+	"go1.21": {"go1.21", "go1.21"},
+	"go1.19": {"go1.19 && !go1.21", "go1.19,!go1.21"},
+	"go1.15": {"!go1.19", "!go1.19"},
+}
+
+// GoRuntimeTemplate returns a template for the Go source that reads and
+// sets the Go runtime settings that depend on the version of Go used to
+// build the package. The source for version "go1.21" is built by Go 1.21
+// and later, "go1.19" by Go 1.19 and 1.20, and "go1.15" by earlier
+// versions, which do not have a soft memory limit.
+func GoRuntimeTemplate(version string) *template.Template {
+	constraints, ok := goRuntimeConstraints[version]
+	if !ok {
+		panic(fmt.Sprintf("unhandled Go version: %s", version))
+	}
+	return template.Must(template.New("Go runtime").Funcs(template.FuncMap{
+		"version":     func() string { return version },
+		"constraints": func() [2]string { return constraints },
+	}).Parse(`{{$version := version}}{{$constraints := constraints}}// Code generated by rgnonomic/rgo; DO NOT EDIT.
+
+//go:build {{index $constraints 0}}
+// +build {{index $constraints 1}}
+
+package main
+
+import (
+{{if eq $version "go1.15"}}	"math"
+{{end}}	"runtime/debug"{{if eq $version "go1.21"}}
+	"runtime/metrics"{{end}}
+)
+
+// gcPercent returns the garbage collection target percentage, which is
+// negative when garbage collection is disabled.
+func gcPercent() int {
+{{if eq $version "go1.21"}}	s := []metrics.Sample{{"{{"}}Name: "/gc/gogc:percent"{{"}}"}}
+	metrics.Read(s)
+	return int(int64(s[0].Value.Uint64()))
+{{else}}	p := debug.SetGCPercent(-1)
+	debug.SetGCPercent(p)
+	return p
+{{end}}}
+
+// memoryLimit returns the soft memory limit in bytes. The value
+// math.MaxInt64 is no limit.
+func memoryLimit() int64 {
+{{if eq $version "go1.15"}}	return math.MaxInt64
+{{else}}	return debug.SetMemoryLimit(-1)
+{{end}}}
+
+// setMemoryLimit sets the soft memory limit to limit bytes.{{if eq $version "go1.15"}}
+// Soft memory limits need Go 1.19 or later, so only math.MaxInt64, no
+// limit, is accepted.{{end}}
+func setMemoryLimit(limit int64) {
+{{if eq $version "go1.15"}}	if limit != math.MaxInt64 {
+		panic("memory limits need a package built with Go 1.19 or later")
+	}
+{{else}}	debug.SetMemoryLimit(limit)
+{{end}}}
+`))
+}
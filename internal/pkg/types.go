@@ -33,17 +33,121 @@ func (p *Info) Pkg() *types.Package {
 	return p.Funcs[0].Pkg()
 }
 
+// NeedContext returns whether any of the functions takes
+// a context.Context.
+func (p *Info) NeedContext() bool {
+	for _, fn := range p.Funcs {
+		if fn.Context() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RuntimePath is the import path of the package used by wrapped Go code
+// to report warnings, messages and progress to R.
+const RuntimePath = "github.com/rgonomic/rgo/r"
+
+// NeedRuntime returns whether the package imports the package at
+// RuntimePath, directly or through its dependencies, or any of the
+// functions takes a random source that is supplied by the wrapper
+// using the package at RuntimePath.
+func (p *Info) NeedRuntime() bool {
+	pkg := p.Pkg()
+	if pkg == nil {
+		return false
+	}
+	for _, fn := range p.Funcs {
+		if fn.Rand() != nil {
+			return true
+		}
+	}
+	return importsPath(pkg, RuntimePath, make(map[*types.Package]bool))
+}
+
+// runtimeTypes returns the types that values passed to and returned from
+// R by the runtime package may have.
+func runtimeTypes() []types.Type {
+	var typs []types.Type
+	for _, k := range []types.BasicKind{types.Bool, types.Int, types.Float64, types.Complex128, types.String} {
+		typs = append(typs, types.Typ[k], types.NewSlice(types.Typ[k]))
+	}
+	return append(typs, types.NewSlice(types.Typ[types.Uint8]))
+}
+
+// importsPath returns whether pkg imports the package at path, directly
+// or through its dependencies, ignoring packages already in seen.
+func importsPath(pkg *types.Package, path string, seen map[*types.Package]bool) bool {
+	for _, imp := range pkg.Imports() {
+		if seen[imp] {
+			continue
+		}
+		seen[imp] = true
+		if imp.Path() == path || importsPath(imp, path, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 // FuncInfo holds type and syntax information about a function.
 type FuncInfo struct {
 	*types.Func
 	*ast.FuncDecl
+
+	// InOut holds the pointer parameters of the
+	// function that are returned after the call.
+	InOut []*types.Var
 }
 
 func (f FuncInfo) Signature() *types.Signature {
 	return f.Func.Type().(*types.Signature)
 }
 
-func Analyse(path, allowed string, verbose bool) (*Info, error) {
+// Context returns the leading context.Context parameter of the
+// function, or nil if it does not have one. The context is supplied
+// by the wrapper rather than passed from R.
+func (f FuncInfo) Context() *types.Var {
+	return contextOf(f.Signature().Params())
+}
+
+// Rand returns the random source parameter of the function that
+// follows any leading context.Context, or nil if it does not have one.
+// The source is supplied by the wrapper and draws from R's random
+// number generator.
+func (f FuncInfo) Rand() *types.Var {
+	return randOf(f.Signature().Params())
+}
+
+// Params returns the parameters of the function that are passed
+// from R. These are all the parameters except any leading
+// context.Context and random source.
+func (f FuncInfo) Params() *types.Tuple {
+	return paramsOf(f.Signature().Params())
+}
+
+// Outputs returns the results of the function followed by its
+// in-out parameters.
+func (f FuncInfo) Outputs() []*types.Var {
+	res := f.Signature().Results()
+	if res.Len() == 0 && len(f.InOut) == 0 {
+		return nil
+	}
+	vars := make([]*types.Var, 0, res.Len()+len(f.InOut))
+	for i := 0; i < res.Len(); i++ {
+		vars = append(vars, res.At(i))
+	}
+	return append(vars, f.InOut...)
+}
+
+// Analyse returns information about the functions in the package at path
+// that may be wrapped. Only exported functions with names matching the allowed
+// pattern are included. The inOut parameter specifies pointer parameters
+// of functions that are returned to R after the call, keyed by function name;
+// if a function has an empty list, all its pointer parameters are in-out
+// parameters. A leading context.Context parameter and a following random
+// source parameter are not checked since they are supplied by the wrapper.
+func Analyse(path, allowed string, inOut map[string][]string, verbose bool) (*Info, error) {
 	if strings.HasSuffix(path, "...") {
 		return nil, errors.New("pkg: invalid use of ... suffix")
 	}
@@ -112,7 +216,7 @@ func Analyse(path, allowed string, verbose bool) (*Info, error) {
 				continue
 			}
 
-			par := sig.Params()
+			par := paramsOf(sig.Params())
 			err := checkType(par, par, true)
 			if err != nil {
 				if verbose {
@@ -128,16 +232,37 @@ func Analyse(path, allowed string, verbose bool) (*Info, error) {
 				}
 				continue
 			}
+			var inOutParams []*types.Var
+			if names, ok := inOut[fn.Name()]; ok {
+				inOutParams, err = inOutVars(par, names)
+				if err != nil {
+					return nil, fmt.Errorf("pkg: invalid in-out parameter for %s: %w", fn.Name(), err)
+				}
+			}
 			funcs = append(funcs, FuncInfo{
 				Func:     fn,
 				FuncDecl: fd,
+				InOut:    inOutParams,
 			})
 
 			walk(needUnpack, par, par)
 			walk(needPack, res, res)
+			for _, v := range inOutParams {
+				typ := v.Type()
+				walk(needPack, typ, typ)
+			}
 		}
 
 	}
+	info := &Info{Funcs: funcs, Unpackers: needUnpack, Packers: needPack}
+	if info.NeedRuntime() {
+		// Values passed to and returned from R by the runtime
+		// package are packed and unpacked by the generated code.
+		for _, typ := range runtimeTypes() {
+			walk(needUnpack, typ, typ)
+			walk(needPack, typ, typ)
+		}
+	}
 
 	// Check for mangled name collisions.
 	seen := make(map[string]types.Type)
@@ -153,7 +278,84 @@ func Analyse(path, allowed string, verbose bool) (*Info, error) {
 		}
 	}
 
-	return &Info{Funcs: funcs, Unpackers: needUnpack, Packers: needPack}, nil
+	return info, nil
+}
+
+// contextOf returns the first parameter in params if it is a
+// context.Context, otherwise nil.
+func contextOf(params *types.Tuple) *types.Var {
+	if params.Len() == 0 || !IsContext(params.At(0).Type()) {
+		return nil
+	}
+	return params.At(0)
+}
+
+// randOf returns the parameter in params following any leading
+// context.Context if it is a random source, otherwise nil.
+func randOf(params *types.Tuple) *types.Var {
+	i := 0
+	if contextOf(params) != nil {
+		i++
+	}
+	if params.Len() <= i || !IsRand(params.At(i).Type()) {
+		return nil
+	}
+	return params.At(i)
+}
+
+// paramsOf returns params without any leading context.Context and
+// following random source.
+func paramsOf(params *types.Tuple) *types.Tuple {
+	n := 0
+	if contextOf(params) != nil {
+		n++
+	}
+	if randOf(params) != nil {
+		n++
+	}
+	if n == 0 {
+		return params
+	}
+	vars := make([]*types.Var, params.Len()-n)
+	for i := range vars {
+		vars[i] = params.At(i + n)
+	}
+	return types.NewTuple(vars...)
+}
+
+// inOutVars returns the parameters in params with the given names. If names
+// is empty, all pointer parameters are returned. It is an error for a named
+// parameter to not exist or to not be a pointer.
+func inOutVars(params *types.Tuple, names []string) ([]*types.Var, error) {
+	var vars []*types.Var
+	if len(names) == 0 {
+		for i := 0; i < params.Len(); i++ {
+			v := params.At(i)
+			if _, ok := v.Type().Underlying().(*types.Pointer); ok {
+				vars = append(vars, v)
+			}
+		}
+		return vars, nil
+	}
+	for _, name := range names {
+		var found bool
+		for i := 0; i < params.Len(); i++ {
+			v := params.At(i)
+			if v.Name() != name {
+				continue
+			}
+			if _, ok := v.Type().Underlying().(*types.Pointer); !ok {
+				return nil, fmt.Errorf("%s is not a pointer", name)
+			}
+			vars = append(vars, v)
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("no parameter %s", name)
+		}
+	}
+	return vars, nil
 }
 
 // TODO(kortschak): Handle recursive type definitions correctly.
@@ -246,6 +448,11 @@ func checkType(typ, named types.Type, warnRefs bool) error {
 	case *types.Tuple:
 		for i := 0; i < typ.Len(); i++ {
 			f := typ.At(i).Type()
+			if warnRefs && IsConnection(f) {
+				// Connections are only handled as
+				// top-level input parameters.
+				continue
+			}
 			err := checkType(f, f, warnRefs)
 			if err != nil {
 				return err
@@ -259,7 +466,7 @@ func checkType(typ, named types.Type, warnRefs bool) error {
 type unpackers map[string]types.Type
 
 func (v unpackers) visit(typ types.Type) {
-	if _, ok := typ.Underlying().(*types.Interface); ok {
+	if _, ok := typ.Underlying().(*types.Interface); ok && !IsConnection(typ) {
 		panic(fmt.Sprintf("unhandled input parameter type: %q", typ))
 	}
 	s := typ.String()
@@ -293,6 +500,17 @@ func (v unpackers) also(typ types.Type) types.BasicKind {
 	return types.Invalid
 }
 
+// NeedConnection returns whether any of the unpacked types
+// is an R connection.
+func (v unpackers) NeedConnection() bool {
+	for _, typ := range v {
+		if IsConnection(typ) {
+			return true
+		}
+	}
+	return false
+}
+
 func (v unpackers) Types() []types.Type {
 	typs := make([]types.Type, 0, len(v))
 	for _, typ := range v {
@@ -365,6 +583,11 @@ func walk(v visitor, typ, named types.Type) {
 
 	case *types.Array:
 		v.visit(typ)
+		if _, _, ok := ArrayDims(typ); ok {
+			// Multi-dimensional arrays are converted directly
+			// from and to R arrays.
+			break
+		}
 		elem := typ.Elem()
 		v.visit(types.NewSlice(elem)) // This will visit the element in the slice walk.
 
@@ -385,6 +608,10 @@ func walk(v visitor, typ, named types.Type) {
 		panic(fmt.Sprintf("unhandled chan type %s (%s)", named, typ))
 
 	case *types.Interface:
+		if IsConnection(named) {
+			// Already visited as a named type.
+			break
+		}
 		if !IsError(named) {
 			panic(fmt.Sprintf("unhandled interface type %s", named))
 		}
@@ -442,6 +669,71 @@ func IsError(typ types.Type) bool {
 	return types.Identical(typ, types.Universe.Lookup("error").Type())
 }
 
+// ArrayDims returns the dimensions and element type of a nested fixed-size
+// array of basic types, for example [3][4]float64. If typ is not an array of
+// at least two dimensions with an element type of basic kind, ok is false.
+func ArrayDims(typ types.Type) (dims []int64, elem types.Type, ok bool) {
+	for {
+		a, isArray := typ.Underlying().(*types.Array)
+		if !isArray {
+			break
+		}
+		dims = append(dims, a.Len())
+		typ = a.Elem()
+	}
+	if _, isBasic := typ.Underlying().(*types.Basic); !isBasic || len(dims) < 2 {
+		return nil, nil, false
+	}
+	return dims, typ, true
+}
+
+// IsConnection returns whether typ is one of the io.Reader, io.ReadCloser
+// or io.Writer types that are passed from R as connections.
+func IsConnection(typ types.Type) bool {
+	return IsReader(typ) || IsWriter(typ)
+}
+
+// IsReader returns whether typ is io.Reader or io.ReadCloser.
+func IsReader(typ types.Type) bool {
+	return isIO(typ, "Reader") || isIO(typ, "ReadCloser")
+}
+
+// IsWriter returns whether typ is io.Writer.
+func IsWriter(typ types.Type) bool {
+	return isIO(typ, "Writer")
+}
+
+// IsContext returns whether typ is context.Context.
+func IsContext(typ types.Type) bool {
+	return isNamed(typ, "context", "Context")
+}
+
+// IsRand returns whether typ is a random source that can be supplied
+// by the wrapper, the Source type of the package at RuntimePath or
+// *math/rand.Rand.
+func IsRand(typ types.Type) bool {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		return isNamed(ptr.Elem(), "math/rand", "Rand")
+	}
+	return isNamed(typ, RuntimePath, "Source")
+}
+
+// isIO returns whether typ is the named type in package io with the given name.
+func isIO(typ types.Type, name string) bool {
+	return isNamed(typ, "io", name)
+}
+
+// isNamed returns whether typ is the named type in the package with the
+// given path and name.
+func isNamed(typ types.Type, path, name string) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == path && obj.Name() == name
+}
+
 func Mangle(typ types.Type) string {
 	// FIXME(kortschak): This may lead to name collisions for complex unnamed types.
 	runes := []rune(fmt.Sprintf("%T_%[1]s", typ))
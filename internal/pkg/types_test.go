@@ -33,7 +33,7 @@ func TestAnalyse(t *testing.T) {
 			continue
 		}
 
-		info, err := Analyse(filepath.Join("github.com/rgonomic/rgo/internal/pkg", path), "", false)
+		info, err := Analyse(filepath.Join("github.com/rgonomic/rgo/internal/pkg", path), "", nil, false)
 		if err != nil {
 			t.Errorf("unexpected error during analysis of %q: %v", path, err)
 			continue
@@ -76,7 +76,7 @@ func TestAnalyse(t *testing.T) {
 }
 
 func typesFor(path string) (map[string][]string, error) {
-	cfg := &packages.Config{Mode: packages.NeedSyntax}
+	cfg := &packages.Config{Mode: packages.NeedFiles | packages.NeedSyntax}
 	pkgs, err := packages.Load(cfg, "pattern=./"+path)
 	if err != nil {
 		return nil, fmt.Errorf("unexpected error loading %q: %w", path, err)
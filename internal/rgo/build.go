@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"path"
 	"path/filepath"
 	"regexp"
 	"text/template"
@@ -69,7 +70,7 @@ func (b *build) Run(ctx context.Context, args ...string) error {
 		return fmt.Errorf("failed to parse license name pattern: %w", err)
 	}
 
-	info, err := pkg.Analyse(b.Config.PkgPath, b.Config.AllowedFuncs, b.app.Verbose)
+	info, err := pkg.Analyse(b.Config.PkgPath, b.Config.AllowedFuncs, b.Config.InOut, b.app.Verbose)
 	if err != nil {
 		return fmt.Errorf("load error: %w", err)
 	}
@@ -109,12 +110,25 @@ func (b *build) Run(ctx context.Context, args ...string) error {
 	if b.Config.Words == nil {
 		b.Config.Words = []string{"NaN", "NA"}
 	}
+	err = codegen.CheckNames(b.Config.Words, b.Config.Options, info)
+	if err != nil {
+		return fmt.Errorf("name collision: %w", err)
+	}
+	err = checkOnLoad(filepath.Join("R", path.Base(info.Pkg().Path())+".R"))
+	if err != nil {
+		return err
+	}
 	templates := map[string]*template.Template{
-		"NAMESPACE":     codegen.NamespaceTemplate(b.Config.Words),
-		"R/%s.R":        codegen.RCallTemplate(b.Config.Words),
-		"src/rgo/%s.c":  codegen.CFuncTemplate(b.Config.Words),
-		"src/rgo/%s.go": codegen.GoFuncTemplate(),
+		"NAMESPACE":     codegen.NamespaceTemplate(b.Config.Words, b.Config.Options),
+		"R/%s.R":        codegen.RCallTemplate(b.Config.Words, b.Config.Options),
+		"src/rgo/%s.c":  codegen.CFuncTemplate(b.Config.Words, b.Config.Options),
+		"src/rgo/%s.go": codegen.GoFuncTemplate(b.Config.Options),
 		"src/Makevars":  codegen.MakevarsTemplate(),
+
+		// Go runtime settings that depend on the Go version.
+		"src/rgo/%s_go115.go": codegen.GoRuntimeTemplate("go1.15"),
+		"src/rgo/%s_go119.go": codegen.GoRuntimeTemplate("go1.19"),
+		"src/rgo/%s_go121.go": codegen.GoRuntimeTemplate("go1.21"),
 	}
 	for path, tmpl := range templates {
 		err = codegen.Render(dst, path, tmpl, info)
@@ -129,3 +143,30 @@ func (b *build) Run(ctx context.Context, args ...string) error {
 	}
 	return nil
 }
+
+// onLoad matches an R .onLoad hook definition.
+var onLoad = regexp.MustCompile(`(?m)^\s*\.onLoad\s*(<-|=)`)
+
+// checkOnLoad returns an error if an R source file in the package's R
+// directory other than the generated file defines an .onLoad hook, since
+// it would collide with the hook that sets up the Go runtime.
+func checkOnLoad(generated string) error {
+	files, err := filepath.Glob(filepath.Join("R", "*.R"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f == generated {
+			continue
+		}
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to read R source: %w", err)
+		}
+		if onLoad.Match(src) {
+			return fmt.Errorf("%s defines .onLoad which collides with the .onLoad generated in %s: "+
+				"use setHook(packageEvent(...)) or .onAttach instead", f, generated)
+		}
+	}
+	return nil
+}
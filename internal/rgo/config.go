@@ -4,6 +4,8 @@
 
 package rgo
 
+import "github.com/rgonomic/rgo/internal/codegen"
+
 // Config is an rgo build config.
 type Config struct {
 	// PkgPath is the package import path for the package
@@ -16,6 +18,15 @@ type Config struct {
 	// is empty all wrappable functions are wrapped.
 	AllowedFuncs string
 
+	// InOut specifies pointer parameters that are
+	// treated as in-out parameters. After the call
+	// the pointed-to values are returned to R along
+	// with the function's results. InOut is keyed by
+	// function name and holds the names of the in-out
+	// parameters. If the list of names for a function
+	// is empty, all its pointer parameters are in-out.
+	InOut map[string][]string
+
 	// Words is a set of known words that can be provided
 	// to ensure camel-case to snake case breaks words
 	// correctly. If words is nil, "NaN" and "NA" are
@@ -31,4 +42,7 @@ type Config struct {
 	// names to check. The pattern is used with the
 	// case-insensitive flag.
 	LicensePattern string
+
+	// Options holds code generation options.
+	codegen.Options
 }
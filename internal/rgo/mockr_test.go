@@ -0,0 +1,178 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rgo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+// mockR is the testdata directory holding the mock R API.
+const mockR = "mockr"
+
+// drivers maps testdata packages that are run against the mock R API to
+// the test driver in the mock R API directory that is built with them.
+// Drivers that depend on the generated init functions having been run
+// must have names that sort after the generated Go source file.
+var drivers = map[string]string{
+	"async_0":           "async.go",
+	"connection_0":      "connection.go",
+	"context_0":         "context.go",
+	"copy_on_write_0":   "copy_on_write.go",
+	"error_condition_0": "error_condition.go",
+	"go_runtime_0":      "go_runtime.go",
+	"in_out_0":          "in_out.go",
+	"long_vector_0":     "long_vector.go",
+	"output_0":          "output.go",
+	"parallel_0":        "parallel.go",
+	"rand_0":            "rand_driver.go",
+	"runtime_0":         "runtime_driver.go",
+	"vectorise_0":       "vectorise.go",
+	"zero_copy_0":       "zero_copy.go",
+}
+
+// TestMockR builds the generated code for the slice test packages against
+// a mock of the R API, checking that the generated Go and C code agrees
+// with the R API prototypes, and runs the test drivers, including round
+// trip and long vector tests using the long_vector_0 package, connection
+// tests using the connection_0 package, vectorised function tests using
+// the vectorise_0 package, cancellation tests using the context_0
+// package, asynchronous call tests using the
+// async_0 package, parallel apply tests using the parallel_0 package,
+// output redirection tests using the output_0 package, runtime package
+// tests using the runtime_0 package, poisoned view tests using the
+// zero_copy_0 package, copy-on-write tests using the copy_on_write_0
+// package, error condition tests using the error_condition_0 package,
+// Go runtime control tests using the go_runtime_0 package, in-out
+// parameter tests using the in_out_0 package and random source tests
+// using the rand_0 package.
+func TestMockR(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping mock R builds in short mode")
+	}
+	cc, err := exec.Command("go", "env", "CC").Output()
+	if err != nil {
+		t.Fatalf("failed to get C compiler: %v", err)
+	}
+	_, err = exec.LookPath(strings.TrimSpace(string(cc)))
+	if err != nil {
+		t.Skipf("skipping mock R builds: %v", err)
+	}
+
+	mock, err := filepath.Abs(filepath.Join("testdata", mockR))
+	if err != nil {
+		t.Fatalf("failed to get mock R path: %v", err)
+	}
+	pkgs, err := filepath.Glob(filepath.Join("testdata", "*_slice_*"))
+	if err != nil {
+		t.Fatalf("failed to get package names: %v", err)
+	}
+	for pkg := range drivers {
+		pkgs = append(pkgs, filepath.Join("testdata", pkg))
+	}
+	sort.Strings(pkgs)
+	for _, dir := range pkgs {
+		pkg := filepath.Base(dir)
+		t.Run(pkg, func(t *testing.T) {
+			if strings.Contains(pkg, "uintptr") {
+				t.Skipf("skipping unhandled type %q", "uintptr")
+			}
+			bin := buildMockR(t, mock, pkg)
+			if _, ok := drivers[pkg]; !ok {
+				return
+			}
+			out, err := exec.Command(bin).CombinedOutput()
+			if err != nil {
+				t.Errorf("failed mock R tests: %v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// buildMockR builds the Go and C code in the golden data for the testdata
+// package pkg with the mock R API in the mock directory and returns the
+// path to the executable.
+func buildMockR(t *testing.T, mock, pkg string) string {
+	tmpdir, err := ioutil.TempDir("", "rgo-mock-*")
+	if err != nil {
+		t.Fatalf("failed to make temporary build directory: %v", err)
+	}
+	t.Cleanup(func() {
+		err := os.RemoveAll(tmpdir)
+		if err != nil {
+			t.Fatalf("failed to clean up build directory: %v", err)
+		}
+	})
+
+	ar, err := txtar.ParseFile(filepath.Join("testdata", pkg, "golden.txtar"))
+	if err != nil {
+		t.Fatalf("failed to read golden data: %v", err)
+	}
+	for _, f := range ar.Files {
+		if path.Dir(f.Name) != "src/rgo" {
+			continue
+		}
+		err = ioutil.WriteFile(filepath.Join(tmpdir, path.Base(f.Name)), f.Data, 0o664)
+		if err != nil {
+			t.Fatalf("failed to write generated code: %v", err)
+		}
+	}
+	files := []string{"mock.c"}
+	if driver, ok := drivers[pkg]; ok {
+		files = append(files, driver)
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(mock, f))
+		if err != nil {
+			t.Fatalf("failed to read mock R source: %v", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(tmpdir, f), b, 0o664)
+		if err != nil {
+			t.Fatalf("failed to write mock R source: %v", err)
+		}
+	}
+
+	src, err := filepath.Abs(filepath.Join("testdata", pkg))
+	if err != nil {
+		t.Fatalf("failed to get package path: %v", err)
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatalf("failed to get module root path: %v", err)
+	}
+	mod := fmt.Sprintf("module mock\n\ngo 1.15\n\nrequire %[1]s v0.0.0\n\nreplace %[1]s => %s\n\nreplace github.com/rgonomic/rgo => %s\n", pkg, src, root)
+	err = ioutil.WriteFile(filepath.Join(tmpdir, "go.mod"), []byte(mod), 0o664)
+	if err != nil {
+		t.Fatalf("failed to write go.mod: %v", err)
+	}
+	// Packages importing the rgo runtime package need the rgo module's
+	// dependencies to be verified.
+	sum, err := ioutil.ReadFile(filepath.Join(src, "go.sum"))
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(tmpdir, "go.sum"), sum, 0o664)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to write go.sum: %v", err)
+	}
+
+	bin := filepath.Join(tmpdir, "mock")
+	cmd := exec.Command("go", "build", "-o", bin)
+	cmd.Dir = tmpdir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1", "CGO_CFLAGS=-I"+mock)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to build against mock R: %v\n%s", err, out)
+	}
+	return bin
+}
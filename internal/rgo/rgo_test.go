@@ -47,26 +47,41 @@ func TestRgo(t *testing.T) {
 		t.Fatalf("failed open get package names: %v", err)
 	}
 	for _, fi := range infos {
-		if !fi.IsDir() {
+		if !fi.IsDir() || fi.Name() == mockR {
 			continue
 		}
 		pkg := fi.Name()
 		t.Run("init:"+pkg, func(t *testing.T) {
-			cmd := exec.Command(rgo, "init", fmt.Sprintf("-dry-run=%t", !*regenerate))
+			// Packages with a customised build configuration
+			// hold the expected rgo init output in init.json.
+			golden := filepath.Join("testdata", pkg, "init.json")
+			_, err := os.Stat(golden)
+			custom := err == nil
+			if !custom {
+				golden = filepath.Join("testdata", pkg, "rgo.json")
+			}
+
+			cmd := exec.Command(rgo, "init", fmt.Sprintf("-dry-run=%t", !*regenerate || custom))
 			cmd.Dir = filepath.Join("testdata", pkg)
 			var buf bytes.Buffer
 			cmd.Stdout = &buf
-			err := cmd.Run()
+			err = cmd.Run()
 			if err != nil {
 				t.Fatalf("failed to run rgo init: %v", err)
 			}
 
+			got := buf.Bytes()
 			if *regenerate {
+				if custom {
+					err := ioutil.WriteFile(golden, got, 0o664)
+					if err != nil {
+						t.Fatalf("failed to write golden data: %v", err)
+					}
+				}
 				return
 			}
 
-			got := buf.Bytes()
-			want, err := ioutil.ReadFile(filepath.Join("testdata", pkg, "rgo.json"))
+			want, err := ioutil.ReadFile(golden)
 			if err != nil {
 				t.Fatalf("failed to read golden data: %v", err)
 			}
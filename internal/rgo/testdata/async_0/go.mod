@@ -0,0 +1,3 @@
+module async_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module coerce_0
+
+go 1.15
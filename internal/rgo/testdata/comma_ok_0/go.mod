@@ -0,0 +1,3 @@
+module comma_ok_0
+
+go 1.15
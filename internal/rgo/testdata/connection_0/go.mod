@@ -0,0 +1,3 @@
+module connection_0
+
+go 1.15
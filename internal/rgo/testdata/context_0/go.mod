@@ -0,0 +1,3 @@
+module context_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module copy_on_write_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module error_condition_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module error_slice_out_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module go_runtime_0
+
+go 1.15
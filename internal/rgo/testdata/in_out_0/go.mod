@@ -0,0 +1,3 @@
+module in_out_0
+
+go 1.15
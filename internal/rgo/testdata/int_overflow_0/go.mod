@@ -0,0 +1,3 @@
+module int_overflow_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module invalid_string_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module long_vector_0
+
+go 1.15
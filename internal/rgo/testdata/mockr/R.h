@@ -0,0 +1,29 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Mock of the parts of R.h used by rgo generated code.
+
+#ifndef MOCK_R_H
+#define MOCK_R_H
+
+#include <stddef.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+void Rf_warning(const char *format, ...);
+#define warning Rf_warning
+
+void R_CheckUserInterrupt(void);
+
+void GetRNGstate(void);
+void PutRNGstate(void);
+double unif_rand(void);
+void mock_set_seed(unsigned int seed);
+int mock_rng_state(void);
+
+void Rprintf(const char *format, ...);
+void REprintf(const char *format, ...);
+
+#endif
@@ -0,0 +1,186 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Mock of the parts of Rinternals.h used by rgo generated code.
+// Types and prototypes follow R so that code that builds against
+// the mock builds against R.
+
+#ifndef MOCK_RINTERNALS_H
+#define MOCK_RINTERNALS_H
+
+#include "R.h"
+
+typedef ptrdiff_t R_xlen_t;
+typedef unsigned int SEXPTYPE;
+typedef unsigned char Rbyte;
+typedef enum { FALSE = 0, TRUE } Rboolean;
+typedef struct { double r; double i; } Rcomplex;
+
+typedef enum {
+	CE_NATIVE = 0,
+	CE_UTF8 = 1,
+	CE_LATIN1 = 2,
+	CE_BYTES = 3,
+	CE_SYMBOL = 5,
+	CE_ANY = 99
+} cetype_t;
+
+#define NILSXP 0
+#define SYMSXP 1
+#define LISTSXP 2
+#define ENVSXP 4
+#define LANGSXP 6
+#define CHARSXP 9
+#define LGLSXP 10
+#define INTSXP 13
+#define REALSXP 14
+#define CPLXSXP 15
+#define STRSXP 16
+#define VECSXP 19
+#define RAWSXP 24
+
+typedef struct SEXPREC *SEXP;
+
+extern SEXP R_NilValue;
+extern SEXP R_NaString;
+extern SEXP R_BaseEnv;
+extern SEXP R_GlobalEnv;
+extern SEXP R_NamesSymbol;
+extern SEXP R_ClassSymbol;
+extern SEXP R_DimSymbol;
+
+int TYPEOF(SEXP x);
+void SET_TYPEOF(SEXP x, int v);
+R_xlen_t XLENGTH(SEXP x);
+R_xlen_t Rf_xlength(SEXP x);
+int Rf_length(SEXP x);
+Rboolean Rf_isNull(SEXP s);
+Rboolean Rf_inherits(SEXP s, const char *name);
+
+SEXP Rf_protect(SEXP s);
+void Rf_unprotect(int n);
+void R_PreserveObject(SEXP s);
+void R_ReleaseObject(SEXP s);
+int MAYBE_SHARED(SEXP x);
+void MARK_NOT_MUTABLE(SEXP x);
+SEXP Rf_duplicate(SEXP s);
+
+Rboolean R_ToplevelExec(void (*fun)(void *), void *data);
+#define PROTECT(s) Rf_protect(s)
+#define UNPROTECT(n) Rf_unprotect(n)
+
+SEXP Rf_allocVector(SEXPTYPE type, R_xlen_t n);
+SEXP Rf_allocList(int n);
+SEXP SETCAR(SEXP x, SEXP y);
+SEXP CAR(SEXP e);
+SEXP CDR(SEXP e);
+SEXP Rf_getAttrib(SEXP vec, SEXP name);
+SEXP Rf_setAttrib(SEXP vec, SEXP name, SEXP val);
+
+int *LOGICAL(SEXP x);
+int *INTEGER(SEXP x);
+Rbyte *RAW(SEXP x);
+double *REAL(SEXP x);
+Rcomplex *COMPLEX(SEXP x);
+SEXP STRING_ELT(SEXP x, R_xlen_t i);
+void SET_STRING_ELT(SEXP x, R_xlen_t i, SEXP v);
+SEXP VECTOR_ELT(SEXP x, R_xlen_t i);
+SEXP SET_VECTOR_ELT(SEXP x, R_xlen_t i, SEXP v);
+
+SEXP Rf_mkCharLenCE(const char *s, int len, cetype_t enc);
+const char *R_CHAR(SEXP x);
+cetype_t Rf_getCharCE(SEXP x);
+const char *Rf_translateCharUTF8(SEXP x);
+SEXP Rf_mkString(const char *s);
+
+SEXP Rf_ScalarLogical(int x);
+SEXP Rf_ScalarInteger(int x);
+SEXP Rf_ScalarReal(double x);
+SEXP Rf_ScalarComplex(Rcomplex x);
+SEXP Rf_ScalarString(SEXP x);
+
+SEXP Rf_install(const char *name);
+SEXP Rf_lang2(SEXP s, SEXP t);
+SEXP Rf_lang3(SEXP s, SEXP t, SEXP u);
+SEXP Rf_lang4(SEXP s, SEXP t, SEXP u, SEXP v);
+SEXP Rf_eval(SEXP e, SEXP rho);
+SEXP R_tryEval(SEXP e, SEXP env, int *ErrorOccurred);
+SEXP R_tryEvalSilent(SEXP e, SEXP env, int *ErrorOccurred);
+const char *R_curErrorBuf(void);
+
+SEXP Rf_GetOption1(SEXP tag);
+int Rf_asLogical(SEXP x);
+
+#define NA_STRING R_NaString
+#define CHAR(x) R_CHAR(x)
+#define xlength Rf_xlength
+#define length Rf_length
+#define allocVector Rf_allocVector
+#define allocList Rf_allocList
+#define getAttrib Rf_getAttrib
+#define setAttrib Rf_setAttrib
+#define getCharCE Rf_getCharCE
+#define translateCharUTF8 Rf_translateCharUTF8
+#define mkString Rf_mkString
+#define ScalarLogical Rf_ScalarLogical
+#define ScalarInteger Rf_ScalarInteger
+#define ScalarReal Rf_ScalarReal
+#define ScalarComplex Rf_ScalarComplex
+#define ScalarString Rf_ScalarString
+#define install Rf_install
+#define lang2 Rf_lang2
+#define lang3 Rf_lang3
+#define lang4 Rf_lang4
+#define eval Rf_eval
+#define GetOption1 Rf_GetOption1
+#define asLogical Rf_asLogical
+#define inherits Rf_inherits
+
+// Mock inspection functions.
+
+// mock_protect_depth returns the number of protected objects.
+int mock_protect_depth(void);
+
+// mock_preserved returns the number of preserved objects.
+int mock_preserved(void);
+
+// mock_gc overwrites the data of the vectors that are not reachable from
+// the protected and preserved objects or the state of the mock session,
+// as R may reuse their memory once they are collected. The vectors are
+// not freed.
+void mock_gc(void);
+
+// mock_set_shared sets whether x may be shared with other R values.
+void mock_set_shared(SEXP x, int shared);
+
+// mock_raised returns the last value passed to stop, or R_NilValue.
+SEXP mock_raised(void);
+
+// mock_signalled returns the conditions passed to warning and message
+// since the last call as a pairlist, in the order they were signalled.
+SEXP mock_signalled(void);
+
+// mock_interrupt makes a user interrupt pending.
+void mock_interrupt(void);
+
+// mock_set_option sets the R option name to value.
+void mock_set_option(const char *name, SEXP value);
+
+// mock_connection returns an R connection that reads the n bytes in data
+// and records the bytes written to it.
+SEXP mock_connection(const char *data, int n);
+
+// mock_connection_written returns the bytes written to the connection
+// con as a raw vector.
+SEXP mock_connection_written(SEXP con);
+
+// mock_connection_fail makes reads from and writes to the connection con
+// fail with an R error.
+void mock_connection_fail(SEXP con);
+
+// mock_console returns the text written to the R console, or to its
+// error stream if err is not zero, since the last call.
+const char *mock_console(int err);
+
+#endif
@@ -0,0 +1,175 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the async_0 test
+// package and the mock R API. It checks that asynchronous calls copy
+// their arguments, report whether they are resolved, can be cancelled
+// and released, and that interrupting a wait for their values cancels
+// them.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// inherits returns whether the R value p has the given class.
+func inherits(p C.SEXP, class string) bool {
+	c := C.CString(class)
+	defer C.free(unsafe.Pointer(c))
+	return C.Rf_inherits(p, c) != 0
+}
+
+// message returns the message of the R condition p.
+func message(p C.SEXP) string {
+	return C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(p, 0), 0)))
+}
+
+// resolved returns whether the asynchronous call identified by id has
+// completed.
+func resolved(id C.SEXP) bool {
+	err := C.R_NilValue
+	r := Wrapped_asyncResolved(id, &err)
+	if err != C.R_NilValue {
+		panic(message(err))
+	}
+	return *C.LOGICAL(r) != 0
+}
+
+// blocked starts an asynchronous call that returns the R integer 1 once
+// release is closed or ctx is done.
+func blocked(ctx context.Context, cancel context.CancelFunc) (id C.SEXP, release chan struct{}) {
+	release = make(chan struct{})
+	return startAsync(cancel, func() func(*C.SEXP) C.SEXP {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return func(*C.SEXP) C.SEXP { return C.Rf_ScalarInteger(1) }
+	}), release
+}
+
+func init() {
+	var failed bool
+
+	x := C.Rf_allocVector(C.REALSXP, 3)
+	xv := (*[3]float64)(unsafe.Pointer(C.REAL(x)))
+	*xv = [3]float64{1, 2, 3}
+	p := unpackSEXP_types_Slice___float64(x)
+	copyArg(&p)
+	xv[0] = -1
+	if p[0] != 1 || p[1] != 2 || p[2] != 3 {
+		fmt.Printf("argument shares memory with R vector: %v\n", p)
+		failed = true
+	}
+	m := map[string]int{"a": 1}
+	mc := m
+	copyArg(&mc)
+	m["a"] = 2
+	if mc["a"] != 1 {
+		fmt.Printf("argument shares memory with original map: %v\n", mc)
+		failed = true
+	}
+
+	err := C.R_NilValue
+	id := Wrapped_Test0_async(C.Rf_ScalarReal(1), x, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error starting call: %s\n", message(err))
+		failed = true
+	}
+	v := Wrapped_asyncValue(id, &err)
+	switch {
+	case err != C.R_NilValue:
+		fmt.Printf("unexpected error for value: %s\n", message(err))
+		failed = true
+	case C.TYPEOF(v) != C.INTSXP || *C.INTEGER(v) != 0:
+		fmt.Println("unexpected value for completed call")
+		failed = true
+	case !resolved(id):
+		fmt.Println("expected completed call to be resolved")
+		failed = true
+	}
+	Wrapped_asyncRelease(id, &err)
+	Wrapped_asyncValue(id, &err)
+	if err == C.R_NilValue || !inherits(err, "go_panic") {
+		fmt.Println("expected panic condition for released call")
+		failed = true
+	}
+
+	id, release := blocked(context.Background(), func() {})
+	if resolved(id) {
+		fmt.Println("unexpected resolved call before completion")
+		failed = true
+	}
+	close(release)
+	err = C.R_NilValue
+	v = Wrapped_asyncValue(id, &err)
+	if err != C.R_NilValue || *C.INTEGER(v) != 1 {
+		fmt.Println("unexpected value for blocked call")
+		failed = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	id, _ = blocked(ctx, cancel)
+	Wrapped_asyncCancel(id, &err)
+	Wrapped_asyncValue(id, &err)
+	switch {
+	case err == C.R_NilValue:
+		fmt.Println("expected interrupt condition for cancelled call")
+		failed = true
+	case !inherits(err, "go_interrupt") || message(err) != "call interrupted":
+		fmt.Printf("unexpected condition for cancelled call: %s\n", message(err))
+		failed = true
+	}
+	if ctx.Err() != context.Canceled {
+		fmt.Println("expected cancelled context for cancelled call")
+		failed = true
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	id, _ = blocked(ctx, cancel)
+	C.mock_interrupt()
+	err = C.R_NilValue
+	Wrapped_asyncValue(id, &err)
+	if err == C.R_NilValue || !inherits(err, "go_interrupt") {
+		fmt.Println("expected interrupt condition for interrupted wait")
+		failed = true
+	}
+	if ctx.Err() != context.Canceled {
+		fmt.Println("expected cancelled context for interrupted wait")
+		failed = true
+	}
+	err = C.R_NilValue
+	Wrapped_asyncValue(id, &err)
+	if err == C.R_NilValue || !inherits(err, "go_interrupt") {
+		fmt.Println("expected interrupt condition after interrupted wait")
+		failed = true
+	}
+
+	id = startAsync(func() {}, func() func(*C.SEXP) C.SEXP { panic("failed") })
+	Wrapped_asyncValue(id, &err)
+	if err == C.R_NilValue || !inherits(err, "go_panic") || message(err) != "failed" {
+		fmt.Println("expected panic condition for panicking call")
+		failed = true
+	}
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
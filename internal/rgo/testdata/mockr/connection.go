@@ -0,0 +1,133 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the connection_0 test
+// package and the mock R API. It checks that io.Reader and io.Writer
+// parameters read from and write to R connections using readBin and
+// writeBin, that connection failures are returned as errors, and that
+// values that are not connections are rejected.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"unsafe"
+)
+
+// newConnection returns a mock R connection reading data.
+func newConnection(data string) C.SEXP {
+	c := C.CString(data)
+	defer C.free(unsafe.Pointer(c))
+	return C.mock_connection(c, C.int(len(data)))
+}
+
+// written returns the bytes written to the mock R connection con.
+func written(con C.SEXP) string {
+	w := C.mock_connection_written(con)
+	n := int(C.Rf_xlength(w))
+	if n == 0 {
+		return ""
+	}
+	return string((*[1 << 30]byte)(unsafe.Pointer(C.RAW(w)))[:n:n])
+}
+
+// unpackPanic returns the value recovered from a panic unpacking p as an
+// io.Reader.
+func unpackPanic(p C.SEXP) (r interface{}) {
+	defer func() {
+		r = recover()
+	}()
+	unpackSEXP_types_Named_io_Reader(p)
+	return nil
+}
+
+func init() {
+	var failed bool
+
+	const text = "the quick brown fox jumps over the lazy dog"
+	in := newConnection(text)
+	b, err := ioutil.ReadAll(unpackSEXP_types_Named_io_Reader(in))
+	if err != nil || string(b) != text {
+		fmt.Printf("unexpected read: %q %v\n", b, err)
+		failed = true
+	}
+
+	rc := unpackSEXP_types_Named_io_ReadCloser(newConnection("abcdef"))
+	buf := make([]byte, 4)
+	n, err := rc.Read(buf)
+	if n != 4 || err != nil || string(buf[:n]) != "abcd" {
+		fmt.Printf("unexpected first short read: %q %v\n", buf[:n], err)
+		failed = true
+	}
+	n, err = rc.Read(buf)
+	if n != 2 || err != nil || string(buf[:n]) != "ef" {
+		fmt.Printf("unexpected second short read: %q %v\n", buf[:n], err)
+		failed = true
+	}
+	n, err = rc.Read(buf)
+	if n != 0 || err != io.EOF {
+		fmt.Printf("unexpected read at end of connection: %d %v\n", n, err)
+		failed = true
+	}
+	if err = rc.Close(); err != nil {
+		fmt.Printf("unexpected error closing connection: %v\n", err)
+		failed = true
+	}
+
+	out := newConnection("")
+	w := unpackSEXP_types_Named_io_Writer(out)
+	fmt.Fprint(w, "hello, ")
+	fmt.Fprint(w, "world")
+	if n, err := w.Write(nil); n != 0 || err != nil {
+		fmt.Printf("unexpected result of empty write: %d %v\n", n, err)
+		failed = true
+	}
+	if got := written(out); got != "hello, world" {
+		fmt.Printf("unexpected written data: %q\n", got)
+		failed = true
+	}
+
+	bad := newConnection("data")
+	C.mock_connection_fail(bad)
+	if _, err := unpackSEXP_types_Named_io_Reader(bad).Read(buf); err == nil {
+		fmt.Println("expected error reading from failing connection")
+		failed = true
+	}
+	if _, err := unpackSEXP_types_Named_io_Writer(bad).Write([]byte("data")); err == nil {
+		fmt.Println("expected error writing to failing connection")
+		failed = true
+	}
+
+	if _, ok := unpackPanic(C.Rf_ScalarInteger(1)).(*typeError); !ok {
+		fmt.Println("expected type error for value that is not a connection")
+		failed = true
+	}
+
+	rerr := C.R_NilValue
+	Wrapped_Test0(newConnection(text), &rerr)
+	Wrapped_Test1(newConnection(text), newConnection(""), &rerr)
+	if rerr != C.R_NilValue {
+		fmt.Println("unexpected error from wrapped calls")
+		failed = true
+	}
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
@@ -0,0 +1,111 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the context_0 test
+// package and the mock R API. It checks that the contexts passed to
+// wrapped functions are cancelled by timeouts and R user interrupts, that
+// timeouts too long for a time.Duration never expire and that
+// cancellation is signalled as an interrupt condition.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"unsafe"
+)
+
+// inherits returns whether the R value p has the given class.
+func inherits(p C.SEXP, class string) bool {
+	c := C.CString(class)
+	defer C.free(unsafe.Pointer(c))
+	return C.Rf_inherits(p, c) != 0
+}
+
+// message returns the message of the R condition p.
+func message(p C.SEXP) string {
+	return C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(p, 0), 0)))
+}
+
+func init() {
+	var failed bool
+
+	err := C.R_NilValue
+	Wrapped_Test0(C.R_NilValue, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error without timeout: %s\n", message(err))
+		failed = true
+	}
+
+	err = C.R_NilValue
+	Wrapped_Test1(C.Rf_ScalarReal(1), C.Rf_allocVector(C.INTSXP, 2), C.Rf_ScalarReal(1e-12), &err)
+	switch {
+	case err == C.R_NilValue:
+		fmt.Println("expected interrupt condition for timeout")
+		failed = true
+	case !inherits(err, "go_interrupt") || !inherits(err, "interrupt"):
+		fmt.Println("unexpected condition class for timeout")
+		failed = true
+	case message(err) != "call timed out":
+		fmt.Printf("unexpected message for timeout: %q\n", message(err))
+		failed = true
+	}
+
+	err = C.R_NilValue
+	Wrapped_Test0(C.Rf_ScalarInteger(1), &err)
+	if err == C.R_NilValue || !inherits(err, "go_type_error") {
+		fmt.Println("expected type error for integer timeout")
+		failed = true
+	}
+
+	for _, timeout := range []float64{1e300, math.Inf(1)} {
+		ctx, cancel := contextFor(C.Rf_ScalarReal(C.double(timeout)))
+		if _, ok := ctx.Deadline(); ok || ctx.Err() != nil {
+			fmt.Printf("unexpected deadline for timeout %v: err=%v\n", timeout, ctx.Err())
+			failed = true
+		}
+		cancel()
+	}
+
+	ctx, cancel := contextFor(C.R_NilValue)
+	C.mock_interrupt()
+	interruptible(cancel, func() { <-ctx.Done() })
+	if ctx.Err() != context.Canceled {
+		fmt.Printf("unexpected context error after interrupt: %v\n", ctx.Err())
+		failed = true
+	}
+	if msg := message(interruptCondition(ctx.Err())); msg != "call interrupted" {
+		fmt.Printf("unexpected message for interrupt: %q\n", msg)
+		failed = true
+	}
+
+	func() {
+		defer func() {
+			r := recover()
+			if p, ok := r.(*callPanic); !ok || p.value != "failed" || len(p.stack) == 0 {
+				fmt.Printf("unexpected recovered value: %#v\n", r)
+				failed = true
+			}
+		}()
+		interruptible(func() {}, func() { panic("failed") })
+	}()
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
@@ -0,0 +1,179 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the copy_on_write_0
+// test package and the mock R API. It checks that shared R vectors are
+// duplicated before their memory is passed to Go unless the call uses
+// shared vectors in place, that duplicates are released when the call
+// returns, and that modification of vectors passed to read-only
+// functions is detected, including by their asynchronous and parallel
+// apply variants.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+
+unsigned long long R_hash(SEXP x);
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// realVector returns an R double vector holding v.
+func realVector(v ...float64) C.SEXP {
+	r := C.Rf_allocVector(C.REALSXP, C.R_xlen_t(len(v)))
+	copy((*[1 << 46]float64)(unsafe.Pointer(C.REAL(r)))[:len(v):len(v)], v)
+	return r
+}
+
+// mutationPanic returns the value recovered from a panic in checkUnmodified
+// for the R value p with the hash h.
+func mutationPanic(p C.SEXP, h C.ulonglong) (r interface{}) {
+	defer func() {
+		r = recover()
+	}()
+	checkUnmodified("x", p, h)
+	return nil
+}
+
+func init() {
+	var failed bool
+
+	shared := realVector(1, 2, 3)
+	C.Rf_protect(shared)
+	C.mock_set_shared(shared, 1)
+	unshared := realVector(1, 2, 3)
+	C.Rf_protect(unshared)
+
+	release := unshareArgs(false)
+	s := unpackSEXP_types_Slice___float64(shared)
+	s[0] = 10
+	if *C.REAL(shared) != 1 {
+		fmt.Println("modification of shared vector seen by R")
+		failed = true
+	}
+	if n := C.mock_preserved(); n != 1 {
+		fmt.Printf("unexpected number of preserved duplicates: %d\n", n)
+		failed = true
+	}
+	s = unpackSEXP_types_Slice___float64(unshared)
+	s[0] = 10
+	if *C.REAL(unshared) != 10 {
+		fmt.Println("unshared vector was not passed in place")
+		failed = true
+	}
+	inPlace := unshareArgs(true)
+	s = unpackSEXP_types_Slice___float64(shared)
+	s[1] = 20
+	if (*[3]float64)(unsafe.Pointer(C.REAL(shared)))[1] != 20 {
+		fmt.Println("shared vector was not passed in place")
+		failed = true
+	}
+	inPlace()
+	if sharedInPlace {
+		fmt.Println("in place setting not restored")
+		failed = true
+	}
+	release()
+	if n := C.mock_preserved(); n != 0 || len(duplicates) != 0 {
+		fmt.Printf("duplicates not released: preserved=%d duplicates=%d\n", n, len(duplicates))
+		failed = true
+	}
+
+	h := C.R_hash(shared)
+	if r := mutationPanic(shared, h); r != nil {
+		fmt.Printf("unexpected panic for unmodified vector: %v\n", r)
+		failed = true
+	}
+	*C.REAL(shared) = 5
+	r := mutationPanic(shared, h)
+	if _, ok := r.(*mutationError); !ok {
+		fmt.Printf("unexpected result for modified vector: %v\n", r)
+		failed = true
+	} else {
+		cond := recovered(r, "")
+		class := C.CString("go_mutation_error")
+		if C.Rf_inherits(cond, class) == 0 {
+			fmt.Println("mutation error condition does not have class go_mutation_error")
+			failed = true
+		}
+		C.free(unsafe.Pointer(class))
+	}
+
+	ints := C.Rf_allocVector(C.INTSXP, 2)
+	C.Rf_protect(ints)
+	C.mock_set_shared(ints, 1)
+	str := C.Rf_mkString(C.CString("a"))
+	C.Rf_protect(str)
+	err := C.R_NilValue
+	Wrapped_Test0(shared, &err)
+	Wrapped_Test1(shared, ints, str, &err)
+	Wrapped_Test2(C.Rf_allocVector(C.RAWSXP, 1), &err)
+	if err != C.R_NilValue {
+		fmt.Println("unexpected error from wrapped calls")
+		failed = true
+	}
+	if n := C.mock_preserved(); n != 0 {
+		fmt.Printf("duplicates not released after wrapped calls: %d\n", n)
+		failed = true
+	}
+
+	unmarked := realVector(1, 2)
+	C.Rf_protect(unmarked)
+	id := Wrapped_Test1_async(unmarked, ints, str, &err)
+	C.Rf_protect(id)
+	if n := C.mock_preserved(); n != 2 || C.MAYBE_SHARED(unmarked) == 0 {
+		fmt.Printf("checked async arguments not kept: preserved=%d shared=%d\n", n, C.MAYBE_SHARED(unmarked))
+		failed = true
+	}
+	Wrapped_asyncValue(id, &err)
+	if err != C.R_NilValue {
+		fmt.Println("unexpected error from unmodified async call")
+		failed = true
+	}
+	*C.REAL(unmarked) = 5
+	Wrapped_asyncValue(id, &err)
+	class := C.CString("go_mutation_error")
+	if err == C.R_NilValue || C.Rf_inherits(err, class) == 0 {
+		fmt.Println("modification of async call argument not detected")
+		failed = true
+	}
+	err = C.R_NilValue
+	Wrapped_asyncRelease(id, &err)
+	if n := C.mock_preserved(); err != C.R_NilValue || n != 0 {
+		fmt.Printf("async arguments not released: preserved=%d\n", n)
+		failed = true
+	}
+
+	args := C.Rf_allocVector(C.VECSXP, 1)
+	C.Rf_protect(args)
+	call := C.Rf_allocVector(C.VECSXP, 3)
+	C.SET_VECTOR_ELT(args, 0, call)
+	C.SET_VECTOR_ELT(call, 0, unmarked)
+	C.SET_VECTOR_ELT(call, 1, ints)
+	C.SET_VECTOR_ELT(call, 2, str)
+	res := Wrapped_Test1_map(args, C.R_NilValue, &err)
+	if err != C.R_NilValue || C.VECTOR_ELT(res, 0) != C.R_NilValue {
+		fmt.Println("unexpected failure of unmodified parallel call")
+		failed = true
+	}
+	C.Rf_unprotect(7)
+	C.free(unsafe.Pointer(class))
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
@@ -0,0 +1,93 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the error_condition_0
+// test package and the mock R API. It checks that the chain and classes
+// of go_error conditions include every error wrapped by an error,
+// including errors that wrap several errors.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// joinError is an error wrapping several errors, like those returned
+// by errors.Join.
+type joinError []error
+
+func (e joinError) Error() string { return "joined" }
+
+func (e joinError) Unwrap() []error { return e }
+
+// inherits returns whether the R value p has the given class.
+func inherits(p C.SEXP, class string) bool {
+	c := C.CString(class)
+	defer C.free(unsafe.Pointer(c))
+	return C.Rf_inherits(p, c) != 0
+}
+
+// chain returns the chain field of the go_error R condition p.
+func chain(p C.SEXP) []string {
+	v := C.VECTOR_ELT(p, 2)
+	s := make([]string, C.Rf_xlength(v))
+	for i := range s {
+		s[i] = C.GoString(C.R_CHAR(C.STRING_ELT(v, C.R_xlen_t(i))))
+	}
+	return s
+}
+
+func init() {
+	var failed bool
+
+	pathErr := &os.PathError{Op: "open", Path: "file", Err: os.ErrNotExist}
+	err := fmt.Errorf("wrapped: %w", joinError{errors.New("first"), pathErr, io.EOF})
+	c := goError(err)
+	want := []string{
+		"wrapped: joined",
+		"joined",
+		"first",
+		"open file: file does not exist",
+		"file does not exist",
+		"EOF",
+	}
+	if got := chain(c); !reflect.DeepEqual(got, want) {
+		fmt.Printf("unexpected error chain:\ngot: %q\nwant:%q\n", got, want)
+		failed = true
+	}
+	for _, class := range []string{"go_eof", "go_not_exist", "go_path_error", "go_error", "error", "condition"} {
+		if !inherits(c, class) {
+			fmt.Printf("condition for joined errors does not have class %q\n", class)
+			failed = true
+		}
+	}
+
+	c = goError(errors.New("plain"))
+	if got := chain(c); !reflect.DeepEqual(got, []string{"plain"}) {
+		fmt.Printf("unexpected error chain for unwrapped error: %q\n", got)
+		failed = true
+	}
+	for _, class := range []string{"go_eof", "go_not_exist", "go_path_error"} {
+		if inherits(c, class) {
+			fmt.Printf("condition for unwrapped error has class %q\n", class)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
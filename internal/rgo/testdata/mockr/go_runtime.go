@@ -0,0 +1,114 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the go_runtime_0 test
+// package and the mock R API. It checks that the Go runtime can be
+// configured and inspected by the functions generated for every package,
+// including disabling garbage collection.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+
+SEXP rgo_runtime_set(SEXP maxprocs, SEXP gc_percent, SEXP memory_limit);
+SEXP rgo_runtime_stats(void);
+SEXP rgo_runtime_gc(void);
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"unsafe"
+)
+
+// listValues returns the names and values of the R list of double
+// scalars l.
+func listValues(l C.SEXP) map[string]float64 {
+	names := C.Rf_getAttrib(l, C.R_NamesSymbol)
+	v := make(map[string]float64)
+	for i := C.R_xlen_t(0); i < C.Rf_xlength(l); i++ {
+		name := C.GoString(C.R_CHAR(C.STRING_ELT(names, i)))
+		v[name] = float64(*C.REAL(C.VECTOR_ELT(l, i)))
+	}
+	return v
+}
+
+func init() {
+	var failed bool
+
+	maxprocs := runtime.GOMAXPROCS(0)
+	gcPercent := debug.SetGCPercent(100)
+	debug.SetGCPercent(gcPercent)
+
+	prev := C.rgo_runtime_set(C.Rf_ScalarInteger(2), C.Rf_ScalarInteger(50), C.Rf_ScalarReal(1<<30))
+	got := listValues(prev)
+	if got["maxprocs"] != float64(maxprocs) || got["gc_percent"] != float64(gcPercent) || !math.IsInf(got["memory_limit"], 1) {
+		fmt.Printf("unexpected previous settings: %v\n", got)
+		failed = true
+	}
+	if n := runtime.GOMAXPROCS(0); n != 2 {
+		fmt.Printf("unexpected GOMAXPROCS: %d\n", n)
+		failed = true
+	}
+	if p := debug.SetGCPercent(50); p != 50 {
+		fmt.Printf("unexpected GC percent: %d\n", p)
+		failed = true
+	}
+	if l := debug.SetMemoryLimit(-1); l != 1<<30 {
+		fmt.Printf("unexpected memory limit: %d\n", l)
+		failed = true
+	}
+
+	prev = C.rgo_runtime_set(C.R_NilValue, C.R_NilValue, C.Rf_ScalarReal(C.double(math.Inf(1))))
+	got = listValues(prev)
+	if got["maxprocs"] != 2 || got["gc_percent"] != 50 || got["memory_limit"] != 1<<30 {
+		fmt.Printf("unexpected settings: %v\n", got)
+		failed = true
+	}
+	if l := debug.SetMemoryLimit(-1); l != math.MaxInt64 {
+		fmt.Printf("memory limit not removed: %d\n", l)
+		failed = true
+	}
+
+	C.rgo_runtime_set(C.R_NilValue, C.Rf_ScalarInteger(-1), C.R_NilValue)
+	got = listValues(C.rgo_runtime_set(C.R_NilValue, C.Rf_ScalarInteger(50), C.R_NilValue))
+	if got["gc_percent"] != -1 {
+		fmt.Printf("unexpected GC percent with garbage collection disabled: %v\n", got["gc_percent"])
+		failed = true
+	}
+
+	name := C.CString("go_type_error")
+	C.rgo_runtime_set(C.Rf_ScalarReal(2), C.R_NilValue, C.R_NilValue)
+	if C.Rf_inherits(C.mock_raised(), name) == 0 {
+		fmt.Println("expected type error for double maxprocs")
+		failed = true
+	}
+	C.free(unsafe.Pointer(name))
+	// R_raise does not return in R, unwinding its protection, but the
+	// mock stop does.
+	C.Rf_unprotect(2)
+
+	C.rgo_runtime_gc()
+	stats := listValues(C.rgo_runtime_stats())
+	if stats["num_forced_gc"] < 1 || stats["maxprocs"] != 2 || stats["goroutines"] < 1 || stats["heap_sys"] <= 0 {
+		fmt.Printf("unexpected runtime statistics: %v\n", stats)
+		failed = true
+	}
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
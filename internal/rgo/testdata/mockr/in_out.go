@@ -0,0 +1,122 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the in_out_0 test
+// package and the mock R API. It checks that in-out pointer parameters
+// are returned to R, named by their parameters, with the results, and
+// that structs packed as R lists can be unpacked again.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// message returns the message of the R condition p.
+func message(p C.SEXP) string {
+	return C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(p, 0), 0)))
+}
+
+// elements returns the names and elements of the R list l.
+func elements(l C.SEXP) ([]string, []C.SEXP) {
+	n := C.Rf_xlength(l)
+	names := C.Rf_getAttrib(l, C.R_NamesSymbol)
+	var (
+		keys []string
+		vals []C.SEXP
+	)
+	for i := C.R_xlen_t(0); i < n; i++ {
+		keys = append(keys, C.GoString(C.R_CHAR(C.STRING_ELT(names, i))))
+		vals = append(vals, C.VECTOR_ELT(l, i))
+	}
+	return keys, vals
+}
+
+// double returns the value of the R double scalar p.
+func double(p C.SEXP) float64 {
+	return float64(*C.REAL(p))
+}
+
+func init() {
+	var failed bool
+
+	f1 := C.CString("F1")
+	defer C.free(unsafe.Pointer(f1))
+	t := C.Rf_allocVector(C.VECSXP, 1)
+	C.SET_VECTOR_ELT(t, 0, C.Rf_ScalarReal(1.5))
+	names := C.Rf_allocVector(C.STRSXP, 1)
+	C.SET_STRING_ELT(names, 0, C.Rf_mkCharLenCE(f1, 2, C.CE_UTF8))
+	C.Rf_setAttrib(t, C.R_NamesSymbol, names)
+
+	err := C.R_NilValue
+	r := Wrapped_Test0(t, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for struct parameter: %s\n", message(err))
+		os.Exit(1)
+	}
+	if typ := C.TYPEOF(r); typ != C.VECSXP {
+		fmt.Printf("unexpected R type for packed struct: %d\n", typ)
+		os.Exit(1)
+	}
+	keys, vals := elements(r)
+	if !reflect.DeepEqual(keys, []string{"F1"}) || double(vals[0]) != 1.5 {
+		fmt.Printf("unexpected struct parameter returned: %q\n", keys)
+		failed = true
+	}
+	if got := unpackSEXP_types_Named_in_out_0_T(r); got.F1 != 1.5 {
+		fmt.Printf("unexpected round trip struct: %+v\n", got)
+		failed = true
+	}
+	r = Wrapped_Test0(r, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for returned struct passed back: %s\n", message(err))
+		os.Exit(1)
+	}
+	if _, vals = elements(r); double(vals[0]) != 1.5 {
+		fmt.Println("unexpected struct after passing back returned struct")
+		failed = true
+	}
+
+	r = Wrapped_Test1(t, C.Rf_ScalarReal(2.5), C.Rf_ScalarInteger(3), &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for in-out parameters: %s\n", message(err))
+		os.Exit(1)
+	}
+	if typ := C.TYPEOF(r); typ != C.VECSXP {
+		fmt.Printf("unexpected R type for result list: %d\n", typ)
+		os.Exit(1)
+	}
+	keys, vals = elements(r)
+	if !reflect.DeepEqual(keys, []string{"res0", "par1"}) {
+		fmt.Printf("unexpected result names: %q\n", keys)
+		failed = true
+	} else if *C.INTEGER(vals[0]) != 0 || double(vals[1]) != 2.5 {
+		fmt.Printf("unexpected results: %d %f\n", *C.INTEGER(vals[0]), double(vals[1]))
+		failed = true
+	}
+
+	r = Wrapped_Test1(t, C.R_NilValue, C.Rf_ScalarInteger(3), &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for nil in-out parameter: %s\n", message(err))
+		os.Exit(1)
+	}
+	if _, vals = elements(r); vals[1] != C.R_NilValue {
+		fmt.Println("expected NULL for nil in-out parameter")
+		failed = true
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,249 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the long_vector_0 test
+// package and the mock R API. It checks that Go slices round-trip through
+// R vectors and that R long vectors are unpacked without truncation.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// long is the length of the R long vectors used for testing. It is
+// longer than the maximum R short vector length of 2^31-1.
+const long = 1<<31 + 7
+
+var roundTrips = []struct {
+	typ       C.int
+	want      interface{}
+	roundTrip func(interface{}) (C.SEXP, interface{})
+}{
+	{
+		typ:  C.LGLSXP,
+		want: []bool{true, false, true},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___bool(v.([]bool))
+			return p, unpackSEXP_types_Slice___bool(p)
+		},
+	},
+	{
+		typ:  C.RAWSXP,
+		want: []byte{0, 1, math.MaxUint8},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___byte(v.([]byte))
+			return p, unpackSEXP_types_Slice___byte(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []int8{math.MinInt8, 0, math.MaxInt8},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___int8(v.([]int8))
+			return p, unpackSEXP_types_Slice___int8(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []int16{math.MinInt16, 0, math.MaxInt16},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___int16(v.([]int16))
+			return p, unpackSEXP_types_Slice___int16(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []int32{-math.MaxInt32, 0, math.MaxInt32},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___int32(v.([]int32))
+			return p, unpackSEXP_types_Slice___int32(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []int{-math.MaxInt32, 0, math.MaxInt32},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___int(v.([]int))
+			return p, unpackSEXP_types_Slice___int(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []uint16{0, math.MaxUint16},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___uint16(v.([]uint16))
+			return p, unpackSEXP_types_Slice___uint16(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []uint32{0, math.MaxInt32},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___uint32(v.([]uint32))
+			return p, unpackSEXP_types_Slice___uint32(p)
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: []uint{0, math.MaxInt32},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___uint(v.([]uint))
+			return p, unpackSEXP_types_Slice___uint(p)
+		},
+	},
+	{
+		typ:  C.REALSXP,
+		want: []float32{-1.5, 0, math.MaxFloat32},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___float32(v.([]float32))
+			return p, unpackSEXP_types_Slice___float32(p)
+		},
+	},
+	{
+		typ:  C.REALSXP,
+		want: []float64{math.Inf(-1), 0, math.MaxFloat64},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___float64(v.([]float64))
+			return p, unpackSEXP_types_Slice___float64(p)
+		},
+	},
+	{
+		typ:  C.CPLXSXP,
+		want: []complex64{1 + 2i, -3.5i},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___complex64(v.([]complex64))
+			return p, unpackSEXP_types_Slice___complex64(p)
+		},
+	},
+	{
+		typ:  C.CPLXSXP,
+		want: []complex128{1 + 2i, complex(math.Inf(1), -1)},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___complex128(v.([]complex128))
+			return p, unpackSEXP_types_Slice___complex128(p)
+		},
+	},
+	{
+		typ:  C.STRSXP,
+		want: []string{"", "ascii", "héllo, 世界"},
+		roundTrip: func(v interface{}) (C.SEXP, interface{}) {
+			p := packSEXP_types_Slice___string(v.([]string))
+			return p, unpackSEXP_types_Slice___string(p)
+		},
+	},
+}
+
+// longVectors are the slice types that are unpacked from R vectors
+// without copying. Each test sets the last element of the R vector p
+// and returns the length and last element of the unpacked slice.
+var longVectors = []struct {
+	typ    C.SEXPTYPE
+	want   interface{}
+	unpack func(p C.SEXP) (int, interface{})
+}{
+	{
+		typ:  C.RAWSXP,
+		want: byte(math.MaxUint8),
+		unpack: func(p C.SEXP) (int, interface{}) {
+			(*[1 << 49]byte)(unsafe.Pointer(C.RAW(p)))[long-1] = math.MaxUint8
+			s := unpackSEXP_types_Slice___byte(p)
+			return len(s), s[len(s)-1]
+		},
+	},
+	{
+		typ:  C.INTSXP,
+		want: int32(math.MaxInt32),
+		unpack: func(p C.SEXP) (int, interface{}) {
+			(*[1 << 47]int32)(unsafe.Pointer(C.INTEGER(p)))[long-1] = math.MaxInt32
+			s := unpackSEXP_types_Slice___int32(p)
+			return len(s), s[len(s)-1]
+		},
+	},
+	{
+		typ:  C.REALSXP,
+		want: math.Pi,
+		unpack: func(p C.SEXP) (int, interface{}) {
+			(*[1 << 46]float64)(unsafe.Pointer(C.REAL(p)))[long-1] = math.Pi
+			s := unpackSEXP_types_Slice___float64(p)
+			return len(s), s[len(s)-1]
+		},
+	},
+	{
+		typ:  C.CPLXSXP,
+		want: complex(math.Pi, -1),
+		unpack: func(p C.SEXP) (int, interface{}) {
+			(*[1 << 45]complex128)(unsafe.Pointer(C.COMPLEX(p)))[long-1] = complex(math.Pi, -1)
+			s := unpackSEXP_types_Slice___complex128(p)
+			return len(s), s[len(s)-1]
+		},
+	},
+}
+
+func init() {
+	var failed bool
+	for _, test := range roundTrips {
+		p, got := test.roundTrip(test.want)
+		if typ := C.TYPEOF(p); typ != test.typ {
+			fmt.Printf("unexpected R type for %T: got:%d want:%d\n", test.want, typ, test.typ)
+			failed = true
+		}
+		if n := int(C.Rf_xlength(p)); n != reflect.ValueOf(test.want).Len() {
+			fmt.Printf("unexpected R length for %T: got:%d want:%d\n", test.want, n, reflect.ValueOf(test.want).Len())
+			failed = true
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			fmt.Printf("unexpected round trip result for %T: got:%v want:%v\n", test.want, got, test.want)
+			failed = true
+		}
+		if depth := C.mock_protect_depth(); depth != 0 {
+			fmt.Printf("unbalanced protection for %T: depth=%d\n", test.want, depth)
+			failed = true
+		}
+	}
+
+	p := packSEXP_types_Slice___error([]error{nil, errors.New("failed")})
+	if C.TYPEOF(p) != C.STRSXP || C.Rf_xlength(p) != 2 {
+		fmt.Printf("unexpected R value for []error: type=%d length=%d\n", C.TYPEOF(p), C.Rf_xlength(p))
+		failed = true
+	} else {
+		if C.STRING_ELT(p, 0) != C.R_NaString {
+			fmt.Println("nil error not packed as NA")
+			failed = true
+		}
+		if msg := C.GoString(C.R_CHAR(C.STRING_ELT(p, 1))); msg != "failed" {
+			fmt.Printf("unexpected error message: got:%q want:%q\n", msg, "failed")
+			failed = true
+		}
+	}
+
+	for _, test := range longVectors {
+		p := C.Rf_allocVector(test.typ, long)
+		n, last := test.unpack(p)
+		if n != long {
+			fmt.Printf("unexpected length for long %T slice: got:%d want:%d\n", test.want, n, long)
+			failed = true
+		}
+		if last != test.want {
+			fmt.Printf("unexpected last element for long %T slice: got:%v want:%v\n", test.want, last, test.want)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
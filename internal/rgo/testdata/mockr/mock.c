@@ -0,0 +1,897 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Mock implementation of the parts of the R API used by rgo generated
+// code. Objects are never freed. Vectors large enough to be R long
+// vectors are mapped without reserving memory so that only the pages
+// that are touched are allocated.
+
+#include <stdarg.h>
+#include <stdint.h>
+#include <sys/mman.h>
+
+#include <Rinternals.h>
+
+struct SEXPREC {
+	SEXPTYPE type;
+	cetype_t enc;
+	R_xlen_t length;
+	void *data;
+	SEXP attrib;
+	SEXP car;
+	SEXP cdr;
+	int shared;
+
+	SEXP next;  // Next allocated object, for mock_gc.
+	int marked; // Whether the object is reachable, for mock_gc.
+};
+
+SEXP R_NilValue;
+SEXP R_NaString;
+SEXP R_BaseEnv;
+SEXP R_GlobalEnv;
+SEXP R_NamesSymbol;
+SEXP R_ClassSymbol;
+SEXP R_DimSymbol;
+
+static SEXP symbols;
+static SEXP raised;
+
+// signalled holds the conditions passed to warning and message as a
+// pairlist ending at signalledTail.
+static SEXP signalled, signalledTail;
+
+// options holds the R options set by mock_set_option as a pairlist
+// with the option names held in the attrib field of each cell.
+static SEXP options;
+
+// protectStack holds the protected objects and preservedList holds the
+// preserved objects as a pairlist. heap holds all objects allocated by
+// newSEXP linked by their next field.
+static SEXP protectStack[1 << 16];
+static int protected;
+static SEXP preservedList;
+static int preserved;
+static SEXP heap;
+
+static void fatal(const char *format, ...) {
+	va_list args;
+	va_start(args, format);
+	fprintf(stderr, "mock R: ");
+	vfprintf(stderr, format, args);
+	fprintf(stderr, "\n");
+	va_end(args);
+	abort();
+}
+
+static void *alloc(size_t n) {
+	if (n < 1<<30) {
+		void *p = calloc(1, n == 0 ? 1 : n);
+		if (p == NULL) {
+			fatal("failed to allocate %zu bytes", n);
+		}
+		return p;
+	}
+	void *p = mmap(NULL, n, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_ANONYMOUS|MAP_NORESERVE, -1, 0);
+	if (p == MAP_FAILED) {
+		fatal("failed to map %zu bytes", n);
+	}
+	return p;
+}
+
+static SEXP newSEXP(SEXPTYPE type) {
+	SEXP s = alloc(sizeof(struct SEXPREC));
+	s->type = type;
+	s->attrib = R_NilValue;
+	s->car = R_NilValue;
+	s->cdr = R_NilValue;
+	s->next = heap;
+	heap = s;
+	return s;
+}
+
+static SEXP cons(SEXP car, SEXP cdr) {
+	SEXP s = newSEXP(LISTSXP);
+	s->car = car;
+	s->cdr = cdr;
+	return s;
+}
+
+__attribute__((constructor)) static void init(void) {
+	R_NilValue = alloc(sizeof(struct SEXPREC));
+	R_NilValue->type = NILSXP;
+	R_NilValue->attrib = R_NilValue;
+	R_NilValue->car = R_NilValue;
+	R_NilValue->cdr = R_NilValue;
+	symbols = R_NilValue;
+	raised = R_NilValue;
+	signalled = R_NilValue;
+	options = R_NilValue;
+	preservedList = R_NilValue;
+	R_NaString = Rf_mkCharLenCE("NA", 2, CE_NATIVE);
+	R_BaseEnv = newSEXP(ENVSXP);
+	R_GlobalEnv = newSEXP(ENVSXP);
+	R_NamesSymbol = Rf_install("names");
+	R_ClassSymbol = Rf_install("class");
+	R_DimSymbol = Rf_install("dim");
+}
+
+static void check(SEXP x, SEXPTYPE type, const char *fn) {
+	if (x->type != type) {
+		fatal("%s called on SEXP of type %u", fn, x->type);
+	}
+}
+
+static void checkIndex(SEXP x, R_xlen_t i, const char *fn) {
+	if (i < 0 || i >= x->length) {
+		fatal("%s index %td out of range [0,%td)", fn, i, x->length);
+	}
+}
+
+int TYPEOF(SEXP x) {
+	return x->type;
+}
+
+void SET_TYPEOF(SEXP x, int v) {
+	x->type = v;
+}
+
+R_xlen_t XLENGTH(SEXP x) {
+	switch (x->type) {
+	case CHARSXP:
+	case LGLSXP:
+	case INTSXP:
+	case REALSXP:
+	case CPLXSXP:
+	case STRSXP:
+	case VECSXP:
+	case RAWSXP:
+		return x->length;
+	default:
+		fatal("XLENGTH called on SEXP of type %u", x->type);
+		return 0;
+	}
+}
+
+R_xlen_t Rf_xlength(SEXP x) {
+	switch (x->type) {
+	case NILSXP:
+		return 0;
+	case LISTSXP:
+	case LANGSXP: {
+		R_xlen_t n = 0;
+		for (; x != R_NilValue; x = x->cdr) {
+			n++;
+		}
+		return n;
+	}
+	case ENVSXP:
+	case SYMSXP:
+		return 1;
+	default:
+		return XLENGTH(x);
+	}
+}
+
+int Rf_length(SEXP x) {
+	R_xlen_t n = Rf_xlength(x);
+	if (n > INT32_MAX) {
+		fatal("length called on long vector of length %td", n);
+	}
+	return (int)n;
+}
+
+Rboolean Rf_isNull(SEXP s) {
+	return s->type == NILSXP;
+}
+
+Rboolean Rf_inherits(SEXP s, const char *name) {
+	SEXP class = Rf_getAttrib(s, R_ClassSymbol);
+	if (class->type != STRSXP) {
+		return FALSE;
+	}
+	for (R_xlen_t i = 0; i < class->length; i++) {
+		if (strcmp(CHAR(STRING_ELT(class, i)), name) == 0) {
+			return TRUE;
+		}
+	}
+	return FALSE;
+}
+
+SEXP Rf_protect(SEXP s) {
+	if (protected == sizeof(protectStack) / sizeof(protectStack[0])) {
+		fatal("protect stack overflow");
+	}
+	protectStack[protected++] = s;
+	return s;
+}
+
+void Rf_unprotect(int n) {
+	if (n > protected) {
+		fatal("unprotect(%d) with only %d protected", n, protected);
+	}
+	protected -= n;
+}
+
+int mock_protect_depth(void) {
+	return protected;
+}
+
+void R_PreserveObject(SEXP s) {
+	preservedList = cons(s, preservedList);
+	preserved++;
+}
+
+void R_ReleaseObject(SEXP s) {
+	for (SEXP *p = &preservedList; *p != R_NilValue; p = &(*p)->cdr) {
+		if ((*p)->car == s) {
+			*p = (*p)->cdr;
+			preserved--;
+			return;
+		}
+	}
+	fatal("ReleaseObject of an object that is not preserved");
+}
+
+int mock_preserved(void) {
+	return preserved;
+}
+
+static void mark(SEXP s) {
+	for (; !s->marked; s = s->cdr) {
+		s->marked = 1;
+		mark(s->attrib);
+		mark(s->car);
+		if (s->type == STRSXP || s->type == VECSXP) {
+			for (R_xlen_t i = 0; i < s->length; i++) {
+				mark(((SEXP *)s->data)[i]);
+			}
+		}
+	}
+}
+
+void mock_gc(void) {
+	SEXP roots[] = {R_NilValue, R_NaString, R_BaseEnv, R_GlobalEnv, symbols, raised, signalled, options, preservedList};
+	for (size_t i = 0; i < sizeof(roots) / sizeof(roots[0]); i++) {
+		mark(roots[i]);
+	}
+	for (int i = 0; i < protected; i++) {
+		mark(protectStack[i]);
+	}
+	for (SEXP s = heap; s != NULL; s = s->next) {
+		if (s->marked) {
+			s->marked = 0;
+			continue;
+		}
+		size_t size;
+		switch (s->type) {
+		case CHARSXP:
+		case RAWSXP:
+			size = 1;
+			break;
+		case LGLSXP:
+		case INTSXP:
+			size = sizeof(int);
+			break;
+		case REALSXP:
+			size = sizeof(double);
+			break;
+		case CPLXSXP:
+			size = sizeof(Rcomplex);
+			break;
+		default:
+			continue;
+		}
+		memset(s->data, 0xa5, size * (size_t)s->length);
+	}
+	R_NilValue->marked = 0;
+}
+
+int MAYBE_SHARED(SEXP x) {
+	return x->shared;
+}
+
+void MARK_NOT_MUTABLE(SEXP x) {
+	x->shared = 1;
+}
+
+void mock_set_shared(SEXP x, int shared) {
+	x->shared = shared;
+}
+
+// Rf_duplicate duplicates vectors, sharing their attributes.
+SEXP Rf_duplicate(SEXP s) {
+	size_t size;
+	switch (s->type) {
+	case NILSXP:
+	case CHARSXP:
+		return s;
+	case LGLSXP:
+	case INTSXP:
+		size = sizeof(int);
+		break;
+	case REALSXP:
+		size = sizeof(double);
+		break;
+	case CPLXSXP:
+		size = sizeof(Rcomplex);
+		break;
+	case STRSXP:
+	case VECSXP:
+		size = sizeof(SEXP);
+		break;
+	case RAWSXP:
+		size = sizeof(Rbyte);
+		break;
+	default:
+		fatal("duplicate called on SEXP of type %u", s->type);
+		return NULL;
+	}
+	SEXP d = Rf_allocVector(s->type, s->length);
+	d->attrib = s->attrib;
+	memcpy(d->data, s->data, size * (size_t)s->length);
+	if (s->type == VECSXP) {
+		SEXP *elem = d->data;
+		for (R_xlen_t i = 0; i < d->length; i++) {
+			elem[i] = Rf_duplicate(elem[i]);
+		}
+	}
+	return d;
+}
+
+SEXP Rf_allocVector(SEXPTYPE type, R_xlen_t n) {
+	if (n < 0) {
+		fatal("negative length vectors are not allowed: %td", n);
+	}
+	size_t size;
+	switch (type) {
+	case LGLSXP:
+	case INTSXP:
+		size = sizeof(int);
+		break;
+	case REALSXP:
+		size = sizeof(double);
+		break;
+	case CPLXSXP:
+		size = sizeof(Rcomplex);
+		break;
+	case STRSXP:
+	case VECSXP:
+		size = sizeof(SEXP);
+		break;
+	case RAWSXP:
+		size = sizeof(Rbyte);
+		break;
+	case LISTSXP:
+		return Rf_allocList((int)n);
+	default:
+		fatal("allocVector called with type %u", type);
+		return NULL;
+	}
+	SEXP s = newSEXP(type);
+	s->length = n;
+	s->data = alloc(size * (size_t)n);
+	if (type == STRSXP || type == VECSXP) {
+		SEXP fill = type == STRSXP ? Rf_mkCharLenCE("", 0, CE_NATIVE) : R_NilValue;
+		SEXP *elem = s->data;
+		for (R_xlen_t i = 0; i < n; i++) {
+			elem[i] = fill;
+		}
+	}
+	return s;
+}
+
+SEXP Rf_allocList(int n) {
+	SEXP s = R_NilValue;
+	for (int i = 0; i < n; i++) {
+		s = cons(R_NilValue, s);
+	}
+	return s;
+}
+
+SEXP SETCAR(SEXP x, SEXP y) {
+	if (x->type != LISTSXP && x->type != LANGSXP) {
+		fatal("SETCAR called on SEXP of type %u", x->type);
+	}
+	x->car = y;
+	return y;
+}
+
+SEXP CAR(SEXP e) {
+	return e->car;
+}
+
+SEXP CDR(SEXP e) {
+	return e->cdr;
+}
+
+static SEXP symbol(SEXP name) {
+	switch (name->type) {
+	case SYMSXP:
+		return name;
+	case STRSXP:
+		if (name->length == 1) {
+			return Rf_install(CHAR(STRING_ELT(name, 0)));
+		}
+	}
+	fatal("invalid attribute name");
+	return NULL;
+}
+
+SEXP Rf_getAttrib(SEXP vec, SEXP name) {
+	name = symbol(name);
+	for (SEXP a = vec->attrib; a != R_NilValue; a = a->cdr) {
+		if (a->car->car == name) {
+			return a->car->cdr;
+		}
+	}
+	return R_NilValue;
+}
+
+SEXP Rf_setAttrib(SEXP vec, SEXP name, SEXP val) {
+	if (vec == R_NilValue) {
+		fatal("attempt to set an attribute on NULL");
+	}
+	name = symbol(name);
+	for (SEXP a = vec->attrib; a != R_NilValue; a = a->cdr) {
+		if (a->car->car == name) {
+			a->car->cdr = val;
+			return val;
+		}
+	}
+	vec->attrib = cons(cons(name, val), vec->attrib);
+	return val;
+}
+
+int *LOGICAL(SEXP x) {
+	check(x, LGLSXP, "LOGICAL");
+	return x->data;
+}
+
+int *INTEGER(SEXP x) {
+	check(x, INTSXP, "INTEGER");
+	return x->data;
+}
+
+Rbyte *RAW(SEXP x) {
+	check(x, RAWSXP, "RAW");
+	return x->data;
+}
+
+double *REAL(SEXP x) {
+	check(x, REALSXP, "REAL");
+	return x->data;
+}
+
+Rcomplex *COMPLEX(SEXP x) {
+	check(x, CPLXSXP, "COMPLEX");
+	return x->data;
+}
+
+SEXP STRING_ELT(SEXP x, R_xlen_t i) {
+	check(x, STRSXP, "STRING_ELT");
+	checkIndex(x, i, "STRING_ELT");
+	return ((SEXP *)x->data)[i];
+}
+
+void SET_STRING_ELT(SEXP x, R_xlen_t i, SEXP v) {
+	check(x, STRSXP, "SET_STRING_ELT");
+	checkIndex(x, i, "SET_STRING_ELT");
+	if (v->type != CHARSXP) {
+		fatal("SET_STRING_ELT called with SEXP of type %u", v->type);
+	}
+	((SEXP *)x->data)[i] = v;
+}
+
+SEXP VECTOR_ELT(SEXP x, R_xlen_t i) {
+	check(x, VECSXP, "VECTOR_ELT");
+	checkIndex(x, i, "VECTOR_ELT");
+	return ((SEXP *)x->data)[i];
+}
+
+SEXP SET_VECTOR_ELT(SEXP x, R_xlen_t i, SEXP v) {
+	check(x, VECSXP, "SET_VECTOR_ELT");
+	checkIndex(x, i, "SET_VECTOR_ELT");
+	((SEXP *)x->data)[i] = v;
+	return v;
+}
+
+SEXP Rf_mkCharLenCE(const char *s, int len, cetype_t enc) {
+	if (len < 0) {
+		fatal("negative string length: %d", len);
+	}
+	if (memchr(s, 0, len) != NULL) {
+		fatal("embedded nul in string");
+	}
+	SEXP c = newSEXP(CHARSXP);
+	c->enc = enc;
+	c->length = len;
+	c->data = alloc(len + 1);
+	memcpy(c->data, s, len);
+	return c;
+}
+
+const char *R_CHAR(SEXP x) {
+	check(x, CHARSXP, "CHAR");
+	return x->data;
+}
+
+cetype_t Rf_getCharCE(SEXP x) {
+	check(x, CHARSXP, "getCharCE");
+	return x->enc;
+}
+
+const char *Rf_translateCharUTF8(SEXP x) {
+	check(x, CHARSXP, "translateCharUTF8");
+	if (x->enc != CE_LATIN1) {
+		return x->data;
+	}
+	const unsigned char *s = x->data;
+	char *t = alloc(2 * x->length + 1);
+	char *p = t;
+	for (R_xlen_t i = 0; i < x->length; i++) {
+		if (s[i] < 0x80) {
+			*p++ = s[i];
+		} else {
+			*p++ = 0xc0 | s[i] >> 6;
+			*p++ = 0x80 | (s[i] & 0x3f);
+		}
+	}
+	return t;
+}
+
+SEXP Rf_mkString(const char *s) {
+	return Rf_ScalarString(Rf_mkCharLenCE(s, strlen(s), CE_NATIVE));
+}
+
+SEXP Rf_ScalarLogical(int x) {
+	SEXP s = Rf_allocVector(LGLSXP, 1);
+	LOGICAL(s)[0] = x;
+	return s;
+}
+
+SEXP Rf_ScalarInteger(int x) {
+	SEXP s = Rf_allocVector(INTSXP, 1);
+	INTEGER(s)[0] = x;
+	return s;
+}
+
+SEXP Rf_ScalarReal(double x) {
+	SEXP s = Rf_allocVector(REALSXP, 1);
+	REAL(s)[0] = x;
+	return s;
+}
+
+SEXP Rf_ScalarComplex(Rcomplex x) {
+	SEXP s = Rf_allocVector(CPLXSXP, 1);
+	COMPLEX(s)[0] = x;
+	return s;
+}
+
+SEXP Rf_ScalarString(SEXP x) {
+	SEXP s = Rf_allocVector(STRSXP, 1);
+	SET_STRING_ELT(s, 0, x);
+	return s;
+}
+
+SEXP Rf_install(const char *name) {
+	for (SEXP s = symbols; s != R_NilValue; s = s->cdr) {
+		if (strcmp(s->car->data, name) == 0) {
+			return s->car;
+		}
+	}
+	SEXP sym = newSEXP(SYMSXP);
+	sym->data = strdup(name);
+	symbols = cons(sym, symbols);
+	return sym;
+}
+
+SEXP Rf_lang2(SEXP s, SEXP t) {
+	SEXP l = cons(s, cons(t, R_NilValue));
+	l->type = LANGSXP;
+	return l;
+}
+
+SEXP Rf_lang3(SEXP s, SEXP t, SEXP u) {
+	SEXP l = cons(s, cons(t, cons(u, R_NilValue)));
+	l->type = LANGSXP;
+	return l;
+}
+
+SEXP Rf_lang4(SEXP s, SEXP t, SEXP u, SEXP v) {
+	SEXP l = cons(s, cons(t, cons(u, cons(v, R_NilValue))));
+	l->type = LANGSXP;
+	return l;
+}
+
+// Rf_eval only evaluates calls to stop, warning and message, recording
+// the condition.
+SEXP Rf_eval(SEXP e, SEXP rho) {
+	if (e->type == LANGSXP && e->car == Rf_install("stop")) {
+		raised = e->cdr->car;
+		return R_NilValue;
+	}
+	if (e->type == LANGSXP && (e->car == Rf_install("warning") || e->car == Rf_install("message"))) {
+		SEXP cell = cons(e->cdr->car, R_NilValue);
+		if (signalled == R_NilValue) {
+			signalled = cell;
+		} else {
+			signalledTail->cdr = cell;
+		}
+		signalledTail = cell;
+		return R_NilValue;
+	}
+	fatal("eval is not supported");
+	return NULL;
+}
+
+SEXP mock_raised(void) {
+	return raised;
+}
+
+SEXP mock_signalled(void) {
+	SEXP s = signalled;
+	signalled = R_NilValue;
+	return s;
+}
+
+// interrupt_pending is whether a user interrupt is pending and
+// interrupted is whether R_CheckUserInterrupt has jumped out of
+// the current top level context.
+static int interrupt_pending, interrupted;
+
+void mock_interrupt(void) {
+	interrupt_pending = 1;
+}
+
+// R_CheckUserInterrupt consumes a pending user interrupt. The jump to
+// the top level context is recorded rather than made.
+void R_CheckUserInterrupt(void) {
+	if (interrupt_pending) {
+		interrupt_pending = 0;
+		interrupted = 1;
+	}
+}
+
+// rng_seed is the saved state of the random number generator, the
+// equivalent of .Random.seed, and rng is its working state, which is
+// only valid between GetRNGstate and PutRNGstate.
+static unsigned int rng_seed, rng;
+static int rng_loaded;
+
+void mock_set_seed(unsigned int seed) {
+	rng_seed = seed;
+}
+
+int mock_rng_state(void) {
+	return (int)rng_seed;
+}
+
+void GetRNGstate(void) {
+	rng = rng_seed;
+	rng_loaded = 1;
+}
+
+void PutRNGstate(void) {
+	if (!rng_loaded) {
+		fatal("PutRNGstate without GetRNGstate");
+	}
+	rng_seed = rng;
+	rng_loaded = 0;
+}
+
+// unif_rand returns values from a linear congruential generator in the
+// open interval (0, 1).
+double unif_rand(void) {
+	if (!rng_loaded) {
+		fatal("unif_rand without GetRNGstate");
+	}
+	rng = rng * 1664525u + 1013904223u;
+	return (rng + 0.5) / 4294967296.0;
+}
+
+Rboolean R_ToplevelExec(void (*fun)(void *), void *data) {
+	interrupted = 0;
+	fun(data);
+	return interrupted ? FALSE : TRUE;
+}
+
+// connections holds the state of the connections made by mock_connection.
+// As in R, a connection is an integer vector with class "connection"; its
+// element is the index of its state.
+static struct {
+	char *in, *out;
+	size_t len, pos, written;
+	int fail;
+} connections[16];
+static int nconnections;
+
+SEXP mock_connection(const char *data, int n) {
+	if (nconnections == sizeof(connections) / sizeof(connections[0])) {
+		fatal("too many connections");
+	}
+	connections[nconnections].in = alloc(n);
+	memcpy(connections[nconnections].in, data, n);
+	connections[nconnections].len = n;
+	SEXP con = Rf_ScalarInteger(nconnections++);
+	Rf_setAttrib(con, R_ClassSymbol, Rf_mkString("connection"));
+	return con;
+}
+
+// connection returns the index of the state of the connection con.
+static int connection(SEXP con) {
+	if (!Rf_inherits(con, "connection")) {
+		fatal("argument is not a connection");
+	}
+	return INTEGER(con)[0];
+}
+
+SEXP mock_connection_written(SEXP con) {
+	int i = connection(con);
+	SEXP r = Rf_allocVector(RAWSXP, connections[i].written);
+	memcpy(RAW(r), connections[i].out, connections[i].written);
+	return r;
+}
+
+void mock_connection_fail(SEXP con) {
+	connections[connection(con)].fail = 1;
+}
+
+// R_tryEval only evaluates calls to readBin and writeBin on connections
+// made by mock_connection.
+SEXP R_tryEval(SEXP e, SEXP env, int *ErrorOccurred) {
+	*ErrorOccurred = 0;
+	if (e->type == LANGSXP && e->car == Rf_install("readBin")) {
+		int i = connection(e->cdr->car);
+		if (connections[i].fail) {
+			*ErrorOccurred = 1;
+			return R_NilValue;
+		}
+		size_t n = (size_t)REAL(e->cdr->cdr->cdr->car)[0];
+		if (n > connections[i].len - connections[i].pos) {
+			n = connections[i].len - connections[i].pos;
+		}
+		SEXP r = Rf_allocVector(RAWSXP, n);
+		memcpy(RAW(r), connections[i].in + connections[i].pos, n);
+		connections[i].pos += n;
+		return r;
+	}
+	if (e->type == LANGSXP && e->car == Rf_install("writeBin")) {
+		int i = connection(e->cdr->cdr->car);
+		if (connections[i].fail) {
+			*ErrorOccurred = 1;
+			return R_NilValue;
+		}
+		SEXP b = e->cdr->car;
+		connections[i].out = realloc(connections[i].out, connections[i].written + b->length);
+		if (connections[i].out == NULL) {
+			fatal("failed to allocate connection buffer");
+		}
+		memcpy(connections[i].out + connections[i].written, RAW(b), b->length);
+		connections[i].written += b->length;
+		return R_NilValue;
+	}
+	fatal("tryEval is not supported for this call");
+	return NULL;
+}
+
+// errorBuf holds the message of the last error raised by stop in
+// R_tryEvalSilent.
+static char errorBuf[256];
+
+// R_tryEvalSilent only evaluates calls to identity, returning its
+// argument, and to stop, failing with its message. The functions may
+// be qualified with a package.
+SEXP R_tryEvalSilent(SEXP e, SEXP env, int *ErrorOccurred) {
+	SEXP fn = e->car;
+	if (fn->type == LANGSXP && fn->car == Rf_install("::")) {
+		fn = fn->cdr->cdr->car;
+	}
+	*ErrorOccurred = 0;
+	if (e->type == LANGSXP && fn == Rf_install("identity")) {
+		return e->cdr->car;
+	}
+	if (e->type == LANGSXP && fn == Rf_install("stop")) {
+		snprintf(errorBuf, sizeof(errorBuf), "Error: %s\n", R_CHAR(STRING_ELT(e->cdr->car, 0)));
+		*ErrorOccurred = 1;
+		return R_NilValue;
+	}
+	fatal("tryEvalSilent is not supported for this call");
+	return NULL;
+}
+
+const char *R_curErrorBuf(void) {
+	return errorBuf;
+}
+
+void Rf_warning(const char *format, ...) {
+	va_list args;
+	va_start(args, format);
+	fprintf(stderr, "Warning message:\n");
+	vfprintf(stderr, format, args);
+	fprintf(stderr, "\n");
+	va_end(args);
+}
+
+void mock_set_option(const char *name, SEXP value) {
+	SEXP tag = Rf_install(name);
+	for (SEXP o = options; o != R_NilValue; o = o->cdr) {
+		if (o->attrib == tag) {
+			o->car = value;
+			return;
+		}
+	}
+	options = cons(value, options);
+	options->attrib = tag;
+}
+
+// Options ending in redirectSuffix are FALSE unless set by a driver,
+// since redirected output, including the output of the driver itself,
+// is held by the mock console rather than printed.
+static const char redirectSuffix[] = ".redirect_output";
+
+SEXP Rf_GetOption1(SEXP tag) {
+	for (SEXP o = options; o != R_NilValue; o = o->cdr) {
+		if (o->attrib == tag) {
+			return o->car;
+		}
+	}
+	size_t n = strlen(tag->data), m = strlen(redirectSuffix);
+	if (n >= m && strcmp((char *)tag->data + n - m, redirectSuffix) == 0) {
+		return Rf_ScalarLogical(0);
+	}
+	return R_NilValue;
+}
+
+int Rf_asLogical(SEXP x) {
+	switch (x->type) {
+	case LGLSXP:
+	case INTSXP:
+		if (x->length > 0) {
+			return ((int *)x->data)[0];
+		}
+	}
+	return INT32_MIN;
+}
+
+// console holds the text written to the R console and its error stream.
+static struct {
+	char *buf;
+	size_t len;
+} console[2];
+
+static void console_printf(int err, const char *format, va_list args) {
+	va_list n;
+	va_copy(n, args);
+	int len = vsnprintf(NULL, 0, format, n);
+	va_end(n);
+	console[err].buf = realloc(console[err].buf, console[err].len + len + 1);
+	if (console[err].buf == NULL) {
+		fatal("failed to allocate console buffer");
+	}
+	vsnprintf(console[err].buf + console[err].len, len + 1, format, args);
+	console[err].len += len;
+}
+
+void Rprintf(const char *format, ...) {
+	va_list args;
+	va_start(args, format);
+	console_printf(0, format, args);
+	va_end(args);
+}
+
+void REprintf(const char *format, ...) {
+	va_list args;
+	va_start(args, format);
+	console_printf(1, format, args);
+	va_end(args);
+}
+
+const char *mock_console(int err) {
+	err = err != 0;
+	char *s = console[err].buf == NULL ? "" : console[err].buf;
+	console[err].buf = NULL;
+	console[err].len = 0;
+	return s;
+}
@@ -0,0 +1,150 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the output_0 test
+// package and the mock R API. It checks that output written by Go code
+// to os.Stdout, os.Stderr and the standard and structured loggers is
+// written to the R console unless the redirect_output option is false,
+// that the outputs are redirected once and not restored, that output
+// written between calls is passed through rather than held, and that NUL
+// bytes do not truncate console output.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// setOption sets the R option name to the logical value v.
+func setOption(name string, v bool) {
+	c := C.CString(name)
+	defer C.free(unsafe.Pointer(c))
+	var l C.int
+	if v {
+		l = 1
+	}
+	C.mock_set_option(c, C.Rf_ScalarLogical(l))
+}
+
+func init() {
+	var failed bool
+
+	// Output is redirected for the rest of the process once the first
+	// call finds the option true, so failures are reported to the
+	// original standard output.
+	stdout, stderr := os.Stdout, os.Stderr
+	setOption("output_0.redirect_output", true)
+	flush := redirectOutput()
+	fmt.Println("to stdout")
+	fmt.Print("nul\x00byte\n")
+	fmt.Fprintln(os.Stderr, "to stderr")
+	log.Print("logged")
+	slog.Info("structured")
+	flush()
+	if os.Stdout != console.outW || os.Stderr != console.errW || log.Writer() != console.errW {
+		fmt.Fprintln(stdout, "outputs not redirected")
+		failed = true
+	}
+	if console.stdout != stdout || console.stderr != stderr {
+		fmt.Fprintln(stdout, "original outputs not kept")
+		failed = true
+	}
+	if got := C.GoString(C.mock_console(0)); got != "to stdout\nnulbyte\n" {
+		fmt.Fprintf(stdout, "unexpected console output: %q\n", got)
+		failed = true
+	}
+	got := C.GoString(C.mock_console(1))
+	for _, want := range []string{"to stderr\n", "logged\n", "structured\n"} {
+		if !strings.Contains(got, want) {
+			fmt.Fprintf(stdout, "missing %q in console error output: %q\n", want, got)
+			failed = true
+		}
+	}
+
+	flush = redirectOutput()
+	interruptible(func() {}, func() {
+		fmt.Print("progress")
+		time.Sleep(3 * interruptPoll)
+	})
+	if got := C.GoString(C.mock_console(0)); got != "progress" {
+		fmt.Fprintf(stdout, "unexpected console output while running: %q\n", got)
+		failed = true
+	}
+	flush()
+
+	r, w, perr := os.Pipe()
+	if perr != nil {
+		fmt.Fprintf(stdout, "failed to make pipe: %v\n", perr)
+		os.Exit(1)
+	}
+	console.mu.Lock()
+	console.stdout = w
+	console.mu.Unlock()
+	fmt.Print("between calls ")
+	syncOutput()
+	console.mu.Lock()
+	held := len(console.chunks)
+	console.mu.Unlock()
+	if held != 0 {
+		fmt.Fprintf(stdout, "output held between calls: %d chunks\n", held)
+		failed = true
+	}
+	setOption("output_0.redirect_output", false)
+	flush = redirectOutput()
+	fmt.Print("passed through")
+	flush()
+	syncOutput()
+	w.Close()
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "between calls passed through" {
+		fmt.Fprintf(stdout, "unexpected output between calls and with option false: %q\n", b)
+		failed = true
+	}
+	if got := C.GoString(C.mock_console(0)); got != "" {
+		fmt.Fprintf(stdout, "unexpected console output with option false: %q\n", got)
+		failed = true
+	}
+	if os.Stdout != console.outW {
+		fmt.Fprintln(stdout, "unexpected reassignment with option false")
+		failed = true
+	}
+	console.mu.Lock()
+	console.stdout = stdout
+	console.mu.Unlock()
+	setOption("output_0.redirect_output", true)
+
+	err := C.R_NilValue
+	Wrapped_Test0(C.Rf_mkString(C.CString("a")), &err)
+	if err != C.R_NilValue || os.Stdout != console.outW {
+		fmt.Fprintln(stdout, "unexpected state after wrapped call")
+		failed = true
+	}
+	if got := C.GoString(C.mock_console(0)) + C.GoString(C.mock_console(1)); got != "" {
+		fmt.Fprintf(stdout, "unexpected console output: %q\n", got)
+		failed = true
+	}
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Fprintf(stdout, "unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Fprintln(stdout, "PASS")
+	os.Exit(0)
+}
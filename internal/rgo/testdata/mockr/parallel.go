@@ -0,0 +1,181 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the parallel_0 test
+// package and the mock R API. It checks that parallel apply functions
+// return results in order, report failures for individual elements,
+// bound the number of concurrent calls and stop dispatching calls when
+// interrupted.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// inherits returns whether the R value p has the given class.
+func inherits(p C.SEXP, class string) bool {
+	c := C.CString(class)
+	defer C.free(unsafe.Pointer(c))
+	return C.Rf_inherits(p, c) != 0
+}
+
+// message returns the message of the R condition p.
+func message(p C.SEXP) string {
+	return C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(p, 0), 0)))
+}
+
+// list returns an R list holding v.
+func list(v ...C.SEXP) C.SEXP {
+	p := C.Rf_allocVector(C.VECSXP, C.R_xlen_t(len(v)))
+	for i, e := range v {
+		C.SET_VECTOR_ELT(p, C.R_xlen_t(i), e)
+	}
+	return p
+}
+
+// returning returns a call for a parallel apply that returns the R
+// integer v.
+func returning(v int) func() func(*C.SEXP) C.SEXP {
+	return func() func(*C.SEXP) C.SEXP {
+		return func(*C.SEXP) C.SEXP { return C.Rf_ScalarInteger(C.int(v)) }
+	}
+}
+
+func init() {
+	var failed bool
+
+	err := C.R_NilValue
+	r := Wrapped_Test0_map(list(
+		list(C.Rf_ScalarReal(1), C.Rf_allocVector(C.REALSXP, 2)),
+		list(C.Rf_ScalarInteger(1), C.Rf_allocVector(C.REALSXP, 2)),
+		list(C.Rf_ScalarReal(1)),
+		list(C.Rf_ScalarReal(2), C.R_NilValue),
+	), C.R_NilValue, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error: %s\n", message(err))
+		os.Exit(1)
+	}
+	for i, want := range []string{"", "'par0'", "'args'", ""} {
+		e := C.VECTOR_ELT(r, C.R_xlen_t(i))
+		if want == "" {
+			if C.TYPEOF(e) != C.INTSXP || *C.INTEGER(e) != 0 {
+				fmt.Printf("unexpected result for element %d\n", i)
+				failed = true
+			}
+			continue
+		}
+		if !inherits(e, "go_type_error") || !strings.Contains(message(e), want) {
+			fmt.Printf("expected type error for %s in element %d\n", want, i)
+			failed = true
+		}
+	}
+
+	r = Wrapped_Test2_map(list(), C.Rf_ScalarInteger(2), &err)
+	if err != C.R_NilValue || C.TYPEOF(r) != C.VECSXP || C.Rf_xlength(r) != 0 {
+		fmt.Println("unexpected result for empty argument list")
+		failed = true
+	}
+	r = Wrapped_Test2_map(list(list(), list(), list()), C.Rf_ScalarInteger(2), &err)
+	if err != C.R_NilValue || C.Rf_xlength(r) != 3 || C.TYPEOF(C.VECTOR_ELT(r, 2)) != C.REALSXP {
+		fmt.Println("unexpected result for argument lists without arguments")
+		failed = true
+	}
+
+	var (
+		mu            sync.Mutex
+		running, peak int
+	)
+	calls := make([]func() func(*C.SEXP) C.SEXP, 16)
+	for i := range calls {
+		i := i
+		calls[i] = func() func(*C.SEXP) C.SEXP {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}()
+			if i == 3 {
+				panic("failed")
+			}
+			return returning(i)()
+		}
+	}
+	calls[5] = nil
+	r = C.Rf_allocVector(C.VECSXP, C.R_xlen_t(len(calls)))
+	C.Rf_protect(r)
+	packElements(r, callParallel(context.Background(), calls, 3))
+	if peak > 3 {
+		fmt.Printf("too many concurrent calls: %d\n", peak)
+		failed = true
+	}
+	for i := range calls {
+		e := C.VECTOR_ELT(r, C.R_xlen_t(i))
+		switch i {
+		case 3:
+			if !inherits(e, "go_panic") || message(e) != "failed" {
+				fmt.Println("expected panic condition for panicking call")
+				failed = true
+			}
+		case 5:
+			if e != C.R_NilValue {
+				fmt.Println("unexpected result for element without call")
+				failed = true
+			}
+		default:
+			if C.TYPEOF(e) != C.INTSXP || int(*C.INTEGER(e)) != i {
+				fmt.Printf("unexpected result for element %d\n", i)
+				failed = true
+			}
+		}
+	}
+	C.Rf_unprotect(1)
+
+	ctx, cancel := contextFor(C.R_NilValue)
+	calls = make([]func() func(*C.SEXP) C.SEXP, 4)
+	for i := range calls {
+		calls[i] = func() func(*C.SEXP) C.SEXP {
+			<-ctx.Done()
+			return returning(0)()
+		}
+	}
+	C.mock_interrupt()
+	var packs []func(*C.SEXP) C.SEXP
+	interruptible(cancel, func() { packs = callParallel(ctx, calls, 2) })
+	if ctx.Err() != context.Canceled {
+		fmt.Println("expected cancelled context after interrupt")
+		failed = true
+	}
+	if packs[len(packs)-1] != nil {
+		fmt.Println("unexpected call dispatched after interrupt")
+		failed = true
+	}
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
@@ -0,0 +1,127 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the rand_0 test package
+// and the mock R API. It checks that random source parameters are
+// supplied by the wrappers rather than passed from R, that they draw from
+// R's random number generator in synchronous, asynchronous and context
+// taking calls, and that draws are reproducible from a seed.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"unsafe"
+
+	"github.com/rgonomic/rgo/r"
+)
+
+// message returns the message of the R condition p.
+func message(p C.SEXP) string {
+	return C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(p, 0), 0)))
+}
+
+// double returns the value of the R double scalar p.
+func double(p C.SEXP) float64 {
+	return float64(*C.REAL(p))
+}
+
+func init() {
+	var failed bool
+
+	// Expected values are drawn while the R main thread serves
+	// requests, so it must not change.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	C.mock_set_seed(42)
+	state := uint32(42)
+	next := func() float64 {
+		state = state*1664525 + 1013904223
+		return (float64(state) + 0.5) / (1 << 32)
+	}
+
+	err := C.R_NilValue
+	v := Wrapped_Test0(C.Rf_ScalarReal(1), &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for r.Source parameter: %s\n", message(err))
+		os.Exit(1)
+	}
+	if got, want := double(v), next()+1; got != want {
+		fmt.Printf("unexpected value drawn with r.Source: got:%v want:%v\n", got, want)
+		failed = true
+	}
+	if uint32(C.mock_rng_state()) != state {
+		fmt.Println("random number generator state not saved after call")
+		failed = true
+	}
+
+	id := Wrapped_Test0_async(C.Rf_ScalarReal(2), &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error starting asynchronous call: %s\n", message(err))
+		os.Exit(1)
+	}
+	v = Wrapped_asyncValue(id, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for asynchronous value: %s\n", message(err))
+		os.Exit(1)
+	}
+	if got, want := double(v), next()+2; got != want {
+		fmt.Printf("unexpected value drawn asynchronously: got:%v want:%v\n", got, want)
+		failed = true
+	}
+	Wrapped_asyncRelease(id, &err)
+
+	C.mock_set_seed(7)
+	v = Wrapped_Test1(C.Rf_ScalarInteger(5), &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for *rand.Rand parameter: %s\n", message(err))
+		os.Exit(1)
+	}
+	got := make([]int, C.Rf_xlength(v))
+	for i, e := range (*[5]C.int)(unsafe.Pointer(C.INTEGER(v)))[:len(got)] {
+		got[i] = int(e)
+	}
+	C.mock_set_seed(7)
+	var want []int
+	interruptible(nil, func() { want = r.NewRand().Perm(5) })
+	if !reflect.DeepEqual(got, want) {
+		fmt.Printf("permutation not reproducible from seed: got:%v want:%v\n", got, want)
+		failed = true
+	}
+	saveRNG()
+
+	C.mock_set_seed(7)
+	v = Wrapped_Test2(C.R_NilValue, &err)
+	if err != C.R_NilValue {
+		fmt.Printf("unexpected error for context and *rand.Rand parameters: %s\n", message(err))
+		os.Exit(1)
+	}
+	C.mock_set_seed(7)
+	var u float64
+	interruptible(nil, func() { u = r.NewRand().Float64() })
+	if got := double(v); got != u {
+		fmt.Printf("value not reproducible from seed: got:%v want:%v\n", got, u)
+		failed = true
+	}
+	saveRNG()
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,311 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the runtime_0 test
+// package and the mock R API. It checks that warnings and messages
+// queued with the rgo runtime package are signalled as R conditions
+// once the Go call has returned, that progress is written to the R
+// console, that R functions and options can be used from Go and their
+// results remain valid after R values are collected, that requests to
+// run functions on the R main thread are served while a wrapped call is
+// running and fail after it has returned, that connections can be used
+// from other goroutines while a wrapped call is running, and that Go code
+// draws from R's random number generator.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+
+SEXP test_0(SEXP par0);
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/rgonomic/rgo/r"
+)
+
+// inherits returns whether the R value p has the given class.
+func inherits(p C.SEXP, class string) bool {
+	c := C.CString(class)
+	defer C.free(unsafe.Pointer(c))
+	return C.Rf_inherits(p, c) != 0
+}
+
+// message returns the message of the R condition p.
+func message(p C.SEXP) string {
+	return C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(p, 0), 0)))
+}
+
+// signalled returns the conditions signalled since the last call.
+func signalled() []C.SEXP {
+	var conds []C.SEXP
+	for s := C.mock_signalled(); s != C.R_NilValue; s = C.CDR(s) {
+		conds = append(conds, C.CAR(s))
+	}
+	return conds
+}
+
+func init() {
+	var failed bool
+
+	// The R main thread is the thread that calls the C shims.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var x float64
+	if err := r.Call(&x, "identity", 1.0); err != r.ErrDeadlock {
+		fmt.Printf("unexpected error before R main thread is known: %v\n", err)
+		failed = true
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.Warning("from goroutine")
+	}()
+	wg.Wait()
+	r.Message("done")
+	C.test_0(C.Rf_ScalarReal(1))
+	conds := signalled()
+	switch {
+	case len(conds) != 2:
+		fmt.Printf("unexpected number of signalled conditions: %d\n", len(conds))
+		failed = true
+	case !inherits(conds[0], "go_warning") || !inherits(conds[0], "warning") || message(conds[0]) != "from goroutine":
+		fmt.Printf("unexpected warning condition: %q\n", message(conds[0]))
+		failed = true
+	case !inherits(conds[1], "go_message") || !inherits(conds[1], "message") || message(conds[1]) != "done\n":
+		fmt.Printf("unexpected message condition: %q\n", message(conds[1]))
+		failed = true
+	}
+	C.test_0(C.Rf_ScalarReal(1))
+	if conds := signalled(); len(conds) != 0 {
+		fmt.Printf("unexpected conditions replayed twice: %d\n", len(conds))
+		failed = true
+	}
+
+	r.Warning("before failure")
+	C.test_0(C.Rf_mkString(C.CString("a")))
+	// R_raise does not return in R, unwinding its protection, but the
+	// mock stop does.
+	C.Rf_unprotect(2)
+	conds = signalled()
+	if len(conds) != 1 || message(conds[0]) != "before failure" {
+		fmt.Println("expected warning for failed call")
+		failed = true
+	}
+	if !inherits(C.mock_raised(), "go_type_error") {
+		fmt.Println("expected type error for failed call")
+		failed = true
+	}
+
+	r.Progress(1, 2)
+	interruptible(func() {}, func() { time.Sleep(3 * interruptPoll) })
+	if got := C.GoString(C.mock_console(0)); !strings.HasSuffix(got, "|  50%") {
+		fmt.Printf("unexpected progress while running: %q\n", got)
+		failed = true
+	}
+	r.Progress(2, 2)
+	err := C.R_NilValue
+	Wrapped_Test1(C.Rf_mkString(C.CString("a")), &err)
+	if got := C.GoString(C.mock_console(0)); !strings.HasSuffix(got, "| 100%\n") {
+		fmt.Printf("unexpected progress after call: %q\n", got)
+		failed = true
+	}
+	Wrapped_Test1(C.Rf_mkString(C.CString("a")), &err)
+	if got := C.GoString(C.mock_console(0)); got != "" {
+		fmt.Printf("unexpected progress without report: %q\n", got)
+		failed = true
+	}
+
+	callErr := r.Call(&x, "base::identity", 2.5)
+	if callErr != nil || x != 2.5 {
+		fmt.Printf("unexpected result of call: %v %v\n", x, callErr)
+		failed = true
+	}
+	var s []string
+	callErr = r.Call(&s, "identity", []string{"a", "b"})
+	if callErr != nil || len(s) != 2 || s[0] != "a" || s[1] != "b" {
+		fmt.Printf("unexpected result of call: %q %v\n", s, callErr)
+		failed = true
+	}
+	var f []float64
+	callErr = r.Call(&f, "identity", []float64{1.5, 2.5})
+	C.mock_gc()
+	if callErr != nil || len(f) != 2 || f[0] != 1.5 || f[1] != 2.5 {
+		fmt.Printf("unexpected result of call after collection: %v %v\n", f, callErr)
+		failed = true
+	}
+	if len(s) != 2 || s[0] != "a" || s[1] != "b" {
+		fmt.Printf("unexpected result of call after collection: %q\n", s)
+		failed = true
+	}
+	callErr = r.Call(nil, "identity", 1)
+	if callErr != nil {
+		fmt.Printf("unexpected error for discarded result: %v\n", callErr)
+		failed = true
+	}
+	var rerr *r.Error
+	callErr = r.Call(nil, "stop", "failed")
+	if !errors.As(callErr, &rerr) || rerr.Func != "stop" || rerr.Message != "Error: failed" {
+		fmt.Printf("unexpected error for failing call: %v\n", callErr)
+		failed = true
+	}
+	var b bool
+	callErr = r.Call(&b, "identity", 2.5)
+	if callErr == nil || !strings.Contains(callErr.Error(), "want logical") {
+		fmt.Printf("unexpected error for mismatched result: %v\n", callErr)
+		failed = true
+	}
+	callErr = r.Call(nil, "identity", struct{}{})
+	if callErr == nil || !strings.Contains(callErr.Error(), "unsupported argument type") {
+		fmt.Printf("unexpected error for unsupported argument: %v\n", callErr)
+		failed = true
+	}
+	var m map[int]int
+	callErr = r.Call(&m, "identity", 1)
+	if callErr == nil || !strings.Contains(callErr.Error(), "unsupported result type") {
+		fmt.Printf("unexpected error for unsupported result: %v\n", callErr)
+		failed = true
+	}
+	interruptible(nil, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var got int
+				err := r.Call(&got, "identity", i)
+				if err != nil || got != i {
+					fmt.Printf("unexpected result of call off R main thread: %d %v\n", got, err)
+					failed = true
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := r.Call(&x, "identity", 1.0)
+		if err != r.ErrDeadlock {
+			fmt.Printf("unexpected error off R main thread after return: %v\n", err)
+			failed = true
+		}
+	}()
+	wg.Wait()
+
+	empty := C.CString("")
+	con := connection{con: C.mock_connection(empty, 0)}
+	C.free(unsafe.Pointer(empty))
+	interruptible(nil, func() {
+		_, err := con.Write([]byte("served"))
+		if err != nil {
+			fmt.Printf("unexpected error writing to connection off R main thread: %v\n", err)
+			failed = true
+		}
+	})
+	written := C.mock_connection_written(con.con)
+	if got := C.GoStringN((*C.char)(unsafe.Pointer(C.RAW(written))), C.int(C.Rf_xlength(written))); got != "served" {
+		fmt.Printf("unexpected connection contents: %q\n", got)
+		failed = true
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := con.Write([]byte("late"))
+		if err != r.ErrDeadlock {
+			fmt.Printf("unexpected error writing to connection after return: %v\n", err)
+			failed = true
+		}
+	}()
+	wg.Wait()
+	err = C.R_NilValue
+	Wrapped_Test2(con.con, &err)
+	if err != C.R_NilValue {
+		fmt.Println("unexpected error for connection parameter")
+		failed = true
+	}
+
+	name := C.CString("digits")
+	C.mock_set_option(name, C.Rf_ScalarInteger(7))
+	C.free(unsafe.Pointer(name))
+	var digits int
+	callErr = r.Option(&digits, "digits")
+	if callErr != nil || digits != 7 {
+		fmt.Printf("unexpected option value: %d %v\n", digits, callErr)
+		failed = true
+	}
+	callErr = r.Option(&digits, "unset")
+	if callErr != r.ErrNoOption {
+		fmt.Printf("unexpected error for unset option: %v\n", callErr)
+		failed = true
+	}
+
+	C.mock_set_seed(42)
+	state := uint32(42)
+	next := func() float64 {
+		state = state*1664525 + 1013904223
+		return (float64(state) + 0.5) / (1 << 32)
+	}
+	var src r.Source
+	if u, want := src.Float64(), next(); u != want {
+		fmt.Printf("unexpected uniform value: got:%v want:%v\n", u, want)
+		failed = true
+	}
+	if C.mock_rng_state() != 42 {
+		fmt.Println("random number generator state saved before call returned")
+		failed = true
+	}
+	Wrapped_Test1(C.Rf_mkString(C.CString("a")), &err)
+	if uint32(C.mock_rng_state()) != state {
+		fmt.Println("random number generator state not saved after call")
+		failed = true
+	}
+	interruptible(nil, func() {
+		done := make(chan float64)
+		go func() { done <- src.Float64() }()
+		if u, want := <-done, next(); u != want {
+			fmt.Printf("unexpected uniform value off R main thread: got:%v want:%v\n", u, want)
+			failed = true
+		}
+	})
+	callErr = r.Call(nil, "identity", 1)
+	if callErr != nil || uint32(C.mock_rng_state()) != state {
+		fmt.Printf("random number generator state not saved before R call: %v\n", callErr)
+		failed = true
+	}
+	saveRNG()
+	C.mock_set_seed(7)
+	a := r.NewRand().Int63()
+	saveRNG()
+	C.mock_set_seed(7)
+	if b := r.NewRand().Int63(); a != b {
+		fmt.Printf("draws not reproducible from seed: %d != %d\n", a, b)
+		failed = true
+	}
+	saveRNG()
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
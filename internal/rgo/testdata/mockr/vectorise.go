@@ -0,0 +1,216 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the vectorise_0 test
+// package and the mock R API. It checks that vectorised functions recycle
+// their arguments, give NA results for NA arguments and report values
+// that are out of range.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+// doubles returns an R double vector holding v.
+func doubles(v ...float64) C.SEXP {
+	p := C.Rf_allocVector(C.REALSXP, C.R_xlen_t(len(v)))
+	copy((*[1 << 46]float64)(unsafe.Pointer(C.REAL(p)))[:len(v):len(v)], v)
+	return p
+}
+
+// ints returns an R integer vector holding v.
+func ints(v ...int32) C.SEXP {
+	p := C.Rf_allocVector(C.INTSXP, C.R_xlen_t(len(v)))
+	copy((*[1 << 47]int32)(unsafe.Pointer(C.INTEGER(p)))[:len(v):len(v)], v)
+	return p
+}
+
+// logicals returns an R logical vector holding v.
+func logicals(v ...int32) C.SEXP {
+	p := C.Rf_allocVector(C.LGLSXP, C.R_xlen_t(len(v)))
+	copy((*[1 << 47]int32)(unsafe.Pointer(C.LOGICAL(p)))[:len(v):len(v)], v)
+	return p
+}
+
+// complexes returns an R complex vector holding v.
+func complexes(v ...complex128) C.SEXP {
+	p := C.Rf_allocVector(C.CPLXSXP, C.R_xlen_t(len(v)))
+	copy((*[1 << 45]complex128)(unsafe.Pointer(C.COMPLEX(p)))[:len(v):len(v)], v)
+	return p
+}
+
+// strs returns an R character vector holding v. Nil elements are NA.
+func strs(v ...*string) C.SEXP {
+	p := C.Rf_allocVector(C.STRSXP, C.R_xlen_t(len(v)))
+	for i, s := range v {
+		e := C.R_NaString
+		if s != nil {
+			e = C.Rf_mkCharLenCE(C._GoStringPtr(*s), C.int(len(*s)), C.CE_UTF8)
+		}
+		C.SET_STRING_ELT(p, C.R_xlen_t(i), e)
+	}
+	return p
+}
+
+// nas returns the positions of NA values in the R vector p. NA values
+// are identified with the naInt constant and isNA function in the
+// generated code.
+func nas(p C.SEXP) []bool {
+	n := int(C.Rf_xlength(p))
+	na := make([]bool, n)
+	for i := range na {
+		switch C.TYPEOF(p) {
+		case C.LGLSXP:
+			na[i] = (*[1 << 47]int32)(unsafe.Pointer(C.LOGICAL(p)))[i] == naInt
+		case C.INTSXP:
+			na[i] = (*[1 << 47]int32)(unsafe.Pointer(C.INTEGER(p)))[i] == naInt
+		case C.REALSXP:
+			na[i] = isNA((*[1 << 46]float64)(unsafe.Pointer(C.REAL(p)))[i])
+		case C.STRSXP:
+			na[i] = C.STRING_ELT(p, C.R_xlen_t(i)) == C.R_NaString
+		}
+	}
+	return na
+}
+
+var vectorTests = []struct {
+	name   string
+	call   func(err *C.SEXP) C.SEXP
+	typ    C.int
+	wantNA []bool
+	errArg string
+}{
+	{
+		name: "recycled",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test0(doubles(1, 2, 3, 4), ints(1, 2), err)
+		},
+		typ:    C.INTSXP,
+		wantNA: []bool{false, false, false, false},
+	},
+	{
+		name: "NA double and integer",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test0(doubles(1, naReal, 3, math.NaN()), ints(1, 2, math.MinInt32, 4), err)
+		},
+		typ:    C.INTSXP,
+		wantNA: []bool{false, true, true, false},
+	},
+	{
+		name: "out of range",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test0(doubles(1, 2), ints(1, 200), err)
+		},
+		errArg: "par1",
+	},
+	{
+		name: "NA out of range",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test0(doubles(naReal, 2), ints(200, 1), err)
+		},
+		typ:    C.INTSXP,
+		wantNA: []bool{true, false},
+	},
+	{
+		name: "zero length",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test0(doubles(), ints(1, 2, 3), err)
+		},
+		typ:    C.INTSXP,
+		wantNA: []bool{},
+	},
+	{
+		name: "NA string, logical and complex",
+		call: func(err *C.SEXP) C.SEXP {
+			s := "a"
+			return Wrapped_Test1(
+				strs(&s, nil, &s, &s),
+				logicals(1, 0, math.MinInt32, 1),
+				complexes(1, 1, 1, complex(1, naReal)),
+				err,
+			)
+		},
+		typ:    C.STRSXP,
+		wantNA: []bool{false, true, true, true},
+	},
+	{
+		name: "uint8",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test2(ints(0, math.MinInt32, 255), err)
+		},
+		typ:    C.INTSXP,
+		wantNA: []bool{false, true, false},
+	},
+	{
+		name: "uint8 out of range",
+		call: func(err *C.SEXP) C.SEXP {
+			return Wrapped_Test2(ints(0, 256), err)
+		},
+		errArg: "par0",
+	},
+}
+
+func init() {
+	var failed bool
+	for _, test := range vectorTests {
+		err := C.R_NilValue
+		p := test.call(&err)
+		if test.errArg != "" {
+			if err == C.R_NilValue {
+				fmt.Printf("%s: expected error for %s\n", test.name, test.errArg)
+				failed = true
+				continue
+			}
+			msg := C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(err, 0), 0)))
+			if !strings.Contains(msg, fmt.Sprintf("'%s'", test.errArg)) {
+				fmt.Printf("%s: unexpected error message: %s\n", test.name, msg)
+				failed = true
+			}
+			continue
+		}
+		if err != C.R_NilValue {
+			fmt.Printf("%s: unexpected error: %s\n", test.name, C.GoString(C.R_CHAR(C.STRING_ELT(C.VECTOR_ELT(err, 0), 0))))
+			failed = true
+			continue
+		}
+		if typ := C.TYPEOF(p); typ != test.typ {
+			fmt.Printf("%s: unexpected R type: got:%d want:%d\n", test.name, typ, test.typ)
+			failed = true
+			continue
+		}
+		got := nas(p)
+		if len(got) != len(test.wantNA) {
+			fmt.Printf("%s: unexpected length: got:%d want:%d\n", test.name, len(got), len(test.wantNA))
+			failed = true
+			continue
+		}
+		for i := range got {
+			if got[i] != test.wantNA[i] {
+				fmt.Printf("%s: unexpected NA positions: got:%v want:%v\n", test.name, got, test.wantNA)
+				failed = true
+				break
+			}
+		}
+		if depth := C.mock_protect_depth(); depth != 0 {
+			fmt.Printf("%s: unbalanced protection: depth=%d\n", test.name, depth)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
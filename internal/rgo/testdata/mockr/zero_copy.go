@@ -0,0 +1,129 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is built with the generated code for the zero_copy_0 test
+// package and the mock R API. It checks that in the poison zero-copy
+// mode Go values unpacked from R vectors do not share R memory, that the
+// strings of a character vector share a single view, and that they fault
+// when they are used after the wrapped call has returned.
+
+package main
+
+/*
+#include <R.h>
+#include <Rinternals.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"unsafe"
+)
+
+// Sinks for loads from views so that the loads are not eliminated.
+var (
+	sinkFloat float64
+	sinkByte  byte
+)
+
+// faults returns whether f faults when accessing memory.
+func faults(f func()) (faulted bool) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		_, faulted = r.(interface{ Addr() uintptr })
+		if !faulted {
+			panic(r)
+		}
+	}()
+	f()
+	return false
+}
+
+func init() {
+	var failed bool
+
+	v := C.Rf_allocVector(C.REALSXP, 3)
+	C.Rf_protect(v)
+	copy((*[3]float64)(unsafe.Pointer(C.REAL(v)))[:], []float64{1, 2, 3})
+	raw := C.Rf_allocVector(C.RAWSXP, 2)
+	C.Rf_protect(raw)
+	copy((*[2]byte)(unsafe.Pointer(C.RAW(raw)))[:], "ab")
+	str := C.Rf_mkString(C.CString("retained"))
+	C.Rf_protect(str)
+	strs := C.Rf_allocVector(C.STRSXP, 3)
+	C.Rf_protect(strs)
+	for i, e := range []string{"one", "", "three"} {
+		C.SET_STRING_ELT(strs, C.R_xlen_t(i), C.Rf_mkCharLenCE(C.CString(e), C.int(len(e)), C.CE_UTF8))
+	}
+
+	mark := len(views)
+	s := unpackSEXP_types_Slice___float64(v)
+	b := unpackSEXP_types_Slice___byte(raw)
+	t := unpackSEXP_types_Basic_string(str)
+	if fmt.Sprint(s) != "[1 2 3]" || string(b) != "ab" || t != "retained" {
+		fmt.Printf("unexpected unpacked values: %v %q %q\n", s, b, t)
+		failed = true
+	}
+	(*[3]float64)(unsafe.Pointer(C.REAL(v)))[0] = 10
+	if s[0] != 1 {
+		fmt.Println("unpacked slice shares R memory")
+		failed = true
+	}
+	if faults(func() { sinkFloat = s[0] }) {
+		fmt.Println("unexpected fault before views were poisoned")
+		failed = true
+	}
+	if empty := unpackSEXP_types_Slice___float64(C.Rf_allocVector(C.REALSXP, 0)); len(empty) != 0 || len(views) != mark+3 {
+		fmt.Printf("unexpected view of empty vector: len=%d views=%d\n", len(empty), len(views)-mark)
+		failed = true
+	}
+
+	n := len(views)
+	ss := unpackSEXP_types_Slice___string(strs)
+	if fmt.Sprintf("%q", ss) != `["one" "" "three"]` || len(views) != n+1 {
+		fmt.Printf("unexpected unpacked strings: %q views=%d\n", ss, len(views)-n)
+		failed = true
+	}
+
+	poisonViews(mark)
+	if len(views) != mark {
+		fmt.Printf("unexpected views after poisoning: %d\n", len(views)-mark)
+		failed = true
+	}
+	for name, f := range map[string]func(){
+		"[]float64": func() { sinkFloat = s[0] },
+		"[]byte":    func() { sinkByte = b[1] },
+		"string":    func() { sinkByte = t[0] },
+		"[]string":  func() { sinkByte = ss[2][0] },
+	} {
+		if !faults(f) {
+			fmt.Printf("no fault using poisoned %s view\n", name)
+			failed = true
+		}
+	}
+
+	err := C.R_NilValue
+	Wrapped_Test0(v, raw, str, &err)
+	if err != C.R_NilValue || len(views) != 0 {
+		fmt.Printf("unexpected state after wrapped call: err=%v views=%d\n", err != C.R_NilValue, len(views))
+		failed = true
+	}
+	C.Rf_unprotect(4)
+
+	if depth := C.mock_protect_depth(); depth != 0 {
+		fmt.Printf("unbalanced protection: depth=%d\n", depth)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+	os.Exit(0)
+}
@@ -0,0 +1,3 @@
+module multi_array_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module optional_0
+
+go 1.15
@@ -0,0 +1,3 @@
+module output_0
+
+go 1.15
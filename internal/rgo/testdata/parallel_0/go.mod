@@ -0,0 +1,3 @@
+module parallel_0
+
+go 1.15
@@ -0,0 +1,7 @@
+module runtime_0
+
+go 1.25.0
+
+require github.com/rgonomic/rgo v0.0.0
+
+replace github.com/rgonomic/rgo => ../../../..
@@ -0,0 +1,3 @@
+module string_error_map_out_0
+
+go 1.15
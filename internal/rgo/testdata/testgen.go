@@ -17,6 +17,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"text/template"
 )
 
@@ -32,14 +33,204 @@ var crafted = []pkg{
 			{In: []string{"T", "S1"}, HelpIn: []string{"int", "string"}, Out: []string{"S1"}, HelpOut: []string{"string"}},
 		},
 	},
+	{
+		Name: "multi_array",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"[3][4]float64"}, Out: []string{"[2][3][4]int"}},
+			{In: []string{"[2][2]bool", "[2][2]string"}, Out: []string{"[2][2]complex128"}},
+		},
+	},
+	{
+		Name:  "optional",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Types: []string{"T struct{F1 []int; F2 float64}"},
+		Funcs: []fn{
+			{In: []string{"*T", "[]float64", "map[string]int"}, HelpIn: []string{"T", "[]int", "int", "float64", "string"}},
+		},
+	},
+	{
+		Name:  "in_out",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Types: []string{"T struct{F1 float64}"},
+		Funcs: []fn{
+			{In: []string{"*T"}, HelpIn: []string{"T", "float64"}},
+			{In: []string{"*T", "*float64", "int"}, HelpIn: []string{"T", "float64"}, Out: []string{"int"}, Named: true},
+		},
+	},
+	{
+		Name: "comma_ok",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"int"}, Out: []string{"float64", "bool"}},
+			{In: []string{"int"}, Out: []string{"float64", "string", "bool"}, HelpOut: []string{"string"}, Named: true},
+		},
+	},
+	{
+		Name:    "connection",
+		Path:    "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Imports: []string{"io"},
+		Funcs: []fn{
+			{In: []string{"io.Reader"}, Out: []string{"int"}},
+			{In: []string{"io.ReadCloser", "io.Writer"}},
+		},
+	},
+	{
+		Name: "error_condition",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"int"}, Out: []string{"float64", "error"}},
+			{In: []string{"string"}, Out: []string{"error"}},
+		},
+	},
+	{
+		Name: "coerce",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"int8", "[]float64"}, Out: []string{"int"}},
+			{In: []string{"[]uint16"}},
+		},
+	},
+	{
+		Name: "int_overflow",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"int"}, Out: []string{"uint", "[]int"}},
+			{Out: []string{"map[string]int32", "[2][2]uint32"}, Named: true},
+		},
+	},
+	{
+		Name: "invalid_string",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"string"}, Out: []string{"string", "[]string"}},
+			{Out: []string{"map[string]string"}},
+		},
+	},
+	{
+		Name: "long_vector",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{
+				In:  []string{"[]bool", "[]byte", "[]int8", "[]int16", "[]int32", "[]int", "[]uint16", "[]uint32", "[]uint", "[]float32", "[]float64", "[]complex64", "[]complex128", "[]string"},
+				Out: []string{"[]bool", "[]byte", "[]int8", "[]int16", "[]int32", "[]int", "[]uint16", "[]uint32", "[]uint", "[]float32", "[]float64", "[]complex64", "[]complex128", "[]string", "[]error"},
+			},
+		},
+	},
+	{
+		Name:  "error_slice_out",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{{Out: []string{"[]error"}}},
+	},
+	{
+		Name:  "error_slice_out_named",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{{Out: []string{"[]error"}, Named: true}},
+	},
+	{
+		Name:  "string_error_map_out",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{{Out: []string{"map[string]error"}}},
+	},
+	{
+		Name:  "string_error_map_out_named",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{{Out: []string{"map[string]error"}, Named: true}},
+	}, {
+		Name:    "context",
+		Path:    "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Imports: []string{"context"},
+		Funcs: []fn{
+			{In: []string{"context.Context"}},
+			{In: []string{"context.Context", "float64", "[]int"}, Out: []string{"int", "error"}},
+		},
+	},
+	{
+		Name: "vectorise",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"float64", "int8"}, Out: []string{"int"}},
+			{In: []string{"string", "bool", "complex128"}, Out: []string{"string"}},
+			{In: []string{"uint8"}, Out: []string{"uint8"}},
+			{In: []string{"[]float64"}, Out: []string{"float64"}},
+		},
+	},
+	{
+		Name: "async",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"float64", "[]float64"}, Out: []string{"int", "error"}},
+			{In: []string{"string"}, Out: []string{"[]string"}},
+			{In: []string{"map[string]int"}},
+		},
+	},
+	{
+		Name: "parallel",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"float64", "[]float64"}, Out: []string{"int", "error"}},
+			{In: []string{"string"}, Out: []string{"[]string"}},
+			{Out: []string{"float64"}},
+		},
+	},
+	{
+		Name:  "output",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{{In: []string{"string"}, Out: []string{"string"}}},
+	},
+	{
+		Name:    "runtime",
+		Path:    "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Imports: []string{"io", "github.com/rgonomic/rgo/r"},
+		Types:   []string{"Condition = r.Condition"},
+		Funcs: []fn{
+			{In: []string{"float64"}, Out: []string{"float64"}},
+			{In: []string{"string"}},
+			{In: []string{"io.Writer"}},
+		},
+	},
+	{
+		Name: "copy_on_write",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"[]float64"}, Out: []string{"[]float64"}},
+			{In: []string{"[]float64", "[]int32", "string"}},
+			{In: []string{"[]byte"}},
+		},
+	},
+	{
+		Name: "zero_copy",
+		Path: "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{
+			{In: []string{"[]float64", "[]byte", "string"}, Out: []string{"[]float64"}},
+			{In: []string{"map[string]int32", "[2]string"}},
+			{In: []string{"[]string"}},
+		},
+	},
+	{
+		Name:    "rand",
+		Path:    "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Imports: []string{"context", "math/rand", "github.com/rgonomic/rgo/r"},
+		Funcs: []fn{
+			{In: []string{"r.Source", "float64"}, Out: []string{"float64"}, Body: "return par0.Float64() + par1"},
+			{In: []string{"*rand.Rand", "int"}, Out: []string{"[]int"}, Body: "return par0.Perm(par1)"},
+			{In: []string{"context.Context", "*rand.Rand"}, Out: []string{"float64"}, Body: "return par1.Float64()"},
+		},
+	},
+	{
+		Name:  "go_runtime",
+		Path:  "github.com/rgonomic/rgo/internal/rgo/testdata",
+		Funcs: []fn{{In: []string{"float64"}, Out: []string{"float64"}}},
+	},
 }
 
 type pkg struct {
-	Name  string
-	UID   int
-	Path  string
-	Types []string
-	Funcs []fn
+	Name    string
+	UID     int
+	Path    string
+	Imports []string
+	Types   []string
+	Funcs   []fn
 }
 
 type fn struct {
@@ -49,6 +240,7 @@ type fn struct {
 	Out     []string `json:"out,omitempty"` // Output parameter types.
 	HelpOut []string `json:"-"`             // Composing types for output parameters.
 	Named   bool     `json:"-"`             // Whether the output parameter types are named.
+	Body    string   `json:"-"`             // Function body replacing the zero value returns.
 }
 
 func builtins() []pkg {
@@ -208,14 +400,46 @@ func main() {
 			if err != nil {
 				log.Fatalf("failed create go.mod file: %v", err)
 			}
+			if !usesRgo(c) {
+				continue
+			}
+			cmd = exec.Command("go", "mod", "edit", "-go="+rgoGoVersion, "-require="+rgo+"@v0.0.0", "-replace="+rgo+"=../../../..")
+			cmd.Dir = filepath.Join(".", pkg)
+			err = cmd.Run()
+			if err != nil {
+				log.Fatalf("failed to add rgo requirement to go.mod file: %v", err)
+			}
+		}
+	}
+}
+
+// rgo is the module path of rgo.
+const rgo = "github.com/rgonomic/rgo"
+
+// rgoGoVersion is the Go version required by the rgo module, which must
+// also be required by packages using it.
+const rgoGoVersion = "1.25.0"
+
+// usesRgo returns whether the package c imports a package from the rgo
+// module, which is replaced by the module containing the test packages.
+func usesRgo(c pkg) bool {
+	for _, p := range c.Imports {
+		if strings.HasPrefix(p, rgo+"/") {
+			return true
 		}
 	}
+	return false
 }
 
 var src = template.Must(template.New("Go source").Parse(`// Code generated by "go generate github.com/rgonomic/rgo/internal/pkg/testdata"; DO NOT EDIT.
 
 package {{.Name}}_{{.UID}}
-{{if .Types}}
+{{if .Imports}}
+import (
+{{- range $i, $p := .Imports}}
+	"{{$p}}"{{end}}
+)
+{{end}}{{if .Types}}
 type (
 {{- range $i, $t := .Types}}
 	{{$t}}{{end}}
@@ -226,9 +450,11 @@ type (
 func Test{{$i}}({{if $fn.In}}{{range $j, $p := $fn.In -}}
 	{{- if ne $j 0}}, {{end}}par{{$j}} {{$p -}}
 {{- end}}{{end}}){{if $fn.Out}} ({{range $j, $p := $fn.Out -}}
-	{{- if ne $j 0}}, {{end}}{{if $fn.Named}}res{{$j}} {{end}}{{$p}}{{end}}){{end}} { {{if not $fn.Named}}{{range $j, $p := $fn.Out}}
+	{{- if ne $j 0}}, {{end}}{{if $fn.Named}}res{{$j}} {{end}}{{$p}}{{end}}){{end}} { {{if $fn.Body}}
+	{{$fn.Body}}
+}{{else}}{{if not $fn.Named}}{{range $j, $p := $fn.Out}}
 	var res{{$j}} {{$p}}{{end}}{{end}}
 {{if $fn.Out}}	return {{range $j, $p := $fn.Out -}}
 	{{- if ne $j 0}}, {{end}}res{{$j}}{{end}}
-{{end}}}{{end}}
+{{end}}}{{end}}{{end}}
 `))
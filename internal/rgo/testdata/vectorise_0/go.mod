@@ -0,0 +1,3 @@
+module vectorise_0
+
+go 1.15
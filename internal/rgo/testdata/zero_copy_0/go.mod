@@ -0,0 +1,3 @@
+module zero_copy_0
+
+go 1.15
@@ -0,0 +1,107 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package r
+
+import "sync"
+
+// executor holds the requests made by Do that are waiting to be run on
+// the R main thread.
+var executor = struct {
+	mu      sync.Mutex
+	serving int // Number of wrapped calls serving requests.
+	pending []*request
+
+	// wake receives when a request is added to pending.
+	wake chan struct{}
+}{wake: make(chan struct{}, 1)}
+
+// request is a function to be run on the R main thread.
+type request struct {
+	f    func()
+	done chan struct{}
+
+	panicked bool
+	value    interface{} // Value recovered from a panic in f.
+}
+
+// run calls the request's function, recording any panic, and closes
+// the request's done channel.
+func (r *request) run() {
+	defer close(r.done)
+	defer func() {
+		v := recover()
+		if v != nil {
+			r.panicked = true
+			r.value = v
+		}
+	}()
+	r.f()
+}
+
+// Do calls f on the R main thread and waits for it to return. If Do is
+// called on the R main thread, f is called directly. Otherwise f is run
+// by the wrapped call that is waiting for Go code to return, so Do must
+// only be called from other goroutines while a wrapped call is running;
+// if no wrapped call is running, Do returns ErrDeadlock without calling
+// f. If f panics, Do panics with the same value in the calling goroutine.
+func Do(f func()) error {
+	if evaluator == nil {
+		return ErrNoSession
+	}
+	if evaluator.OnMainThread() {
+		f()
+		return nil
+	}
+
+	req := &request{f: f, done: make(chan struct{})}
+	executor.mu.Lock()
+	if executor.serving == 0 {
+		executor.mu.Unlock()
+		return ErrDeadlock
+	}
+	executor.pending = append(executor.pending, req)
+	executor.mu.Unlock()
+	select {
+	case executor.wake <- struct{}{}:
+	default:
+	}
+
+	<-req.done
+	if req.panicked {
+		panic(req.value)
+	}
+	return nil
+}
+
+// Serve starts serving requests made by Do. It returns a channel that
+// receives when requests are pending, which should then be run with
+// RunPending, and a function that runs any requests that are still
+// pending and stops serving. Requests made after the last serving call
+// has stopped fail with ErrDeadlock. Serve, RunPending and the returned
+// function must be called on the R main thread. They are called by rgo
+// generated code while it waits for Go code to return.
+func Serve() (pending <-chan struct{}, stop func()) {
+	executor.mu.Lock()
+	executor.serving++
+	executor.mu.Unlock()
+	return executor.wake, func() {
+		executor.mu.Lock()
+		executor.serving--
+		executor.mu.Unlock()
+		RunPending()
+	}
+}
+
+// RunPending runs the pending requests made by Do. It must be called on
+// the R main thread.
+func RunPending() {
+	executor.mu.Lock()
+	reqs := executor.pending
+	executor.pending = nil
+	executor.mu.Unlock()
+	for _, req := range reqs {
+		req.run()
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package r provides functions for Go code wrapped by rgo to report
+// warnings, messages and progress to R, and to call back into the R
+// session hosting it.
+//
+// R may only be called from the R thread and R conditions may not be
+// signalled while Go code is running, so reports are queued and are
+// replayed by the generated wrapper. Warnings and messages are signalled
+// as R conditions once the wrapped call has returned, and progress is
+// written to the R console as a text progress bar while the call is
+// running. The functions in this package may be called from any
+// goroutine. Reports made when no wrapped call is running are replayed
+// when the next wrapped call returns.
+//
+// The R API may only be used on the R main thread. Do runs functions on
+// the R main thread on behalf of other goroutines while a wrapped call is
+// running, and Call and Option use it to evaluate R code, so they may be
+// called from any goroutine during a wrapped call.
+//
+// Source draws pseudo-random numbers from R's random number generator
+// using Do, so that Go code can be seeded with set.seed in the same way
+// as R code.
+package r
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNoSession is returned by Call and Option when there is no
+	// hosting R session.
+	ErrNoSession = errors.New("r: no R session")
+
+	// ErrNotMainThread is returned by an Evaluator when it is not
+	// called on the R main thread.
+	ErrNotMainThread = errors.New("r: not called on the R main thread")
+
+	// ErrDeadlock is returned by Do, Call and Option when they are
+	// called off the R main thread while no wrapped call is running,
+	// since the request would never be served.
+	ErrDeadlock = errors.New("r: R main thread request made outside a wrapped call")
+
+	// ErrNoOption is returned by Option when the option is not set.
+	ErrNoOption = errors.New("r: option not set")
+)
+
+// Error is an R error raised during a call made by Call.
+type Error struct {
+	Func    string // Name of the called function.
+	Message string // Message of the R error.
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("r: error calling %s: %s", e.Func, e.Message)
+}
+
+// Evaluator evaluates R calls and looks up R options in the hosting R
+// session. It is implemented by rgo generated code. The results are
+// unpacked into dst, which must be a pointer to a type that the
+// generated code can unpack R values into. Call and Option must only
+// be called on the R main thread.
+type Evaluator interface {
+	Call(dst interface{}, fn string, args []interface{}) error
+	Option(dst interface{}, name string) error
+
+	// OnMainThread returns whether it is called on the R main thread.
+	OnMainThread() bool
+}
+
+var evaluator Evaluator
+
+// SetEvaluator sets the Evaluator used by Call and Option. It is called
+// by rgo generated code when the R package is loaded.
+func SetEvaluator(e Evaluator) {
+	evaluator = e
+}
+
+// Call calls the R function fn with the arguments args and stores the
+// result in the value pointed to by dst. If dst is nil, the result is
+// discarded. The function may be qualified with its package, for example
+// "stats::qnorm". The arguments are packed and the result is unpacked in
+// the same way as for wrapped functions, except that the result is copied
+// into Go memory. R errors are returned as *Error.
+// The call is made on the R main thread using Do.
+func Call(dst interface{}, fn string, args ...interface{}) error {
+	var err error
+	doErr := Do(func() { err = evaluator.Call(dst, fn, args) })
+	if doErr != nil {
+		return doErr
+	}
+	return err
+}
+
+// Option stores the value of the R option name in the value pointed to by
+// dst. If the option is not set, ErrNoOption is returned. The option is
+// looked up on the R main thread using Do.
+func Option(dst interface{}, name string) error {
+	var err error
+	doErr := Do(func() { err = evaluator.Option(dst, name) })
+	if doErr != nil {
+		return doErr
+	}
+	return err
+}
+
+// Kind is the kind of a queued R condition.
+type Kind int
+
+const (
+	// WarningCondition is an R warning.
+	WarningCondition Kind = iota
+	// MessageCondition is an R message.
+	MessageCondition
+)
+
+// Condition is a queued R condition.
+type Condition struct {
+	Kind Kind
+	Text string
+}
+
+// barWidth is the width of the bar in progress bars.
+const barWidth = 50
+
+var queue struct {
+	mu    sync.Mutex
+	conds []Condition
+
+	reported    bool
+	done, total int
+}
+
+// Warning queues an R warning with a message formatted from a in the
+// manner of fmt.Sprint.
+func Warning(a ...interface{}) {
+	push(Condition{Kind: WarningCondition, Text: fmt.Sprint(a...)})
+}
+
+// Message queues an R message with a message formatted from a in the
+// manner of fmt.Sprint. The message is terminated by a newline when it
+// is signalled, as it is by the R message function.
+func Message(a ...interface{}) {
+	push(Condition{Kind: MessageCondition, Text: fmt.Sprint(a...)})
+}
+
+func push(c Condition) {
+	queue.mu.Lock()
+	queue.conds = append(queue.conds, c)
+	queue.mu.Unlock()
+}
+
+// Progress reports that done of total units of work have been completed.
+// Only the most recent report is shown. Reports with a non-positive total
+// are ignored.
+func Progress(done, total int) {
+	if total <= 0 {
+		return
+	}
+	if done < 0 {
+		done = 0
+	}
+	if done > total {
+		done = total
+	}
+	queue.mu.Lock()
+	queue.reported = true
+	queue.done = done
+	queue.total = total
+	queue.mu.Unlock()
+}
+
+// Conditions returns the conditions queued since the last call to
+// Conditions in the order they were queued. It is called by rgo
+// generated code.
+func Conditions() []Condition {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	c := queue.conds
+	queue.conds = nil
+	return c
+}
+
+// ProgressBar returns a text progress bar for the most recent progress
+// report and whether there has been a report since the last call to
+// ProgressBar. The bar begins with a carriage return so that it
+// overwrites the previous bar, and ends with a newline when all the work
+// has been completed. It is called by rgo generated code.
+func ProgressBar() (bar string, ok bool) {
+	queue.mu.Lock()
+	reported, done, total := queue.reported, queue.done, queue.total
+	queue.reported = false
+	queue.mu.Unlock()
+	if !reported {
+		return "", false
+	}
+	n := done * barWidth / total
+	bar = fmt.Sprintf("\r  |%s%s| %3d%%", strings.Repeat("=", n), strings.Repeat(" ", barWidth-n), done*100/total)
+	if done == total {
+		bar += "\n"
+	}
+	return bar, true
+}
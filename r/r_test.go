@@ -0,0 +1,202 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package r
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	Warning("value ", 1, " is ", 2.5)
+	Message("done")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Warning("concurrent")
+		}()
+	}
+	wg.Wait()
+
+	got := Conditions()
+	want := []Condition{
+		{Kind: WarningCondition, Text: "value 1 is 2.5"},
+		{Kind: MessageCondition, Text: "done"},
+	}
+	if len(got) != 12 || !reflect.DeepEqual(got[:2], want) {
+		t.Errorf("unexpected conditions: got:%v want:%v followed by 10 warnings", got, want)
+	}
+	if got := Conditions(); got != nil {
+		t.Errorf("unexpected conditions after replay: %v", got)
+	}
+}
+
+var progressTests = []struct {
+	done, total int
+	want        string
+	ok          bool
+}{
+	{done: 1, total: 0, ok: false},
+	{done: 0, total: 4, want: "\r  |                                                  |   0%", ok: true},
+	{done: 1, total: 4, want: "\r  |============                                      |  25%", ok: true},
+	{done: -1, total: 3, want: "\r  |                                                  |   0%", ok: true},
+	{done: 5, total: 4, want: "\r  |==================================================| 100%\n", ok: true},
+}
+
+func TestProgressBar(t *testing.T) {
+	for _, test := range progressTests {
+		Progress(test.done, test.total)
+		got, ok := ProgressBar()
+		if got != test.want || ok != test.ok {
+			t.Errorf("unexpected progress bar for %d/%d: got:%q,%t want:%q,%t",
+				test.done, test.total, got, ok, test.want, test.ok)
+		}
+	}
+
+	Progress(1, 2)
+	Progress(2, 2)
+	if got, _ := ProgressBar(); got != "\r  |==================================================| 100%\n" {
+		t.Errorf("unexpected progress bar for most recent report: %q", got)
+	}
+	if got, ok := ProgressBar(); ok {
+		t.Errorf("unexpected progress bar without report: %q", got)
+	}
+}
+
+// fakeEvaluator records the calls made through Call and Option.
+type fakeEvaluator struct {
+	fn   string
+	args []interface{}
+
+	// main is the value returned by OnMainThread.
+	main bool
+}
+
+func (e *fakeEvaluator) Call(dst interface{}, fn string, args []interface{}) error {
+	e.fn, e.args = fn, args
+	*dst.(*float64) = 1.96
+	return nil
+}
+
+func (e *fakeEvaluator) Option(dst interface{}, name string) error {
+	if name != "digits" {
+		return ErrNoOption
+	}
+	*dst.(*int) = 7
+	return nil
+}
+
+func (e *fakeEvaluator) OnMainThread() bool { return e.main }
+
+func TestEvaluator(t *testing.T) {
+	var q float64
+	err := Call(&q, "stats::qnorm", 0.975)
+	if err != ErrNoSession {
+		t.Errorf("unexpected error without session: got:%v want:%v", err, ErrNoSession)
+	}
+
+	e := &fakeEvaluator{main: true}
+	SetEvaluator(e)
+	defer SetEvaluator(nil)
+	err = Call(&q, "stats::qnorm", 0.975)
+	if err != nil || q != 1.96 || e.fn != "stats::qnorm" || !reflect.DeepEqual(e.args, []interface{}{0.975}) {
+		t.Errorf("unexpected call: err=%v q=%v fn=%q args=%v", err, q, e.fn, e.args)
+	}
+	var digits int
+	err = Option(&digits, "digits")
+	if err != nil || digits != 7 {
+		t.Errorf("unexpected option value: err=%v digits=%d", err, digits)
+	}
+	err = Option(&digits, "unset")
+	if err != ErrNoOption {
+		t.Errorf("unexpected error for unset option: got:%v want:%v", err, ErrNoOption)
+	}
+}
+
+func TestDo(t *testing.T) {
+	SetEvaluator(&fakeEvaluator{main: false})
+	defer SetEvaluator(nil)
+
+	err := Do(func() { t.Error("unexpected call without serving wrapper") })
+	if err != ErrDeadlock {
+		t.Errorf("unexpected error without serving wrapper: got:%v want:%v", err, ErrDeadlock)
+	}
+
+	pending, stop := Serve()
+	var ran bool
+	errc := make(chan error)
+	go func() { errc <- Do(func() { ran = true }) }()
+	<-pending
+	RunPending()
+	err = <-errc
+	if err != nil || !ran {
+		t.Errorf("unexpected result of served request: ran=%t err=%v", ran, err)
+	}
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		Do(func() { panic("failed") })
+	}()
+	<-pending
+	RunPending()
+	if v := <-panicked; v != "failed" {
+		t.Errorf("unexpected panic value from request: %v", v)
+	}
+
+	ran = false
+	go func() { errc <- Do(func() { ran = true }) }()
+	<-pending
+	stop()
+	err = <-errc
+	if err != nil || !ran {
+		t.Errorf("unexpected result of request pending when serving stopped: ran=%t err=%v", ran, err)
+	}
+
+	err = Call(nil, "identity", 1)
+	if err != ErrDeadlock {
+		t.Errorf("unexpected error for call after serving stopped: got:%v want:%v", err, ErrDeadlock)
+	}
+}
+
+// fakeGenerator returns uniform values from a fixed sequence.
+type fakeGenerator struct {
+	values []float64
+}
+
+func (g *fakeGenerator) Uniform() float64 {
+	u := g.values[0]
+	g.values = g.values[1:]
+	return u
+}
+
+func TestSource(t *testing.T) {
+	SetEvaluator(&fakeEvaluator{main: true})
+	defer SetEvaluator(nil)
+	SetGenerator(&fakeGenerator{values: []float64{0.25, 0.5, 0.75, 0.5, 0.125, 0.5, 0.5, 0.5, 0.5}})
+	defer SetGenerator(nil)
+
+	var src Source
+	if got := src.Float64(); got != 0.25 {
+		t.Errorf("unexpected uniform value: got:%v want:0.25", got)
+	}
+	if got, want := src.Uint64(), uint64(0x8000c00080002000); got != want {
+		t.Errorf("unexpected 64-bit value: got:%#x want:%#x", got, want)
+	}
+	if got, want := src.Int63(), int64(0x8000800080008000>>1); got != want {
+		t.Errorf("unexpected 63-bit value: got:%#x want:%#x", got, want)
+	}
+
+	SetEvaluator(&fakeEvaluator{main: false})
+	defer func() {
+		if r := recover(); r != ErrDeadlock {
+			t.Errorf("unexpected panic drawing outside a wrapped call: got:%v want:%v", r, ErrDeadlock)
+		}
+	}()
+	src.Float64()
+}
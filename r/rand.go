@@ -0,0 +1,94 @@
+// Copyright ©2020 The rgonomic Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package r
+
+import "math/rand"
+
+// Generator draws from the random number generator of the hosting R
+// session. It is implemented by rgo generated code. Uniform must only be
+// called on the R main thread.
+type Generator interface {
+	// Uniform returns a uniformly distributed value in (0, 1)
+	// drawn in the same way as by runif.
+	Uniform() float64
+}
+
+var generator Generator
+
+// SetGenerator sets the Generator used by Source. It is called by rgo
+// generated code when the R package is loaded.
+func SetGenerator(g Generator) {
+	generator = g
+}
+
+// Source is a source of pseudo-random numbers drawn from the random
+// number generator of the hosting R session, so that Go code that uses
+// it draws from the stream seeded by set.seed and advances it in the same
+// way as R code. Source implements math/rand.Source64, and its Uint64
+// method implements math/rand/v2.Source.
+//
+// A wrapped function may take a Source or a *rand.Rand as its first
+// parameter, or its second after a context.Context. The parameter is
+// supplied by the wrapper and is not passed from R.
+//
+// Values are drawn on the R main thread using Do, so a Source may be used
+// from any goroutine while a wrapped call is running, but values drawn
+// concurrently are taken from the stream in an unspecified order. The
+// methods of Source panic with the error returned by Do if the values
+// cannot be drawn.
+type Source struct{}
+
+// NewRand returns a *rand.Rand that draws from R's random number
+// generator.
+func NewRand() *rand.Rand {
+	return rand.New(Source{})
+}
+
+// Float64 returns a uniformly distributed value in (0, 1) drawn in the
+// same way as by runif(1).
+func (Source) Float64() float64 {
+	var u float64
+	draw(func() { u = generator.Uniform() })
+	return u
+}
+
+// Uint64 returns a pseudo-random 64-bit value. The value is built from
+// 16 bits taken from each of four uniform values in the same way that R
+// builds random integers for sample with the "Rejection" sample kind.
+func (Source) Uint64() uint64 {
+	var v uint64
+	draw(func() {
+		for i := 0; i < 4; i++ {
+			v = v<<16 | uint64(generator.Uniform()*(1<<16))
+		}
+	})
+	return v
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer.
+func (s Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Seed seeds R's random number generator by calling set.seed with the
+// low 32 bits of seed.
+func (Source) Seed(seed int64) {
+	err := Call(nil, "set.seed", int(int32(seed)))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// draw calls f on the R main thread using Do, panicking if there is no
+// Generator or if Do fails.
+func draw(f func()) {
+	if generator == nil {
+		panic(ErrNoSession)
+	}
+	err := Do(f)
+	if err != nil {
+		panic(err)
+	}
+}